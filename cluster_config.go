@@ -0,0 +1,264 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+	kjson "sigs.k8s.io/json"
+	"sigs.k8s.io/yaml"
+
+	"github.com/cert-manager-webhook-libdns/providers"
+)
+
+const (
+	// clusterDefaultsKey holds a LibdnsConfig fragment applied beneath every issuer config
+	clusterDefaultsKey = "defaults"
+
+	// clusterPolicyKey holds the ClusterPolicy every issuer config must satisfy
+	clusterPolicyKey = "policy"
+)
+
+// ClusterPolicy restricts what issuer configs may use, across all issuers
+type ClusterPolicy struct {
+	// AllowedProviders lists the providers issuers may use (default: all)
+	AllowedProviders []string `json:"allowedProviders,omitempty"`
+
+	// MinTTL is the lowest TTL in seconds an issuer may configure
+	MinTTL int `json:"minTTL,omitempty"`
+
+	// MaxTTL is the highest TTL in seconds an issuer may configure
+	MaxTTL int `json:"maxTTL,omitempty"`
+}
+
+// clusterConfig is the parsed content of the cluster defaults ConfigMap
+type clusterConfig struct {
+	// defaults is the JSON of a LibdnsConfig decoded before each issuer config
+	defaults []byte
+
+	policy ClusterPolicy
+}
+
+// clusterDefaults holds the current cluster defaults and policy, replaced
+// whenever the ConfigMap changes. The zero value applies none.
+type clusterDefaults struct {
+	current atomic.Pointer[clusterConfig]
+}
+
+// load returns the current cluster config, or nil if there is none
+func (d *clusterDefaults) load() *clusterConfig {
+	return d.current.Load()
+}
+
+// clusterConfigMapFromEnv reads the defaults ConfigMap from CLUSTER_CONFIGMAP
+// in the form namespace/name; both are empty when it is unset
+func clusterConfigMapFromEnv() (namespace, name string, err error) {
+	raw := strings.TrimSpace(os.Getenv("CLUSTER_CONFIGMAP"))
+	if raw == "" {
+		return "", "", nil
+	}
+	namespace, name, err = cache.SplitMetaNamespaceKey(raw)
+	if err != nil || namespace == "" || name == "" {
+		return "", "", fmt.Errorf("invalid CLUSTER_CONFIGMAP %q: must be namespace/name", raw)
+	}
+	return namespace, name, nil
+}
+
+// parseClusterConfig decodes the defaults and policy of cm; both keys are
+// optional and may hold YAML or JSON
+func parseClusterConfig(cm *corev1.ConfigMap) (*clusterConfig, error) {
+	cc := &clusterConfig{}
+
+	if raw := cm.Data[clusterDefaultsKey]; strings.TrimSpace(raw) != "" {
+		defaults, err := yaml.YAMLToJSON([]byte(raw))
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", clusterDefaultsKey, err)
+		}
+		if err := decodeStrict(defaults, &LibdnsConfig{}); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", clusterDefaultsKey, err)
+		}
+		cc.defaults = defaults
+	}
+
+	if raw := cm.Data[clusterPolicyKey]; strings.TrimSpace(raw) != "" {
+		policy, err := yaml.YAMLToJSON([]byte(raw))
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", clusterPolicyKey, err)
+		}
+		if err := decodeStrict(policy, &cc.policy); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", clusterPolicyKey, err)
+		}
+		if err := cc.policy.validate(); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", clusterPolicyKey, err)
+		}
+	}
+	return cc, nil
+}
+
+// decodeStrict decodes data into v, failing on unknown or duplicate fields
+func decodeStrict(data []byte, v any) error {
+	strictErrs, err := kjson.UnmarshalStrict(data, v)
+	if err != nil {
+		return err
+	}
+	return errors.Join(strictErrs...)
+}
+
+// validate checks that the policy's TTL range is consistent
+func (p *ClusterPolicy) validate() error {
+	errs := &configErrors{}
+	if p.MinTTL < 0 {
+		errs.addf("minTTL must not be negative, got %d", p.MinTTL)
+	}
+	if p.MaxTTL < 0 {
+		errs.addf("maxTTL must not be negative, got %d", p.MaxTTL)
+	}
+	if p.MaxTTL > 0 && p.MinTTL > p.MaxTTL {
+		errs.addf("minTTL (%d) exceeds maxTTL (%d)", p.MinTTL, p.MaxTTL)
+	}
+	return errs.err()
+}
+
+// check reports every provider and TTL in cfg that the policy does not allow.
+// Besides the configured TTLs, it checks the TTL each provider will actually
+// use once it is clamped to the provider's limits.
+func (p *ClusterPolicy) check(cfg *LibdnsConfig, registry *providers.Registry) error {
+	errs := &configErrors{}
+	ttl := cfg.TTL
+	if ttl == 0 {
+		ttl = defaultTTL
+	}
+	p.checkBackend(errs, registry, "", cfg.Provider, cfg.TTL, ttl)
+	p.checkBackends(errs, registry, "fallbacks", cfg.Fallbacks, ttl)
+	p.checkBackends(errs, registry, "mirrors", cfg.Mirrors, ttl)
+	for i, r := range cfg.Routes {
+		prefix := fmt.Sprintf("routes[%d].", i)
+		routeTTL := ttl
+		if r.TTL > 0 {
+			routeTTL = r.TTL
+		}
+		p.checkBackend(errs, registry, prefix, r.Provider, r.TTL, routeTTL)
+		p.checkBackends(errs, registry, prefix+"fallbacks", r.Fallbacks, routeTTL)
+		p.checkBackends(errs, registry, prefix+"mirrors", r.Mirrors, routeTTL)
+	}
+	return errs.errAs("config violates the cluster policy")
+}
+
+// checkBackends checks the provider and TTL of every backend under path;
+// backends without a TTL inherit inherited
+func (p *ClusterPolicy) checkBackends(errs *configErrors, registry *providers.Registry, path string, backends []BackendConfig, inherited int) {
+	for i, b := range backends {
+		effective := inherited
+		if b.TTL > 0 {
+			effective = b.TTL
+		}
+		p.checkBackend(errs, registry, fmt.Sprintf("%s[%d].", path, i), b.Provider, b.TTL, effective)
+	}
+}
+
+// checkBackend checks one provider and TTL; an empty provider is not used
+// and a zero TTL is inherited and checked where it is set. effective is the
+// TTL the backend uses, which is checked again once the provider clamps it.
+func (p *ClusterPolicy) checkBackend(errs *configErrors, registry *providers.Registry, path, provider string, ttl, effective int) {
+	if provider != "" && len(p.AllowedProviders) > 0 && !slices.Contains(p.AllowedProviders, provider) {
+		errs.addf("%sprovider %q is not allowed (allowed: %s)", path, provider, strings.Join(p.AllowedProviders, ", "))
+	}
+	if ttl != 0 {
+		if p.MinTTL > 0 && ttl < p.MinTTL {
+			errs.addf("%sttl (%d) is below the minimum of %d seconds", path, ttl, p.MinTTL)
+		}
+		if p.MaxTTL > 0 && ttl > p.MaxTTL {
+			errs.addf("%sttl (%d) exceeds the maximum of %d seconds", path, ttl, p.MaxTTL)
+		}
+	}
+	if provider == "" || registry == nil {
+		return
+	}
+	// An unknown provider is reported when it is created
+	descriptor, err := registry.Describe(provider)
+	if err != nil {
+		return
+	}
+	clamped := int(descriptor.ClampTTL(time.Duration(effective)*time.Second) / time.Second)
+	if clamped == effective {
+		return
+	}
+	if p.MinTTL > 0 && clamped < p.MinTTL {
+		errs.addf("%sttl (%d) is lowered to %d seconds by provider %s, below the minimum of %d seconds",
+			path, effective, clamped, provider, p.MinTTL)
+	}
+	if p.MaxTTL > 0 && clamped > p.MaxTTL {
+		errs.addf("%sttl (%d) is raised to %d seconds by provider %s, above the maximum of %d seconds",
+			path, effective, clamped, provider, p.MaxTTL)
+	}
+}
+
+// watchClusterConfig loads the defaults ConfigMap and keeps d up to date
+// until stopCh is closed. An invalid ConfigMap fails the start; later invalid
+// revisions are logged and the last valid one stays in effect. A missing
+// ConfigMap applies no defaults.
+func watchClusterConfig(client kubernetes.Interface, namespace, name string, d *clusterDefaults, stopCh <-chan struct{}) error {
+	factory := informers.NewSharedInformerFactoryWithOptions(client, 0,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+			opts.FieldSelector = fields.OneTermEqualSelector("metadata.name", name).String()
+		}),
+	)
+	configMaps := factory.Core().V1().ConfigMaps()
+
+	apply := func(obj any) {
+		cm, ok := obj.(*corev1.ConfigMap)
+		if !ok || cm.Name != name {
+			return
+		}
+		cc, err := parseClusterConfig(cm)
+		if err != nil {
+			klog.Errorf("Ignoring cluster defaults ConfigMap %s/%s revision %s: %v", namespace, name, cm.ResourceVersion, err)
+			return
+		}
+		d.current.Store(cc)
+		klog.Infof("Loaded cluster defaults ConfigMap %s/%s revision %s", namespace, name, cm.ResourceVersion)
+	}
+	if _, err := configMaps.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    apply,
+		UpdateFunc: func(_, obj any) { apply(obj) },
+		DeleteFunc: func(obj any) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if cm, ok := obj.(*corev1.ConfigMap); ok && cm.Name == name {
+				d.current.Store(nil)
+				klog.Infof("Cluster defaults ConfigMap %s/%s deleted; no defaults apply", namespace, name)
+			}
+		},
+	}); err != nil {
+		return fmt.Errorf("failed to watch cluster defaults: %w", err)
+	}
+
+	factory.Start(stopCh)
+	if !cache.WaitForCacheSync(stopCh, configMaps.Informer().HasSynced) {
+		return fmt.Errorf("failed to sync cluster defaults ConfigMap %s/%s", namespace, name)
+	}
+
+	// Refuse to start with a broken policy rather than silently enforcing none
+	cm, err := configMaps.Lister().ConfigMaps(namespace).Get(name)
+	if err != nil {
+		klog.Infof("Cluster defaults ConfigMap %s/%s not found; no defaults apply", namespace, name)
+		return nil
+	}
+	if _, err := parseClusterConfig(cm); err != nil {
+		return fmt.Errorf("invalid cluster defaults ConfigMap %s/%s: %w", namespace, name, err)
+	}
+	return nil
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/cert-manager-webhook-libdns/providers"
+)
+
+func clusterConfigMap(defaults, policy string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "libdns-defaults", Namespace: "cert-manager"},
+		Data:       map[string]string{clusterDefaultsKey: defaults, clusterPolicyKey: policy},
+	}
+}
+
+// clusterTestSolver returns a solver with the cluster config parsed from defaults and policy
+func clusterTestSolver(t *testing.T, defaults, policy string) *libdnsSolver {
+	t.Helper()
+	cc, err := parseClusterConfig(clusterConfigMap(defaults, policy))
+	if err != nil {
+		t.Fatalf("parseClusterConfig failed: %v", err)
+	}
+	solver := &libdnsSolver{}
+	solver.cluster.current.Store(cc)
+	return solver
+}
+
+// waitForClusterConfig polls until cond holds for the current cluster config
+func waitForClusterConfig(t *testing.T, d *clusterDefaults, cond func(*clusterConfig) bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond(d.load()) {
+		if time.Now().After(deadline) {
+			t.Fatalf("cluster config did not reach the expected state, got %+v", d.load())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestClusterDefaultsApplyBeneathIssuerConfig(t *testing.T) {
+	solver := clusterTestSolver(t, `
+ttl: 600
+timeouts:
+  call: 10s
+retry:
+  maxAttempts: 2
+options:
+  region: eu-central-1
+`, "")
+
+	ch := &v1alpha1.ChallengeRequest{
+		ResolvedFQDN: "_acme-challenge.example.com.",
+		Config: routesConfigJSON(t, LibdnsConfig{
+			Provider:  "route53",
+			SecretRef: SecretReference{Name: "aws"},
+			TTL:       120,
+			Timeouts:  &TimeoutsConfig{Operation: duration(time.Minute)},
+			Options:   map[string]string{"endpoint": "http://localhost"},
+		}),
+	}
+	_, cfg, err := solver.challengeConfig(ch)
+	if err != nil {
+		t.Fatalf("challengeConfig failed: %v", err)
+	}
+
+	if cfg.TTL != 120 {
+		t.Errorf("expected the issuer TTL to win, got %d", cfg.TTL)
+	}
+	if cfg.Timeouts.Call.Duration != 10*time.Second || cfg.Timeouts.Operation.Duration != time.Minute {
+		t.Errorf("expected timeouts merged from defaults and issuer, got %+v", cfg.Timeouts)
+	}
+	if cfg.Retry == nil || cfg.Retry.MaxAttempts != 2 {
+		t.Errorf("expected the default retry policy, got %+v", cfg.Retry)
+	}
+	if cfg.Options["region"] != "eu-central-1" || cfg.Options["endpoint"] != "http://localhost" {
+		t.Errorf("expected options merged from defaults and issuer, got %v", cfg.Options)
+	}
+}
+
+func TestClusterPolicyRejectsConfigs(t *testing.T) {
+	solver := clusterTestSolver(t, "", `
+allowedProviders: [cloudflare, route53]
+minTTL: 60
+maxTTL: 3600
+`)
+
+	tests := []struct {
+		name     string
+		cfg      LibdnsConfig
+		wantErrs []string
+	}{
+		{
+			name: "allowed",
+			cfg:  LibdnsConfig{Provider: "cloudflare", SecretRef: SecretReference{Name: "cf"}, TTL: 60},
+		},
+		{
+			name:     "disallowed provider",
+			cfg:      LibdnsConfig{Provider: "desec", SecretRef: SecretReference{Name: "desec"}},
+			wantErrs: []string{`provider "desec" is not allowed (allowed: cloudflare, route53)`},
+		},
+		{
+			name: "route, fallback and ttl",
+			cfg: LibdnsConfig{
+				Provider: "cloudflare", SecretRef: SecretReference{Name: "cf"}, TTL: 30,
+				Fallbacks: []BackendConfig{{Provider: "ovh", SecretRef: SecretReference{Name: "ovh"}}},
+				Routes: []RouteConfig{{
+					Domain: "example.org", Provider: "hetzner", SecretRef: SecretReference{Name: "hetzner"}, TTL: 7200,
+				}},
+			},
+			wantErrs: []string{
+				"config violates the cluster policy (4 problems)",
+				"ttl (30) is below the minimum of 60 seconds",
+				`fallbacks[0].provider "ovh" is not allowed`,
+				`routes[0].provider "hetzner" is not allowed`,
+				"routes[0].ttl (7200) exceeds the maximum of 3600 seconds",
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ch := &v1alpha1.ChallengeRequest{ResolvedFQDN: "_acme-challenge.example.com.", Config: routesConfigJSON(t, tc.cfg)}
+			_, _, err := solver.challengeConfig(ch)
+			if len(tc.wantErrs) == 0 {
+				if err != nil {
+					t.Fatalf("expected the config to be allowed, got %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected errors %q, got none", tc.wantErrs)
+			}
+			for _, want := range tc.wantErrs {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("expected error containing %q, got %v", want, err)
+				}
+			}
+		})
+	}
+}
+
+func TestClusterPolicyChecksTTLAfterProviderClamp(t *testing.T) {
+	solver := clusterTestSolver(t, "", `
+minTTL: 60
+maxTTL: 600
+`)
+	solver.registry = providers.NewRegistry()
+	providers.RegisterWith(solver.registry, "slow", func(providers.ProviderConfig) (*mockProvider, error) {
+		return &mockProvider{}, nil
+	}, providers.Descriptor{MinTTL: time.Hour})
+	providers.RegisterWith(solver.registry, "fast", func(providers.ProviderConfig) (*mockProvider, error) {
+		return &mockProvider{}, nil
+	}, providers.Descriptor{MaxTTL: 30 * time.Second})
+
+	tests := []struct {
+		name     string
+		cfg      LibdnsConfig
+		wantErrs []string
+	}{
+		{
+			name: "configured ttl raised above the maximum",
+			cfg:  LibdnsConfig{Provider: "slow", SecretRef: SecretReference{Name: "slow"}, TTL: 300},
+			wantErrs: []string{
+				"ttl (300) is raised to 3600 seconds by provider slow, above the maximum of 600 seconds",
+			},
+		},
+		{
+			name: "inherited ttl raised for a mirror",
+			cfg: LibdnsConfig{
+				Provider: "cloudflare", SecretRef: SecretReference{Name: "cf"}, TTL: 120,
+				Mirrors: []BackendConfig{{Provider: "slow", SecretRef: SecretReference{Name: "slow"}}},
+			},
+			wantErrs: []string{
+				"mirrors[0].ttl (120) is raised to 3600 seconds by provider slow, above the maximum of 600 seconds",
+			},
+		},
+		{
+			name: "inherited ttl lowered for a fallback",
+			cfg: LibdnsConfig{
+				Provider: "cloudflare", SecretRef: SecretReference{Name: "cf"}, TTL: 120,
+				Fallbacks: []BackendConfig{{Provider: "fast", SecretRef: SecretReference{Name: "fast"}}},
+			},
+			wantErrs: []string{
+				"fallbacks[0].ttl (120) is lowered to 30 seconds by provider fast, below the minimum of 60 seconds",
+			},
+		},
+		{
+			name: "route ttl raised above the maximum",
+			cfg: LibdnsConfig{
+				Routes: []RouteConfig{{Domain: "example.com", Provider: "slow", SecretRef: SecretReference{Name: "slow"}}},
+			},
+			wantErrs: []string{
+				fmt.Sprintf("routes[0].ttl (%d) is raised to 3600 seconds by provider slow", defaultTTL),
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ch := &v1alpha1.ChallengeRequest{ResolvedFQDN: "_acme-challenge.example.com.", Config: routesConfigJSON(t, tc.cfg)}
+			_, _, err := solver.challengeConfig(ch)
+			if err == nil {
+				t.Fatalf("expected errors %q, got none", tc.wantErrs)
+			}
+			for _, want := range tc.wantErrs {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("expected error containing %q, got %v", want, err)
+				}
+			}
+		})
+	}
+}
+
+func TestParseClusterConfigRejectsInvalidContent(t *testing.T) {
+	tests := []struct {
+		name     string
+		defaults string
+		policy   string
+		wantErr  string
+	}{
+		{name: "unknown default", defaults: "tll: 600", wantErr: `invalid defaults: unknown field "tll"`},
+		{name: "unknown policy field", policy: "allowProviders: [desec]", wantErr: `invalid policy: unknown field "allowProviders"`},
+		{name: "inverted ttl range", policy: "minTTL: 600\nmaxTTL: 60", wantErr: "minTTL (600) exceeds maxTTL (60)"},
+		{name: "malformed yaml", defaults: "ttl: [", wantErr: "invalid defaults"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := parseClusterConfig(clusterConfigMap(tc.defaults, tc.policy))
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestWatchClusterConfigReloads(t *testing.T) {
+	client := fake.NewSimpleClientset(clusterConfigMap("ttl: 600", "maxTTL: 3600"))
+	stopCh := make(chan struct{})
+	t.Cleanup(func() { close(stopCh) })
+
+	var d clusterDefaults
+	if err := watchClusterConfig(client, "cert-manager", "libdns-defaults", &d, stopCh); err != nil {
+		t.Fatalf("watchClusterConfig failed: %v", err)
+	}
+	waitForClusterConfig(t, &d, func(cc *clusterConfig) bool { return cc != nil && cc.policy.MaxTTL == 3600 })
+
+	configMaps := client.CoreV1().ConfigMaps("cert-manager")
+	ctx := context.Background()
+	if _, err := configMaps.Update(ctx, clusterConfigMap("ttl: 600", "maxTTL: 900"), metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("failed to update ConfigMap: %v", err)
+	}
+	waitForClusterConfig(t, &d, func(cc *clusterConfig) bool { return cc != nil && cc.policy.MaxTTL == 900 })
+
+	// An invalid revision keeps the last valid one in effect
+	if _, err := configMaps.Update(ctx, clusterConfigMap("ttl: 600", "maxTTL: -1"), metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("failed to update ConfigMap: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if cc := d.load(); cc == nil || cc.policy.MaxTTL != 900 {
+		t.Fatalf("expected the last valid policy to stay in effect, got %+v", cc)
+	}
+
+	if err := configMaps.Delete(ctx, "libdns-defaults", metav1.DeleteOptions{}); err != nil {
+		t.Fatalf("failed to delete ConfigMap: %v", err)
+	}
+	waitForClusterConfig(t, &d, func(cc *clusterConfig) bool { return cc == nil })
+}
+
+func TestWatchClusterConfigRejectsInvalidConfigMapAtStart(t *testing.T) {
+	client := fake.NewSimpleClientset(clusterConfigMap("", "allowedProviders: desec"))
+	stopCh := make(chan struct{})
+	t.Cleanup(func() { close(stopCh) })
+
+	var d clusterDefaults
+	err := watchClusterConfig(client, "cert-manager", "libdns-defaults", &d, stopCh)
+	if err == nil || !strings.Contains(err.Error(), "invalid cluster defaults ConfigMap cert-manager/libdns-defaults") {
+		t.Fatalf("expected an invalid ConfigMap error, got %v", err)
+	}
+}
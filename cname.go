@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"github.com/miekg/dns"
+	"k8s.io/klog/v2"
+)
+
+// defaultCNAMEMaxDepth bounds the CNAME chains followed by default
+const defaultCNAMEMaxDepth = 10
+
+// CNAMEConfig makes the solver follow CNAME chains from the challenge FQDN and
+// write the record at the end of the chain, e.g. for _acme-challenge names
+// delegated to a zone at another provider
+type CNAMEConfig struct {
+	// Resolvers are used for the CNAME and zone lookups (host or host:port, default: /etc/resolv.conf)
+	Resolvers []string `json:"resolvers,omitempty"`
+
+	// MaxDepth is the maximum number of CNAMEs followed (default: 10)
+	MaxDepth int `json:"maxDepth,omitempty"`
+}
+
+// validate checks the CNAME settings; a nil config is valid
+func (c *CNAMEConfig) validate(errs *configErrors) {
+	if c != nil && c.MaxDepth < 0 {
+		errs.addf("followCNAME.maxDepth must not be negative, got %d", c.MaxDepth)
+	}
+}
+
+// maxDepth returns the configured maximum chain length or the default
+func (c *CNAMEConfig) maxDepth() int {
+	if c.MaxDepth > 0 {
+		return c.MaxDepth
+	}
+	return defaultCNAMEMaxDepth
+}
+
+// followChallengeCNAME returns ch redirected to the end of the CNAME chain at
+// its FQDN, or ch itself if there is no CNAME
+func (s *libdnsSolver) followChallengeCNAME(ch *v1alpha1.ChallengeRequest, cfg *LibdnsConfig) (*v1alpha1.ChallengeRequest, error) {
+	ctx, cancel := context.WithTimeout(s.baseContext(), newTimeouts(cfg.Timeouts).call)
+	defer cancel()
+
+	target, zone, err := followCNAME(ctx, cfg.FollowCNAME, ch.ResolvedFQDN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to follow CNAMEs of %s: %w", ch.ResolvedFQDN, err)
+	}
+	if zone == "" {
+		return ch, nil
+	}
+
+	klog.Infof("Following CNAME %s -> %s in zone %s", ch.ResolvedFQDN, target, zone)
+	redirected := *ch
+	redirected.ResolvedFQDN = target
+	redirected.ResolvedZone = zone
+	return &redirected, nil
+}
+
+// followCNAME resolves the CNAME chain starting at fqdn and returns the name
+// at its end and the zone containing it. The zone is empty if fqdn is not a
+// CNAME.
+func followCNAME(ctx context.Context, cfg *CNAMEConfig, fqdn string) (string, string, error) {
+	resolvers, err := resolversOrDefault(cfg.Resolvers)
+	if err != nil {
+		return "", "", err
+	}
+
+	name := dns.Fqdn(fqdn)
+	seen := map[string]bool{strings.ToLower(name): true}
+	for depth := 0; ; depth++ {
+		next, err := lookupCNAME(ctx, resolvers, name)
+		if err != nil {
+			return "", "", err
+		}
+		if next == "" {
+			break
+		}
+		if depth == cfg.maxDepth() {
+			return "", "", fmt.Errorf("CNAME chain is longer than %d", cfg.maxDepth())
+		}
+		if seen[strings.ToLower(next)] {
+			return "", "", fmt.Errorf("CNAME loop at %s", next)
+		}
+		seen[strings.ToLower(next)] = true
+		klog.V(2).Infof("CNAME %s -> %s", name, next)
+		name = next
+	}
+	if name == dns.Fqdn(fqdn) {
+		return name, "", nil
+	}
+
+	zone, err := findZone(ctx, resolvers, name)
+	if err != nil {
+		return "", "", err
+	}
+	return name, zone, nil
+}
+
+// lookupCNAME returns the target of the CNAME at name, or "" if there is none
+func lookupCNAME(ctx context.Context, resolvers []string, name string) (string, error) {
+	msg, err := queryResolvers(ctx, resolvers, name, dns.TypeCNAME)
+	if err != nil {
+		return "", err
+	}
+	for _, rr := range msg.Answer {
+		if cname, ok := rr.(*dns.CNAME); ok && strings.EqualFold(cname.Hdr.Name, name) {
+			return dns.Fqdn(cname.Target), nil
+		}
+	}
+	return "", nil
+}
+
+// findZone returns the closest enclosing name of fqdn that has an SOA record
+func findZone(ctx context.Context, resolvers []string, fqdn string) (string, error) {
+	labels := dns.SplitDomainName(fqdn)
+	for i := range labels {
+		name := dns.Fqdn(strings.Join(labels[i:], "."))
+		msg, err := queryResolvers(ctx, resolvers, name, dns.TypeSOA)
+		if err != nil {
+			return "", err
+		}
+		for _, rr := range msg.Answer {
+			if soa, ok := rr.(*dns.SOA); ok && strings.EqualFold(soa.Hdr.Name, name) {
+				return name, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no zone found for %s", fqdn)
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/cert-manager-webhook-libdns/providers"
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"github.com/miekg/dns"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// cnameAnswers serves the CNAMEs in cnames and an SOA record for each zone
+func cnameAnswers(cnames map[string]string, zones ...string) func(q dns.Question) []dns.RR {
+	return func(q dns.Question) []dns.RR {
+		hdr := dns.RR_Header{Name: q.Name, Rrtype: q.Qtype, Class: dns.ClassINET, Ttl: 60}
+		switch q.Qtype {
+		case dns.TypeCNAME:
+			if target, ok := cnames[q.Name]; ok {
+				return []dns.RR{&dns.CNAME{Hdr: hdr, Target: target}}
+			}
+		case dns.TypeSOA:
+			for _, zone := range zones {
+				if q.Name == zone {
+					return []dns.RR{&dns.SOA{Hdr: hdr, Ns: "ns1." + zone, Mbox: "hostmaster." + zone, Serial: 1}}
+				}
+			}
+		}
+		return nil
+	}
+}
+
+func TestFollowCNAME(t *testing.T) {
+	port := startTestDNSServer(t, cnameAnswers(map[string]string{
+		"_acme-challenge.customer.com.": "customer.acme.ourzone.net.",
+		"_acme-challenge.chained.com.":  "hop.other.org.",
+		"hop.other.org.":                "chained.acme.ourzone.net.",
+		"_acme-challenge.loop.com.":     "a.loop.com.",
+		"a.loop.com.":                   "_acme-challenge.loop.com.",
+	}, "ourzone.net.", "example.com."))
+	cfg := &CNAMEConfig{Resolvers: []string{"127.0.0.1:" + strconv.Itoa(port)}}
+
+	tests := []struct {
+		name       string
+		fqdn       string
+		maxDepth   int
+		wantTarget string
+		wantZone   string
+		wantErr    string
+	}{
+		{name: "no cname", fqdn: "_acme-challenge.example.com.", wantTarget: "_acme-challenge.example.com."},
+		{name: "single cname", fqdn: "_acme-challenge.customer.com.", wantTarget: "customer.acme.ourzone.net.", wantZone: "ourzone.net."},
+		{name: "chain", fqdn: "_acme-challenge.chained.com.", wantTarget: "chained.acme.ourzone.net.", wantZone: "ourzone.net."},
+		{name: "chain too long", fqdn: "_acme-challenge.chained.com.", maxDepth: 1, wantErr: "CNAME chain is longer than 1"},
+		{name: "loop", fqdn: "_acme-challenge.loop.com.", wantErr: "CNAME loop at _acme-challenge.loop.com."},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := *cfg
+			c.MaxDepth = tc.maxDepth
+			target, zone, err := followCNAME(context.Background(), &c, tc.fqdn)
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("followCNAME failed: %v", err)
+			}
+			if target != tc.wantTarget || zone != tc.wantZone {
+				t.Fatalf("followCNAME(%s) = %s in %q, want %s in %q", tc.fqdn, target, zone, tc.wantTarget, tc.wantZone)
+			}
+		})
+	}
+}
+
+func TestPresentAndCleanUpFollowCNAMEToRoutedZone(t *testing.T) {
+	port := startTestDNSServer(t, cnameAnswers(map[string]string{
+		"_acme-challenge.customer.com.": "customer.acme.ourzone.net.",
+	}, "ourzone.net."))
+
+	customerMock, ourzoneMock := &mockProvider{}, &mockProvider{}
+	customerName := "customer"
+	ourzoneName := "ourzone"
+	registry := providers.NewRegistry()
+	registerMockProvider(t, registry, customerName, customerMock)
+	registerMockProvider(t, registry, ourzoneName, ourzoneMock)
+
+	secret := func(name string) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "cert-manager"},
+			Data:       map[string][]byte{"api_token": []byte(name)},
+		}
+	}
+	solver := &libdnsSolver{client: fake.NewSimpleClientset(secret("customer-creds"), secret("ourzone-creds")), registry: registry}
+
+	ch := &v1alpha1.ChallengeRequest{
+		ResolvedFQDN:      "_acme-challenge.customer.com.",
+		ResolvedZone:      "customer.com.",
+		Key:               "delegated-key",
+		ResourceNamespace: "cert-manager",
+		Config: routesConfigJSON(t, LibdnsConfig{
+			Provider:    customerName,
+			SecretRef:   SecretReference{Name: "customer-creds"},
+			FollowCNAME: &CNAMEConfig{Resolvers: []string{"127.0.0.1:" + strconv.Itoa(port)}},
+			Routes: []RouteConfig{
+				{Domain: "ourzone.net", Provider: ourzoneName, SecretRef: SecretReference{Name: "ourzone-creds"}},
+			},
+		}),
+	}
+
+	if err := solver.Present(ch); err != nil {
+		t.Fatalf("Present failed: %v", err)
+	}
+	if values := txtValuesForName(ourzoneMock.records, "customer.acme"); len(values) != 1 || values[0] != "delegated-key" {
+		t.Fatalf("expected the CNAME target to receive [delegated-key], got %v", ourzoneMock.records)
+	}
+	if ourzoneMock.lastZoneSeen != "ourzone.net" {
+		t.Fatalf("expected the target zone ourzone.net, got %q", ourzoneMock.lastZoneSeen)
+	}
+	if len(customerMock.records) != 0 || customerMock.setCalls != 0 {
+		t.Fatalf("expected the customer's provider to be untouched, got %v", customerMock.records)
+	}
+
+	if err := solver.CleanUp(ch); err != nil {
+		t.Fatalf("CleanUp failed: %v", err)
+	}
+	if values := txtValuesForName(ourzoneMock.records, "customer.acme"); len(values) != 0 {
+		t.Fatalf("expected the CNAME target record to be removed, got %v", values)
+	}
+}
+
+func TestLoadConfigValidatesFollowCNAME(t *testing.T) {
+	_, err := loadConfig(routesConfigJSON(t, LibdnsConfig{
+		Provider:    "desec",
+		SecretRef:   SecretReference{Name: "desec"},
+		FollowCNAME: &CNAMEConfig{MaxDepth: -1},
+	}))
+	if err == nil || !strings.Contains(err.Error(), "followCNAME.maxDepth must not be negative") {
+		t.Fatalf("expected a maxDepth error, got %v", err)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+
+	"github.com/cert-manager-webhook-libdns/providers"
+)
+
+// validateSecretRefs checks the name and key mapping of secretRef and that
+// every further Secret under path+"secretRefs" has a valid name and mapping
+func validateSecretRefs(errs *configErrors, path string, secretRef SecretReference, secretRefs []SecretReference) {
+	validateObjectRef(errs, path+"secretRef", secretRef.Name, secretRef.Namespace)
+	validateSecretKeys(errs, path+"secretRef", secretRef.Keys)
+	for i, ref := range secretRefs {
+		refPath := fmt.Sprintf("%ssecretRefs[%d]", path, i)
+		if ref.Name == "" {
+			errs.addf("%s.name is required", refPath)
+		}
+		validateObjectRef(errs, refPath, ref.Name, ref.Namespace)
+		validateSecretKeys(errs, refPath, ref.Keys)
+	}
+}
+
+// validateSecretKeys checks that a key mapping has no empty names
+func validateSecretKeys(errs *configErrors, path string, keys map[string]string) {
+	for _, credential := range slices.Sorted(maps.Keys(keys)) {
+		if credential == "" {
+			errs.addf("%s.keys must not contain an empty credential name", path)
+		} else if keys[credential] == "" {
+			errs.addf("%s.keys[%q] must name a key of the Secret", path, credential)
+		}
+	}
+}
+
+// unknownKeys returns the credentials and settings the provider does not
+// read, most likely misspelled keys, as "credential NAME" or "setting NAME".
+// Providers that describe no keys or pass them through accept anything.
+func unknownKeys(descriptor providers.Descriptor, credentials, settings map[string]string) []string {
+	known := descriptor.Keys()
+	if len(known) == 0 || descriptor.Passthrough {
+		return nil
+	}
+	var unknown []string
+	for _, key := range slices.Sorted(maps.Keys(credentials)) {
+		if !slices.Contains(known, key) {
+			unknown = append(unknown, fmt.Sprintf("credential %q", key))
+		}
+	}
+	for _, key := range slices.Sorted(maps.Keys(settings)) {
+		if !slices.Contains(known, key) {
+			unknown = append(unknown, fmt.Sprintf("setting %q", key))
+		}
+	}
+	return unknown
+}
+
+// mergeCredentials adds the credentials of secret to credentials. Without a
+// key mapping every data key is taken as is; with one, only the mapped keys
+// are taken, under their credential names.
+func mergeCredentials(credentials map[string]string, secret *corev1.Secret, keys map[string]string) error {
+	if len(keys) == 0 {
+		for key, value := range secret.Data {
+			credentials[key] = string(value)
+		}
+		return nil
+	}
+
+	for credential, key := range keys {
+		value, ok := secret.Data[key]
+		if !ok {
+			return fmt.Errorf("secret %s/%s has no key %q for credential %s", secret.Namespace, secret.Name, key, credential)
+		}
+		credentials[credential] = string(value)
+	}
+	return nil
+}
+
+// secretSourceID identifies a Secret and the key mapping applied to it, so
+// that providers built from different mappings are cached apart
+func secretSourceID(secret *corev1.Secret, keys map[string]string) string {
+	mapping := make([]string, 0, len(keys))
+	for credential, key := range keys {
+		mapping = append(mapping, strconv.Quote(credential)+"="+strconv.Quote(key))
+	}
+	sort.Strings(mapping)
+	return secret.Namespace + "/" + secret.Name + "/" + string(secret.UID) + "{" + strings.Join(mapping, ",") + "}"
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cert-manager-webhook-libdns/providers"
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// registerCredentialRecorder registers a provider that records the
+// credentials of every provider it creates
+func registerCredentialRecorder(t *testing.T, registry *providers.Registry, name string) func() []map[string]string {
+	t.Helper()
+	var mu sync.Mutex
+	var created []map[string]string
+	providers.RegisterWith(registry, name, func(config providers.ProviderConfig) (*mockProvider, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		created = append(created, maps.Clone(config.Credentials))
+		return &mockProvider{}, nil
+	}, providers.Descriptor{})
+	return func() []map[string]string {
+		mu.Lock()
+		defer mu.Unlock()
+		return created
+	}
+}
+
+func credentialsTestClient() *fake.Clientset {
+	secret := func(name string, data map[string]string) *corev1.Secret {
+		s := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "cert-manager", UID: types.UID("uid-" + name), ResourceVersion: "1"},
+			Data:       map[string][]byte{},
+		}
+		for k, v := range data {
+			s.Data[k] = []byte(v)
+		}
+		return s
+	}
+	return fake.NewSimpleClientset(
+		secret("external-dns", map[string]string{"AWS_ACCESS_KEY_ID": "AKIA", "AWS_SECRET_ACCESS_KEY": "secret", "unrelated": "x"}),
+		secret("aws-region", map[string]string{"region": "eu-central-1"}),
+	)
+}
+
+func TestLoadCredentialsRemapsKeys(t *testing.T) {
+	providerName := "mock"
+	registry := providers.NewRegistry()
+	created := registerCredentialRecorder(t, registry, providerName)
+	solver := &libdnsSolver{client: credentialsTestClient(), registry: registry}
+
+	ch := &v1alpha1.ChallengeRequest{
+		ResolvedFQDN:      "_acme-challenge.example.com.",
+		ResolvedZone:      "example.com.",
+		Key:               "value",
+		ResourceNamespace: "cert-manager",
+		Config: routesConfigJSON(t, LibdnsConfig{
+			Provider: providerName,
+			SecretRef: SecretReference{Name: "external-dns", Keys: map[string]string{
+				"access_key_id":     "AWS_ACCESS_KEY_ID",
+				"secret_access_key": "AWS_SECRET_ACCESS_KEY",
+			}},
+			SecretRefs: []SecretReference{{Name: "aws-region"}},
+		}),
+	}
+	if err := solver.Present(ch); err != nil {
+		t.Fatalf("Present failed: %v", err)
+	}
+
+	got := created()
+	want := map[string]string{"access_key_id": "AKIA", "secret_access_key": "secret", "region": "eu-central-1"}
+	if len(got) != 1 || !maps.Equal(got[0], want) {
+		t.Fatalf("expected credentials %v, got %v", want, got)
+	}
+}
+
+func TestLoadCredentialsCachesProvidersPerKeyMapping(t *testing.T) {
+	providerName := "mock"
+	registry := providers.NewRegistry()
+	created := registerCredentialRecorder(t, registry, providerName)
+	solver := &libdnsSolver{client: credentialsTestClient(), registry: registry}
+
+	for _, key := range []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_ACCESS_KEY_ID"} {
+		ch := &v1alpha1.ChallengeRequest{
+			ResolvedFQDN:      "_acme-challenge.example.com.",
+			ResolvedZone:      "example.com.",
+			ResourceNamespace: "cert-manager",
+			Config: routesConfigJSON(t, LibdnsConfig{
+				Provider:  providerName,
+				SecretRef: SecretReference{Name: "external-dns", Keys: map[string]string{"api_token": key}},
+			}),
+		}
+		if _, err := solver.getProvider(ch); err != nil {
+			t.Fatalf("getProvider failed: %v", err)
+		}
+	}
+
+	// The same Secret under two mappings yields two providers, each reused
+	got := created()
+	if len(got) != 2 || got[0]["api_token"] != "AKIA" || got[1]["api_token"] != "secret" {
+		t.Fatalf("expected one provider per key mapping, got %v", got)
+	}
+}
+
+func TestLoadCredentialsReportsMissingMappedKey(t *testing.T) {
+	providerName := "mock"
+	registry := providers.NewRegistry()
+	registerCredentialRecorder(t, registry, providerName)
+	solver := &libdnsSolver{client: credentialsTestClient(), registry: registry}
+
+	ch := &v1alpha1.ChallengeRequest{
+		ResolvedFQDN:      "_acme-challenge.example.com.",
+		ResolvedZone:      "example.com.",
+		ResourceNamespace: "cert-manager",
+		Config: routesConfigJSON(t, LibdnsConfig{
+			Provider:  providerName,
+			SecretRef: SecretReference{Name: "external-dns", Keys: map[string]string{"api_token": "CF_API_TOKEN"}},
+		}),
+	}
+	_, err := solver.getProvider(ch)
+	if err == nil || !strings.Contains(err.Error(), `secret cert-manager/external-dns has no key "CF_API_TOKEN" for credential api_token`) {
+		t.Fatalf("expected a missing key error, got %v", err)
+	}
+}
+
+func TestLoadConfigValidatesSecretRefs(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     LibdnsConfig
+		wantErr string
+	}{
+		{
+			name:    "empty mapped key",
+			cfg:     LibdnsConfig{Provider: "desec", SecretRef: SecretReference{Name: "desec", Keys: map[string]string{"token": ""}}},
+			wantErr: `secretRef.keys["token"] must name a key of the Secret`,
+		},
+		{
+			name:    "further secret without name",
+			cfg:     LibdnsConfig{Provider: "desec", SecretRef: SecretReference{Name: "desec"}, SecretRefs: []SecretReference{{}}},
+			wantErr: "secretRefs[0].name is required",
+		},
+		{
+			name: "route secret mapping",
+			cfg: LibdnsConfig{Routes: []RouteConfig{{
+				Domain: "example.com", Provider: "desec",
+				SecretRef: SecretReference{Name: "desec", Keys: map[string]string{"": "TOKEN"}},
+			}}},
+			wantErr: "routes[0].secretRef.keys must not contain an empty credential name",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := loadConfig(routesConfigJSON(t, tc.cfg))
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestUnknownKeysFlagsLikelyTypos(t *testing.T) {
+	requireProvider(t, "route53")
+	descriptor, err := providers.Describe("route53")
+	if err != nil {
+		t.Fatalf("Describe failed: %v", err)
+	}
+
+	got := unknownKeys(descriptor,
+		map[string]string{"access_key_id": "AKIA", "secret_acess_key": "secret", "region": "eu-central-1"},
+		map[string]string{"regoin": "eu-west-1"},
+	)
+	want := []string{`credential "secret_acess_key"`, `setting "regoin"`}
+	if !slices.Equal(got, want) {
+		t.Fatalf("expected unknown keys %v, got %v", want, got)
+	}
+
+	if got := unknownKeys(providers.Descriptor{}, map[string]string{"anything": "x"}, nil); len(got) != 0 {
+		t.Fatalf("expected providers without described keys to accept anything, got %v", got)
+	}
+	passthrough := providers.Descriptor{OptionalSettings: []providers.Key{{Name: "plugin_name"}}, Passthrough: true}
+	if got := unknownKeys(passthrough, map[string]string{"api_token": "x"}, map[string]string{"zone_id": "1"}); len(got) != 0 {
+		t.Fatalf("expected passthrough providers to accept anything, got %v", got)
+	}
+}
@@ -86,3 +86,14 @@ Serving certificate name
 {{- define "libdns-webhook.servingCertificate" -}}
 {{ include "libdns-webhook.fullname" . }}-tls
 {{- end }}
+
+{{/*
+Namespaces whose Secrets the webhook caches, comma-separated; "*" means all
+*/}}
+{{- define "libdns-webhook.secretNamespaces" -}}
+{{- if .Values.secretInformer.namespaces -}}
+{{ join "," .Values.secretInformer.namespaces }}
+{{- else -}}
+{{ .Values.certManager.namespace }}
+{{- end -}}
+{{- end }}
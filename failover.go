@@ -0,0 +1,118 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"k8s.io/klog/v2"
+)
+
+// BackendConfig is a further provider account serving the same zone, used as
+// a fallback or a mirror of the primary provider
+type BackendConfig struct {
+	// Provider is the name of the DNS provider
+	Provider string `json:"provider"`
+
+	// SecretRef references the Secret with this provider's credentials
+	SecretRef SecretReference `json:"secretRef"`
+
+	// SecretRefs are further Secrets whose credentials are added to those of SecretRef
+	SecretRefs []SecretReference `json:"secretRefs,omitempty"`
+
+	// Options are non-secret settings for this provider
+	Options map[string]string `json:"options,omitempty"`
+
+	// ConfigMapRef references a ConfigMap with settings for this provider
+	ConfigMapRef *ConfigMapReference `json:"configMapRef,omitempty"`
+
+	// Zone optionally overrides the zone determined by cert-manager
+	Zone string `json:"zone,omitempty"`
+
+	// TTL is the DNS record TTL in seconds (default: the primary's ttl)
+	TTL int `json:"ttl,omitempty"`
+}
+
+// validateBackends checks that every backend names a provider and Secret
+// and has a valid zone and TTL
+func validateBackends(errs *configErrors, path string, backends []BackendConfig) {
+	for i, b := range backends {
+		prefix := fmt.Sprintf("%s[%d].", path, i)
+		if b.Provider == "" {
+			errs.addf("%sprovider is required", prefix)
+		}
+		if b.SecretRef.Name == "" {
+			errs.addf("%ssecretRef.name is required", prefix)
+		}
+		validateSecretRefs(errs, prefix, b.SecretRef, b.SecretRefs)
+		validateSettings(errs, prefix, b.Options, b.ConfigMapRef)
+		validateZone(errs, prefix, b.Zone)
+		validateTTL(errs, prefix, b.TTL)
+	}
+}
+
+// backends returns the primary configuration followed by one per fallback
+func (cfg *LibdnsConfig) backends() []*LibdnsConfig {
+	backends := []*LibdnsConfig{cfg}
+	for _, f := range cfg.Fallbacks {
+		backends = append(backends, cfg.withBackend(f))
+	}
+	return backends
+}
+
+// withBackend returns a copy of cfg that uses backend instead of the primary
+// provider and has neither fallbacks nor mirrors
+func (cfg *LibdnsConfig) withBackend(backend BackendConfig) *LibdnsConfig {
+	b := *cfg
+	b.Fallbacks, b.Mirrors = nil, nil
+	b.Provider = backend.Provider
+	b.SecretRef = backend.SecretRef
+	b.SecretRefs = backend.SecretRefs
+	b.Options = backend.Options
+	b.ConfigMapRef = backend.ConfigMapRef
+	b.Zone = backend.Zone
+	if backend.TTL > 0 {
+		b.TTL = backend.TTL
+	}
+	return &b
+}
+
+// backendID identifies a provider account across restarts and config edits
+func backendID(ch *v1alpha1.ChallengeRequest, cfg *LibdnsConfig) string {
+	namespace := cfg.SecretRef.Namespace
+	if namespace == "" {
+		namespace = ch.ResourceNamespace
+	}
+	return cfg.Provider + "|" + namespace + "/" + cfg.SecretRef.Name
+}
+
+// withFailover runs op against each backend in order until one succeeds or
+// fails with an error that another account would not fix. It returns the
+// target op succeeded on.
+func (s *libdnsSolver) withFailover(ch *v1alpha1.ChallengeRequest, backends []*LibdnsConfig, op func(*challengeTarget) error) (*challengeTarget, error) {
+	var errs []error
+	for i, backend := range backends {
+		target, err := s.buildTarget(ch, backend)
+		if err == nil {
+			err = op(target)
+			if err == nil {
+				return target, nil
+			}
+		} else {
+			err = fmt.Errorf("failed to get provider: %w", err)
+		}
+		if len(backends) == 1 {
+			return nil, err
+		}
+
+		errs = append(errs, fmt.Errorf("%s: %w", backendID(ch, backend), err))
+		if retryable, _ := classifyError(err); !retryable {
+			break
+		}
+		if i+1 < len(backends) {
+			klog.Warningf("Provider %s failed for %s, failing over to %s: %v",
+				backendID(ch, backend), ch.ResolvedFQDN, backendID(ch, backends[i+1]), err)
+		}
+	}
+	return nil, fmt.Errorf("all providers failed: %w", errors.Join(errs...))
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cert-manager-webhook-libdns/providers"
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"github.com/libdns/libdns"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// failoverTestSetup registers a flaky primary and a healthy fallback in a new
+// registry and returns a challenge configured to use them in that order
+func failoverTestSetup(t *testing.T, primaryFailures []error) (*flakyProvider, *mockProvider, *providers.Registry, *fake.Clientset, *v1alpha1.ChallengeRequest) {
+	t.Helper()
+	primary := newFlakyProvider(&mockProvider{}, map[string][]error{"SetRecords": primaryFailures})
+	secondary := &mockProvider{}
+	primaryName := "primary"
+	secondaryName := "secondary"
+	registry := providers.NewRegistry()
+	registerProvider(t, registry, primaryName, primary)
+	registerMockProvider(t, registry, secondaryName, secondary)
+
+	secret := func(name string) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "cert-manager"},
+			Data:       map[string][]byte{"api_token": []byte(name)},
+		}
+	}
+	client := fake.NewSimpleClientset(secret("primary-creds"), secret("secondary-creds"))
+
+	ch := &v1alpha1.ChallengeRequest{
+		ResolvedFQDN:      "_acme-challenge.example.com.",
+		ResolvedZone:      "example.com.",
+		Key:               "failover-key",
+		ResourceNamespace: "cert-manager",
+		Config: routesConfigJSON(t, LibdnsConfig{
+			Provider:  primaryName,
+			SecretRef: SecretReference{Name: "primary-creds"},
+			Retry:     fastRetry(2),
+			Fallbacks: []BackendConfig{
+				{Provider: secondaryName, SecretRef: SecretReference{Name: "secondary-creds"}},
+			},
+		}),
+	}
+	return primary, secondary, registry, client, ch
+}
+
+func TestLoadConfigValidatesFallbacks(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     LibdnsConfig
+		wantErr string
+	}{
+		{
+			name:    "fallback without provider",
+			cfg:     LibdnsConfig{Provider: "desec", SecretRef: SecretReference{Name: "desec"}, Fallbacks: []BackendConfig{{SecretRef: SecretReference{Name: "backup"}}}},
+			wantErr: "fallbacks[0].provider is required",
+		},
+		{
+			name: "route fallback without secret",
+			cfg: LibdnsConfig{Routes: []RouteConfig{{
+				Domain: "example.com", Provider: "desec", SecretRef: SecretReference{Name: "desec"},
+				Fallbacks: []BackendConfig{{Provider: "cloudflare"}},
+			}}},
+			wantErr: "routes[0].fallbacks[0].secretRef.name is required",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := loadConfig(routesConfigJSON(t, tc.cfg))
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestPresentFailsOverOnRetryableErrors(t *testing.T) {
+	primary, secondary, registry, client, ch := failoverTestSetup(t, []error{&statusError{code: 503}, &statusError{code: 503}})
+	solver := &libdnsSolver{client: client, registry: registry}
+
+	if err := solver.Present(ch); err != nil {
+		t.Fatalf("Present failed: %v", err)
+	}
+	if got := primary.callCount("SetRecords"); got != 2 {
+		t.Fatalf("expected the primary to exhaust its 2 attempts, got %d", got)
+	}
+	if values := txtValuesForName(primary.records, "_acme-challenge"); len(values) != 0 {
+		t.Fatalf("expected no record on the primary, got %v", values)
+	}
+	if values := txtValuesForName(secondary.records, "_acme-challenge"); len(values) != 1 || values[0] != "failover-key" {
+		t.Fatalf("expected the fallback to receive [failover-key], got %v", values)
+	}
+}
+
+func TestPresentDoesNotFailOverOnPermanentErrors(t *testing.T) {
+	_, secondary, registry, client, ch := failoverTestSetup(t, []error{&statusError{code: 401}})
+	solver := &libdnsSolver{client: client, registry: registry}
+
+	err := solver.Present(ch)
+	if err == nil || !strings.Contains(err.Error(), "all providers failed") {
+		t.Fatalf("expected an aggregated failure, got %v", err)
+	}
+	if secondary.setCalls != 0 || secondary.appendCalls != 0 {
+		t.Fatalf("expected no calls to the fallback after a permanent error, got %d set and %d append", secondary.setCalls, secondary.appendCalls)
+	}
+}
+
+func TestCleanUpUsesRecordedPlacementAfterRestart(t *testing.T) {
+	primary, secondary, registry, client, ch := failoverTestSetup(t, []error{&statusError{code: 503}, &statusError{code: 503}})
+	solver := &libdnsSolver{client: client, registry: registry}
+	solver.placements.client, solver.placements.namespace = client, "cert-manager"
+
+	if err := solver.Present(ch); err != nil {
+		t.Fatalf("Present failed: %v", err)
+	}
+	cm, err := client.CoreV1().ConfigMaps("cert-manager").Get(context.Background(), placementConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("expected the placement ConfigMap to be created: %v", err)
+	}
+	if len(cm.Data) != 1 {
+		t.Fatalf("expected one persisted placement, got %v", cm.Data)
+	}
+
+	// A new replica knows nothing in memory and must read the ConfigMap
+	restarted := &libdnsSolver{client: client, registry: registry}
+	restarted.placements.client, restarted.placements.namespace = client, "cert-manager"
+	lookups := primary.callCount("GetRecords")
+	if err := restarted.CleanUp(ch); err != nil {
+		t.Fatalf("CleanUp failed: %v", err)
+	}
+
+	if got := primary.callCount("GetRecords") - lookups; got != 0 {
+		t.Fatalf("expected CleanUp to skip the primary, got %d lookups there", got)
+	}
+	if values := txtValuesForName(secondary.records, "_acme-challenge"); len(values) != 0 {
+		t.Fatalf("expected the fallback record to be removed, got %v", values)
+	}
+	cm, err = client.CoreV1().ConfigMaps("cert-manager").Get(context.Background(), placementConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to get the placement ConfigMap: %v", err)
+	}
+	if len(cm.Data) != 0 {
+		t.Fatalf("expected the placement to be forgotten, got %v", cm.Data)
+	}
+}
+
+func TestCleanUpSearchesAllBackendsWithoutPlacement(t *testing.T) {
+	_, secondary, registry, client, ch := failoverTestSetup(t, nil)
+	secondary.records = []libdns.Record{libdns.TXT{Name: "_acme-challenge", Text: "failover-key"}}
+	solver := &libdnsSolver{client: client, registry: registry}
+
+	if err := solver.CleanUp(ch); err != nil {
+		t.Fatalf("CleanUp failed: %v", err)
+	}
+	if values := txtValuesForName(secondary.records, "_acme-challenge"); len(values) != 0 {
+		t.Fatalf("expected the fallback record to be removed, got %v", values)
+	}
+}
+
+func TestPruneExpiredDropsOldPlacements(t *testing.T) {
+	now := time.Now()
+	data := map[string]string{
+		"fresh":     `{"backend":"a","time":"` + now.Add(-placementMaxAge/2).Format(time.RFC3339) + `"}`,
+		"stale":     `{"backend":"b","time":"` + now.Add(-2*placementMaxAge).Format(time.RFC3339) + `"}`,
+		"malformed": `not json`,
+	}
+	pruneExpired(data, now)
+	if _, ok := data["fresh"]; !ok || len(data) != 1 {
+		t.Fatalf("expected only the fresh placement to remain, got %v", data)
+	}
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/klog/v2"
+)
+
+// Defaults for Lease based coordination between webhook replicas
+const (
+	defaultLeaseDuration      = 30 * time.Second
+	defaultLeaseWaitTimeout   = 90 * time.Second
+	defaultLeaseRetryInterval = 500 * time.Millisecond
+)
+
+// leaseLocker serializes TXT record updates across webhook replicas using
+// coordination.k8s.io/v1 Leases, one Lease per provider account, zone and
+// record name
+type leaseLocker struct {
+	client    kubernetes.Interface
+	namespace string
+	identity  string
+
+	// leaseDuration is how long a holder owns the Lease without renewing it
+	leaseDuration time.Duration
+	// waitTimeout bounds how long Lock waits for another holder to release
+	waitTimeout time.Duration
+	// retryInterval is the pause between acquisition attempts
+	retryInterval time.Duration
+
+	// held serializes acquisitions within this process. All of them share
+	// the holder identity, so the Lease alone would let them re-enter.
+	held keyedMutex
+}
+
+// newLeaseLockerFromEnv builds a leaseLocker from the environment.
+// Coordination is disabled (nil locker) unless LEASE_NAMESPACE is set.
+//
+// Environment variables:
+//   - LEASE_NAMESPACE: namespace in which Leases are created
+//   - LEASE_DURATION: Lease duration, at least 1s (default: 30s)
+//   - LEASE_WAIT_TIMEOUT: maximum time to wait for a Lease (default: 90s)
+//   - POD_NAME: holder identity (default: hostname)
+func newLeaseLockerFromEnv(client kubernetes.Interface) (*leaseLocker, error) {
+	namespace := os.Getenv("LEASE_NAMESPACE")
+	if namespace == "" {
+		return nil, nil
+	}
+
+	leaseDuration, err := envDuration("LEASE_DURATION", defaultLeaseDuration)
+	if err != nil {
+		return nil, err
+	}
+	// Leases count whole seconds, a shorter duration would expire at once
+	if leaseDuration < time.Second {
+		return nil, fmt.Errorf("invalid LEASE_DURATION %q: must be at least 1s", os.Getenv("LEASE_DURATION"))
+	}
+	waitTimeout, err := envDuration("LEASE_WAIT_TIMEOUT", defaultLeaseWaitTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	identity := os.Getenv("POD_NAME")
+	if identity == "" {
+		identity, err = os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("failed to determine lease holder identity: %w", err)
+		}
+	}
+
+	return &leaseLocker{
+		client:        client,
+		namespace:     namespace,
+		identity:      identity,
+		leaseDuration: leaseDuration,
+		waitTimeout:   waitTimeout,
+		retryInterval: defaultLeaseRetryInterval,
+	}, nil
+}
+
+// envDuration parses a positive duration from an environment variable
+func envDuration(name string, def time.Duration) (time.Duration, error) {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", name, raw, err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("invalid %s %q: must be positive", name, raw)
+	}
+	return d, nil
+}
+
+// Lock acquires the Lease for recordName in zone at account, waiting up to
+// waitTimeout for another holder to release it or for its Lease to expire.
+// Mirrors write the same record at different accounts, so each takes its own
+// Lease. The returned function stops renewal and releases the Lease.
+func (l *leaseLocker) Lock(ctx context.Context, account, zone, recordName string) (func(), error) {
+	name := leaseName(account, zone, recordName)
+
+	waitCtx, cancel := context.WithTimeout(ctx, l.waitTimeout)
+	defer cancel()
+
+	unlock, err := l.held.LockContext(waitCtx, name)
+	if err != nil {
+		return nil, fmt.Errorf("timed out after %s waiting for lease %s/%s", l.waitTimeout, l.namespace, name)
+	}
+
+	for {
+		acquired, err := l.tryAcquire(waitCtx, name)
+		if err != nil {
+			unlock()
+			return nil, fmt.Errorf("failed to acquire lease %s/%s: %w", l.namespace, name, err)
+		}
+		if acquired {
+			break
+		}
+
+		select {
+		case <-waitCtx.Done():
+			unlock()
+			return nil, fmt.Errorf("timed out after %s waiting for lease %s/%s", l.waitTimeout, l.namespace, name)
+		case <-time.After(l.retryInterval):
+		}
+	}
+
+	klog.V(3).Infof("Acquired lease %s/%s as %s", l.namespace, name, l.identity)
+
+	renewCtx, stopRenew := context.WithCancel(context.Background())
+	renewDone := make(chan struct{})
+	go func() {
+		defer close(renewDone)
+		l.renew(renewCtx, name)
+	}()
+
+	return func() {
+		stopRenew()
+		<-renewDone
+		l.release(name)
+		unlock()
+	}, nil
+}
+
+// tryAcquire makes a single attempt to create or take over the Lease
+func (l *leaseLocker) tryAcquire(ctx context.Context, name string) (bool, error) {
+	leases := l.client.CoordinationV1().Leases(l.namespace)
+	now := metav1.NewMicroTime(time.Now())
+	durationSeconds := int32(l.leaseDuration / time.Second)
+
+	lease, err := leases.Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = leases.Create(ctx, &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: l.namespace,
+			},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       &l.identity,
+				LeaseDurationSeconds: &durationSeconds,
+				AcquireTime:          &now,
+				RenewTime:            &now,
+			},
+		}, metav1.CreateOptions{})
+		if apierrors.IsAlreadyExists(err) {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	if err != nil {
+		return false, err
+	}
+
+	holder := ""
+	if lease.Spec.HolderIdentity != nil {
+		holder = *lease.Spec.HolderIdentity
+	}
+	if holder != "" && holder != l.identity && !leaseExpired(lease, now.Time) {
+		klog.V(4).Infof("Lease %s/%s is held by %s, waiting", l.namespace, name, holder)
+		return false, nil
+	}
+	if holder != "" && holder != l.identity {
+		klog.Warningf("Taking over expired lease %s/%s from %s", l.namespace, name, holder)
+	}
+
+	lease.Spec.HolderIdentity = &l.identity
+	lease.Spec.LeaseDurationSeconds = &durationSeconds
+	lease.Spec.AcquireTime = &now
+	lease.Spec.RenewTime = &now
+	if holder != l.identity {
+		transitions := int32(1)
+		if lease.Spec.LeaseTransitions != nil {
+			transitions = *lease.Spec.LeaseTransitions + 1
+		}
+		lease.Spec.LeaseTransitions = &transitions
+	}
+
+	// The update carries the observed resourceVersion, so a replica racing
+	// for the same stale Lease gets a conflict and keeps waiting.
+	_, err = leases.Update(ctx, lease, metav1.UpdateOptions{})
+	if apierrors.IsConflict(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// renew keeps the Lease alive until ctx is cancelled
+func (l *leaseLocker) renew(ctx context.Context, name string) {
+	ticker := time.NewTicker(l.leaseDuration / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		leases := l.client.CoordinationV1().Leases(l.namespace)
+		lease, err := leases.Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			klog.Warningf("Failed to renew lease %s/%s: %v", l.namespace, name, err)
+			continue
+		}
+		if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != l.identity {
+			klog.Warningf("Lease %s/%s was taken over by another holder", l.namespace, name)
+			return
+		}
+		now := metav1.NewMicroTime(time.Now())
+		lease.Spec.RenewTime = &now
+		if _, err := leases.Update(ctx, lease, metav1.UpdateOptions{}); err != nil {
+			klog.Warningf("Failed to renew lease %s/%s: %v", l.namespace, name, err)
+		}
+	}
+}
+
+// release deletes the Lease if it is still held by this replica
+func (l *leaseLocker) release(name string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	leases := l.client.CoordinationV1().Leases(l.namespace)
+	lease, err := leases.Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			klog.Warningf("Failed to release lease %s/%s: %v", l.namespace, name, err)
+		}
+		return
+	}
+	if lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != l.identity {
+		return
+	}
+
+	err = leases.Delete(ctx, name, metav1.DeleteOptions{
+		Preconditions: &metav1.Preconditions{ResourceVersion: &lease.ResourceVersion},
+	})
+	if err != nil && !apierrors.IsNotFound(err) {
+		klog.Warningf("Failed to release lease %s/%s: %v", l.namespace, name, err)
+		return
+	}
+	klog.V(3).Infof("Released lease %s/%s", l.namespace, name)
+}
+
+// leaseExpired reports whether the holder stopped renewing the Lease in time
+func leaseExpired(lease *coordinationv1.Lease, now time.Time) bool {
+	if lease.Spec.RenewTime == nil || lease.Spec.LeaseDurationSeconds == nil {
+		return true
+	}
+	expiry := lease.Spec.RenewTime.Add(time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second)
+	return now.After(expiry)
+}
+
+// leaseName derives a valid Lease name from the account, zone and record
+// name. The name shows the record; a hash suffix over all three keeps names
+// unique per account and after invalid characters are replaced.
+func leaseName(account, zone, recordName string) string {
+	fqdn := strings.ToLower(recordName + "." + zone)
+	sum := sha256.Sum256([]byte(account + "|" + fqdn))
+
+	var labels []string
+	for _, label := range strings.Split(fqdn, ".") {
+		label = strings.Map(func(r rune) rune {
+			if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '-' {
+				return r
+			}
+			return '-'
+		}, label)
+		if label = strings.Trim(label, "-"); label != "" {
+			labels = append(labels, label)
+		}
+	}
+	sanitized := strings.Join(labels, ".")
+	if len(sanitized) > 200 {
+		sanitized = strings.Trim(sanitized[:200], "-.")
+	}
+
+	return "libdns-" + sanitized + "-" + hex.EncodeToString(sum[:])[:8]
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cert-manager-webhook-libdns/providers"
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newTestLeaseLocker(client kubernetes.Interface, identity string) *leaseLocker {
+	return &leaseLocker{
+		client:        client,
+		namespace:     "cert-manager",
+		identity:      identity,
+		leaseDuration: 3 * time.Second,
+		waitTimeout:   2 * time.Second,
+		retryInterval: 5 * time.Millisecond,
+	}
+}
+
+func TestLeaseName(t *testing.T) {
+	valid := regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`)
+
+	tests := []struct {
+		name       string
+		zone       string
+		recordName string
+		wantPrefix string
+	}{
+		{
+			name:       "acme challenge label",
+			zone:       "example.com",
+			recordName: "_acme-challenge",
+			wantPrefix: "libdns-acme-challenge.example.com-",
+		},
+		{
+			name:       "nested underscore label",
+			zone:       "Example.COM",
+			recordName: "_acme-challenge.foo._bar",
+			wantPrefix: "libdns-acme-challenge.foo.bar.example.com-",
+		},
+		{
+			name:       "very long name is truncated",
+			zone:       "example.com",
+			recordName: strings.Repeat("a", 63) + "." + strings.Repeat("b", 63) + "." + strings.Repeat("c", 63) + "." + strings.Repeat("d", 63),
+			wantPrefix: "libdns-aaaa",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := leaseName("mock|account", tc.zone, tc.recordName)
+			if !strings.HasPrefix(got, tc.wantPrefix) {
+				t.Fatalf("leaseName(%q, %q) = %q, want prefix %q", tc.zone, tc.recordName, got, tc.wantPrefix)
+			}
+			if len(got) > 253 || !valid.MatchString(got) {
+				t.Fatalf("leaseName(%q, %q) = %q is not a valid object name", tc.zone, tc.recordName, got)
+			}
+		})
+	}
+
+	if leaseName("mock|account", "example.com", "_a") == leaseName("mock|account", "example.com", "-a") {
+		t.Fatal("expected names that sanitize identically to get distinct lease names")
+	}
+	if leaseName("primary|account", "example.com", "_acme-challenge") == leaseName("mirror|account", "example.com", "_acme-challenge") {
+		t.Fatal("expected different accounts to get distinct lease names")
+	}
+}
+
+func TestLeaseLockerExcludesOtherHolders(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	a := newTestLeaseLocker(client, "replica-a")
+	b := newTestLeaseLocker(client, "replica-b")
+
+	releaseA, err := a.Lock(context.Background(), "mock|account", "example.com", "_acme-challenge")
+	if err != nil {
+		t.Fatalf("replica-a Lock failed: %v", err)
+	}
+
+	acquired := make(chan func(), 1)
+	go func() {
+		releaseB, err := b.Lock(context.Background(), "mock|account", "example.com", "_acme-challenge")
+		if err != nil {
+			t.Errorf("replica-b Lock failed: %v", err)
+			return
+		}
+		acquired <- releaseB
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("replica-b acquired the lease while replica-a held it")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	releaseA()
+
+	select {
+	case releaseB := <-acquired:
+		releaseB()
+	case <-time.After(time.Second):
+		t.Fatal("replica-b did not acquire the lease after replica-a released it")
+	}
+
+	_, err = client.CoordinationV1().Leases("cert-manager").Get(context.Background(), leaseName("mock|account", "example.com", "_acme-challenge"), metav1.GetOptions{})
+	if !apierrors.IsNotFound(err) {
+		t.Fatalf("expected lease to be deleted after release, got err=%v", err)
+	}
+}
+
+func TestLeaseLockerSerializesHoldersInOneProcess(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	locker := newTestLeaseLocker(client, "replica-a")
+	name := leaseName("mock|account", "example.com", "_acme-challenge")
+
+	releaseFirst, err := locker.Lock(context.Background(), "mock|account", "example.com", "_acme-challenge")
+	if err != nil {
+		t.Fatalf("first Lock failed: %v", err)
+	}
+
+	acquired := make(chan func(), 1)
+	go func() {
+		releaseSecond, err := locker.Lock(context.Background(), "mock|account", "example.com", "_acme-challenge")
+		if err != nil {
+			t.Errorf("second Lock failed: %v", err)
+			return
+		}
+		acquired <- releaseSecond
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("a second holder with the same identity re-entered the lease")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	releaseFirst()
+
+	var releaseSecond func()
+	select {
+	case releaseSecond = <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("the second holder did not acquire the lease after the first released it")
+	}
+
+	// The first release must not leave the second holder without a Lease
+	lease, err := client.CoordinationV1().Leases("cert-manager").Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil || lease.Spec.HolderIdentity == nil || *lease.Spec.HolderIdentity != "replica-a" {
+		t.Fatalf("expected the second holder to hold the lease, got %v, err=%v", lease, err)
+	}
+	releaseSecond()
+}
+
+func TestLeaseLockerTakesOverExpiredLease(t *testing.T) {
+	name := leaseName("mock|account", "example.com", "_acme-challenge")
+	holder := "crashed-replica"
+	duration := int32(1)
+	stale := metav1.NewMicroTime(time.Now().Add(-time.Minute))
+	client := fake.NewSimpleClientset(&coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "cert-manager"},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       &holder,
+			LeaseDurationSeconds: &duration,
+			AcquireTime:          &stale,
+			RenewTime:            &stale,
+		},
+	})
+
+	locker := newTestLeaseLocker(client, "replica-a")
+	release, err := locker.Lock(context.Background(), "mock|account", "example.com", "_acme-challenge")
+	if err != nil {
+		t.Fatalf("Lock failed: %v", err)
+	}
+
+	lease, err := client.CoordinationV1().Leases("cert-manager").Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("failed to get lease: %v", err)
+	}
+	if got := *lease.Spec.HolderIdentity; got != "replica-a" {
+		t.Fatalf("expected holder replica-a after takeover, got %s", got)
+	}
+	if lease.Spec.LeaseTransitions == nil || *lease.Spec.LeaseTransitions != 1 {
+		t.Fatalf("expected one lease transition, got %v", lease.Spec.LeaseTransitions)
+	}
+
+	release()
+}
+
+func TestLeaseLockerTimesOutOnHeldLease(t *testing.T) {
+	name := leaseName("mock|account", "example.com", "_acme-challenge")
+	holder := "busy-replica"
+	duration := int32(3600)
+	now := metav1.NewMicroTime(time.Now())
+	client := fake.NewSimpleClientset(&coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "cert-manager"},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       &holder,
+			LeaseDurationSeconds: &duration,
+			AcquireTime:          &now,
+			RenewTime:            &now,
+		},
+	})
+
+	locker := newTestLeaseLocker(client, "replica-a")
+	locker.waitTimeout = 50 * time.Millisecond
+
+	_, err := locker.Lock(context.Background(), "mock|account", "example.com", "_acme-challenge")
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("expected timeout error, got %v", err)
+	}
+}
+
+func TestLeaseLockerFromEnvRejectsSubSecondDuration(t *testing.T) {
+	t.Setenv("LEASE_NAMESPACE", "cert-manager")
+	t.Setenv("LEASE_DURATION", "500ms")
+
+	_, err := newLeaseLockerFromEnv(fake.NewSimpleClientset())
+	if err == nil || !strings.Contains(err.Error(), "must be at least 1s") {
+		t.Fatalf("expected a sub-second LEASE_DURATION to be rejected, got %v", err)
+	}
+}
+
+func TestPresentAcrossReplicasKeepsAllTXTValues(t *testing.T) {
+	mp := &mockProvider{getDelay: 2 * time.Millisecond}
+	providerName := "mock"
+	registry := providers.NewRegistry()
+	registerMockProvider(t, registry, providerName, mp)
+
+	// Two solvers share the API server (and DNS provider) but no in-process state,
+	// like two webhook pods.
+	base := newTestSolver(registry, "cert-manager", "dns-creds")
+	replicas := []*libdnsSolver{
+		{client: base.client, registry: registry, leases: newTestLeaseLocker(base.client, "replica-a")},
+		{client: base.client, registry: registry, leases: newTestLeaseLocker(base.client, "replica-b")},
+	}
+
+	const perReplica = 8
+	var wg sync.WaitGroup
+	errs := make(chan error, perReplica*len(replicas))
+	for r, solver := range replicas {
+		for i := range perReplica {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs <- solver.Present(&v1alpha1.ChallengeRequest{
+					ResolvedFQDN:      "_acme-challenge.example.com.",
+					ResolvedZone:      "example.com.",
+					Key:               strings.Repeat("x", r+1) + string(rune('a'+i)),
+					ResourceNamespace: "cert-manager",
+					Config:            challengeConfigJSON(t, providerName, "dns-creds", "", 300),
+				})
+			}()
+		}
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Present failed: %v", err)
+		}
+	}
+
+	values := txtValuesForName(mp.records, "_acme-challenge")
+	for r := range replicas {
+		for i := range perReplica {
+			want := strings.Repeat("x", r+1) + string(rune('a'+i))
+			if !slices.Contains(values, want) {
+				t.Fatalf("TXT value %s was dropped, got %v", want, values)
+			}
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// keyedMutex hands out one mutex per key so that callers working on the same
+// key are serialized while unrelated keys proceed in parallel.
+// The zero value is ready to use.
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*keyedLock
+}
+
+// keyedLock is a reference-counted mutex owned by a keyedMutex. It is a
+// channel so that waiting for it can be cancelled.
+type keyedLock struct {
+	ch   chan struct{}
+	refs int
+}
+
+// Lock acquires the mutex for key and returns a function that releases it
+func (k *keyedMutex) Lock(key string) func() {
+	unlock, _ := k.LockContext(context.Background(), key)
+	return unlock
+}
+
+// LockContext acquires the mutex for key like Lock, but gives up with the
+// context's error when ctx is done first
+func (k *keyedMutex) LockContext(ctx context.Context, key string) (func(), error) {
+	k.mu.Lock()
+	if k.locks == nil {
+		k.locks = make(map[string]*keyedLock)
+	}
+	l, ok := k.locks[key]
+	if !ok {
+		l = &keyedLock{ch: make(chan struct{}, 1)}
+		k.locks[key] = l
+	}
+	l.refs++
+	k.mu.Unlock()
+
+	unref := func() {
+		k.mu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(k.locks, key)
+		}
+		k.mu.Unlock()
+	}
+
+	select {
+	case l.ch <- struct{}{}:
+	case <-ctx.Done():
+		unref()
+		return nil, ctx.Err()
+	}
+
+	return func() {
+		<-l.ch
+		unref()
+	}, nil
+}
+
+// recordLockKey builds the key used to serialize TXT merges for a single record.
+// Credentials are reduced to a fingerprint so that two issuers pointing at the
+// same account share a lock without the key carrying secret material.
+func recordLockKey(providerName string, credentials map[string]string, zone, recordName string) string {
+	return strings.Join([]string{providerName, credentialFingerprint(credentials), zone, recordName}, "|")
+}
+
+// credentialFingerprint returns a stable, non-reversible identifier for a credential set
+func credentialFingerprint(credentials map[string]string) string {
+	keys := make([]string, 0, len(credentials))
+	for key := range credentials {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	for _, key := range keys {
+		h.Write([]byte(key))
+		h.Write([]byte{0})
+		h.Write([]byte(credentials[key]))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
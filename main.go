@@ -2,7 +2,7 @@ package main
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"slices"
@@ -12,11 +12,13 @@ import (
 	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
 	"github.com/cert-manager/cert-manager/pkg/acme/webhook/cmd"
 	"github.com/libdns/libdns"
+	corev1 "k8s.io/api/core/v1"
 	extapi "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/klog/v2"
+	kjson "sigs.k8s.io/json"
 
 	"github.com/cert-manager-webhook-libdns/providers"
 )
@@ -30,9 +32,16 @@ func main() {
 
 	// Handle --list-providers before webhook server takes over flag parsing
 	if slices.Contains(os.Args, "--list-providers") {
-		fmt.Println("Compiled-in DNS providers:")
-		for _, p := range providers.ListProviders() {
-			fmt.Printf("  - %s\n", p)
+		if err := printProviders(os.Stdout, flagValue(os.Args, "--output")); err != nil {
+			klog.Fatalf("Failed to list providers: %v", err)
+		}
+		os.Exit(0)
+	}
+
+	// Handle --print-config-schema before webhook server takes over flag parsing
+	if slices.Contains(os.Args, "--print-config-schema") {
+		if err := printConfigSchema(os.Stdout); err != nil {
+			klog.Fatalf("Failed to print config schema: %v", err)
 		}
 		os.Exit(0)
 	}
@@ -42,27 +51,101 @@ func main() {
 		klog.Fatal("GROUP_NAME environment variable must be specified")
 	}
 
-	cmd.RunWebhookServer(groupName, &libdnsSolver{})
+	cmd.RunWebhookServer(groupName, &libdnsSolver{registry: providers.DefaultRegistry()})
 }
 
 // libdnsSolver implements the webhook.Solver interface using libdns providers
 type libdnsSolver struct {
 	client kubernetes.Interface
+
+	// registry provides the DNS provider factories; nil uses the compiled-in providers
+	registry *providers.Registry
+
+	// recordLocks serializes the read-modify-write of a single TXT record set
+	recordLocks keyedMutex
+
+	// leases extends recordLocks across replicas; nil when coordination is disabled
+	leases *leaseLocker
+
+	// providerCache reuses constructed providers per credential Secret revision
+	providerCache providerCache
+
+	// secrets serves credential Secrets from an informer cache; nil falls back to direct GETs
+	secrets *secretInformer
+
+	// rateLimiters throttles API calls per provider account across all challenges
+	rateLimiters rateLimiters
+
+	// zones caches the zone lists of providers that implement libdns.ZoneLister
+	zones zoneCache
+
+	// stopCtx is cancelled when the webhook shuts down; nil before Initialize
+	stopCtx context.Context
+
+	// placements remembers which fallback backend received a challenge value
+	placements placementStore
+
+	// cluster holds the defaults and policy of the cluster defaults ConfigMap
+	cluster clusterDefaults
 }
 
 // LibdnsConfig is the configuration for the libdns solver
 type LibdnsConfig struct {
-	// Provider is the name of the DNS provider (e.g., "cloudflare", "route53")
-	Provider string `json:"provider"`
+	// Provider is the name of the DNS provider (e.g., "cloudflare", "route53");
+	// optional when every challenge is covered by Routes
+	Provider string `json:"provider,omitempty"`
 
 	// SecretRef references a Kubernetes Secret containing provider credentials
 	SecretRef SecretReference `json:"secretRef"`
 
+	// SecretRefs are further Secrets whose credentials are added to those of
+	// SecretRef; later Secrets override earlier ones
+	SecretRefs []SecretReference `json:"secretRefs,omitempty"`
+
+	// Options are non-secret provider settings such as region or endpoint;
+	// they override the ConfigMap, which overrides the Secret
+	Options map[string]string `json:"options,omitempty"`
+
+	// ConfigMapRef references a ConfigMap with non-secret provider settings
+	ConfigMapRef *ConfigMapReference `json:"configMapRef,omitempty"`
+
 	// Zone optionally overrides the zone determined by cert-manager
 	Zone string `json:"zone,omitempty"`
 
 	// TTL is the DNS record TTL in seconds (default: 300, deSEC requires minimum 3600)
 	TTL int `json:"ttl,omitempty"`
+
+	// Propagation optionally makes Present wait until the authoritative nameservers serve the record
+	Propagation *PropagationConfig `json:"propagation,omitempty"`
+
+	// Retry controls retries of failed provider API calls (default: 5 attempts within 90s)
+	Retry *RetryConfig `json:"retry,omitempty"`
+
+	// RateLimit overrides the provider's default API rate limit and concurrency cap
+	RateLimit *RateLimitConfig `json:"rateLimit,omitempty"`
+
+	// Timeouts bounds the whole operation, single API calls and the Secret fetch
+	Timeouts *TimeoutsConfig `json:"timeouts,omitempty"`
+
+	// Routes send challenges to other providers by domain suffix; the longest
+	// match wins and challenges without a match use the top-level provider
+	Routes []RouteConfig `json:"routes,omitempty"`
+
+	// Fallbacks are secondary accounts for the same zone, tried in order when
+	// the provider fails with retryable errors
+	Fallbacks []BackendConfig `json:"fallbacks,omitempty"`
+
+	// Mirrors are further providers publishing the same zone; Present writes
+	// the value to the provider and all mirrors in parallel
+	Mirrors []BackendConfig `json:"mirrors,omitempty"`
+
+	// MirrorQuorum is how many of the provider and its mirrors must accept
+	// the value for Present to succeed (default: all)
+	MirrorQuorum int `json:"mirrorQuorum,omitempty"`
+
+	// FollowCNAME makes the solver follow CNAMEs at the challenge FQDN and write
+	// the record at the end of the chain, using the route for the target domain
+	FollowCNAME *CNAMEConfig `json:"followCNAME,omitempty"`
 }
 
 // SecretReference identifies a Kubernetes Secret
@@ -72,6 +155,10 @@ type SecretReference struct {
 
 	// Namespace is the namespace of the Secret (optional, defaults to challenge namespace)
 	Namespace string `json:"namespace,omitempty"`
+
+	// Keys maps provider credential names to keys of the Secret, e.g.
+	// access_key_id: AWS_ACCESS_KEY_ID; when set, only the mapped keys are used
+	Keys map[string]string `json:"keys,omitempty"`
 }
 
 // Name returns the solver name used in Issuer configurations
@@ -81,14 +168,60 @@ func (s *libdnsSolver) Name() string {
 
 // Initialize is called when the webhook first starts
 func (s *libdnsSolver) Initialize(kubeClientConfig *rest.Config, stopCh <-chan struct{}) error {
+	s.stopCtx = contextUntilStopped(stopCh)
+
 	client, err := kubernetes.NewForConfig(kubeClientConfig)
 	if err != nil {
 		return fmt.Errorf("failed to create kubernetes client: %w", err)
 	}
 	s.client = client
 
+	leases, err := newLeaseLockerFromEnv(client)
+	if err != nil {
+		return fmt.Errorf("failed to configure lease coordination: %w", err)
+	}
+	s.leases = leases
+	if leases != nil {
+		klog.Infof("Lease coordination enabled in namespace %s as %s", leases.namespace, leases.identity)
+	}
+
+	idleTimeout, err := envDuration("PROVIDER_CACHE_IDLE_TIMEOUT", defaultProviderCacheIdleTimeout)
+	if err != nil {
+		return err
+	}
+	s.providerCache.idleTimeout = idleTimeout
+	s.rateLimiters.idleTimeout = idleTimeout
+
+	if namespace := os.Getenv("PLACEMENT_NAMESPACE"); namespace != "" {
+		s.placements.client, s.placements.namespace = client, namespace
+		klog.Infof("Persisting fallback placements in ConfigMap %s/%s", namespace, placementConfigMapName)
+	}
+
+	cmNamespace, cmName, err := clusterConfigMapFromEnv()
+	if err != nil {
+		return err
+	}
+	if cmName != "" {
+		if err := watchClusterConfig(client, cmNamespace, cmName, &s.cluster, stopCh); err != nil {
+			return err
+		}
+	}
+
+	namespaces, labelSelector, err := secretInformerOptionsFromEnv()
+	if err != nil {
+		return err
+	}
+	secrets, err := startSecretInformer(client, namespaces, labelSelector, secretInformerSyncTimeout, stopCh)
+	if err != nil {
+		// Credentials are then read with a GET per challenge
+		klog.Warningf("Secret informer not started, reading Secrets directly: %v", err)
+	} else {
+		s.secrets = secrets
+		klog.Infof("Secret informer started (namespaces=%q labelSelector=%q)", namespaces, labelSelector)
+	}
+
 	klog.Info("libdns solver initialized")
-	klog.Infof("Available providers: %v", providers.ListProviders())
+	klog.Infof("Available providers: %v", s.providerRegistry().List())
 	return nil
 }
 
@@ -97,69 +230,102 @@ func (s *libdnsSolver) Initialize(kubeClientConfig *rest.Config, stopCh <-chan s
 func (s *libdnsSolver) Present(ch *v1alpha1.ChallengeRequest) error {
 	klog.Infof("Present called: fqdn=%s zone=%s key=%s", ch.ResolvedFQDN, ch.ResolvedZone, ch.Key)
 
-	provider, zone, ttl, err := s.getProvider(ch)
+	ch, cfg, err := s.challengeConfig(ch)
 	if err != nil {
 		return fmt.Errorf("failed to get provider: %w", err)
 	}
+	if len(cfg.Mirrors) > 0 {
+		return s.presentMirrored(ch, cfg)
+	}
+	backends := cfg.backends()
 
-	recordName := extractRecordName(ch.ResolvedFQDN, zone)
-	klog.V(2).Infof("Creating TXT record: name=%s zone=%s ttl=%s", recordName, zone, ttl)
+	target, err := s.withFailover(ch, backends, func(target *challengeTarget) error {
+		recordName := extractRecordName(ch.ResolvedFQDN, target.zone)
+		klog.V(2).Infof("Creating TXT record: name=%s zone=%s ttl=%s", recordName, target.zone, target.ttl)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
-	defer cancel()
+		ctx, cancel := context.WithTimeout(s.baseContext(), target.timeouts.operation)
+		defer cancel()
+		return s.presentRecord(ctx, target, recordName, ch.Key)
+	})
+	if err != nil {
+		return err
+	}
+
+	// Remember a fallback, so CleanUp goes there even after a restart
+	if target.backend != backendID(ch, backends[0]) {
+		entry := placement{Backend: target.backend, FQDN: ch.ResolvedFQDN, Time: time.Now()}
+		if err := s.placements.record(s.baseContext(), placementKey(ch.ResolvedFQDN, ch.Key), entry); err != nil {
+			klog.Warningf("Failed to persist placement of %s on %s: %v", ch.ResolvedFQDN, target.backend, err)
+		}
+	}
+
+	// Wait outside the record lock so the sibling challenge is not held up
+	if target.propagation != nil {
+		if err := waitForPropagation(s.baseContext(), target.propagation, ch.ResolvedFQDN, target.zone, ch.Key); err != nil {
+			return fmt.Errorf("propagation check failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// presentRecord merges key into the TXT record set at recordName, or appends
+// it when the provider cannot get and set the record set
+func (s *libdnsSolver) presentRecord(ctx context.Context, target *challengeTarget, recordName, key string) error {
+	provider, zone, ttl := target.provider, target.zone, target.ttl
+
+	// Wildcard and base-domain challenges share a record name and are often
+	// presented concurrently; hold the lock across the whole merge.
+	unlock, err := s.lockRecord(ctx, target, recordName)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	caps := target.capabilities
+	if !caps.Get {
+		// Without a way to read the record set, adding the value is all we can do
+		return appendRecord(ctx, target, recordName, key)
+	}
 
 	// Get existing records to merge with new value
-	existingRecords, err := provider.GetRecords(ctx, zone)
+	existingRecords, err := providers.GetRecordsByName(ctx, provider, zone, recordName, "TXT")
 	if err != nil {
-		klog.Warningf("Failed to get existing records (falling back to append): %v", err)
-		records := []libdns.Record{
-			libdns.TXT{
-				Name: recordName,
-				TTL:  ttl,
-				Text: ch.Key,
-			},
-		}
-		appendedRecords, appendErr := provider.AppendRecords(ctx, zone, records)
-		if appendErr != nil {
-			return fmt.Errorf("failed to append TXT record after get failure: %w", appendErr)
+		if !caps.Append {
+			return fmt.Errorf("failed to get existing TXT records: %w", err)
 		}
-		klog.Infof("Successfully appended %d TXT record(s) for %s in zone %s", len(appendedRecords), recordName, zone)
-		return nil
+		klog.Warningf("Failed to get existing records (falling back to append): %v", err)
+		return appendRecord(ctx, target, recordName, key)
 	}
 
-	// Collect existing TXT values for this record name
-	var existingValues []string
+	// Collect existing TXT records for this record name, keeping their TTL and
+	// provider data so that rewriting the set leaves them untouched
+	var records []libdns.Record
 	for _, rec := range existingRecords {
 		rr := rec.RR()
 		if rr.Type == "TXT" && rr.Name == recordName {
-			existingValues = append(existingValues, rr.Data)
+			// Check if our value already exists
+			if rr.Data == key {
+				klog.Infof("TXT record with value already exists for %s in zone %s", recordName, zone)
+				return nil
+			}
+			records = append(records, existingTXT(rec, ttl))
 		}
 	}
 
-	// Check if our value already exists
-	for _, val := range existingValues {
-		if val == ch.Key {
-			klog.Infof("TXT record with value already exists for %s in zone %s", recordName, zone)
-			return nil
-		}
+	if !caps.Set {
+		return appendRecord(ctx, target, recordName, key)
 	}
 
 	// Add our new value
-	allValues := append(existingValues, ch.Key)
-	klog.V(2).Infof("Setting TXT records for %s: %d existing + 1 new = %d total", recordName, len(existingValues), len(allValues))
-
-	// Build records to set using libdns.TXT
-	var records []libdns.Record
-	for _, val := range allValues {
-		records = append(records, libdns.TXT{
-			Name: recordName,
-			TTL:  ttl,
-			Text: val,
-		})
-	}
+	klog.V(2).Infof("Setting TXT records for %s: %d existing + 1 new = %d total", recordName, len(records), len(records)+1)
+	records = append(records, libdns.TXT{
+		Name: recordName,
+		TTL:  ttl,
+		Text: key,
+	})
 
 	// Use SetRecords to set all TXT values at once
-	set, err := provider.SetRecords(ctx, zone, records)
+	set, err := providers.SetRecords(ctx, provider, zone, records)
 	if err != nil {
 		return fmt.Errorf("failed to set TXT records: %w", err)
 	}
@@ -168,127 +334,344 @@ func (s *libdnsSolver) Present(ch *v1alpha1.ChallengeRequest) error {
 	return nil
 }
 
+// appendRecord adds key to the TXT record set at recordName without
+// rewriting the other values
+func appendRecord(ctx context.Context, target *challengeTarget, recordName, key string) error {
+	records := []libdns.Record{
+		libdns.TXT{
+			Name: recordName,
+			TTL:  target.ttl,
+			Text: key,
+		},
+	}
+	appendedRecords, err := providers.AppendRecords(ctx, target.provider, target.zone, records)
+	if err != nil {
+		return fmt.Errorf("failed to append TXT record: %w", err)
+	}
+	klog.Infof("Successfully appended %d TXT record(s) for %s in zone %s", len(appendedRecords), recordName, target.zone)
+	return nil
+}
+
 // CleanUp removes the DNS TXT record after validation
 // It handles multiple TXT values for the same name by only removing the specific value
 func (s *libdnsSolver) CleanUp(ch *v1alpha1.ChallengeRequest) error {
 	klog.Infof("CleanUp called: fqdn=%s zone=%s key=%s", ch.ResolvedFQDN, ch.ResolvedZone, ch.Key)
 
-	provider, zone, ttl, err := s.getProvider(ch)
+	ch, cfg, err := s.challengeConfig(ch)
 	if err != nil {
 		return fmt.Errorf("failed to get provider: %w", err)
 	}
+	if len(cfg.Mirrors) > 0 {
+		return s.cleanUpMirrored(ch, cfg)
+	}
+	backends := cfg.backends()
+
+	// Go straight to the fallback that received the value; otherwise look
+	// for it on every backend, primary first
+	key := placementKey(ch.ResolvedFQDN, ch.Key)
+	placed, hasPlacement := s.placements.lookup(s.baseContext(), key)
+	if hasPlacement {
+		for _, backend := range backends {
+			if backendID(ch, backend) == placed.Backend {
+				backends = []*LibdnsConfig{backend}
+				break
+			}
+		}
+	}
+
+	var errs []error
+	for _, backend := range backends {
+		target, err := s.buildTarget(ch, backend)
+		if err != nil {
+			err = fmt.Errorf("failed to get provider: %w", err)
+		} else {
+			var removed bool
+			removed, err = s.cleanUpTarget(ch, target)
+			if err == nil && (removed || len(backends) == 1) {
+				if hasPlacement {
+					if err := s.placements.forget(s.baseContext(), key); err != nil {
+						klog.Warningf("Failed to forget placement of %s: %v", ch.ResolvedFQDN, err)
+					}
+				}
+				return nil
+			}
+		}
+		if len(backends) == 1 {
+			return err
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", backendID(ch, backend), err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to clean up on all providers: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// cleanUpTarget removes the challenge value from one backend and reports
+// whether it was found there. Depending on the provider's capabilities the
+// value is deleted or the remaining values are set.
+func (s *libdnsSolver) cleanUpTarget(ch *v1alpha1.ChallengeRequest, target *challengeTarget) (bool, error) {
+	provider, zone, ttl := target.provider, target.zone, target.ttl
 
 	recordName := extractRecordName(ch.ResolvedFQDN, zone)
 	klog.V(2).Infof("Deleting TXT record: name=%s zone=%s key=%s", recordName, zone, ch.Key)
 
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	ctx, cancel := context.WithTimeout(s.baseContext(), target.timeouts.operation)
 	defer cancel()
 
+	unlock, err := s.lockRecord(ctx, target, recordName)
+	if err != nil {
+		return false, err
+	}
+	defer unlock()
+
+	caps := target.capabilities
+	if !caps.Get {
+		// Without a way to read the record set, delete the value directly
+		return deleteRecord(ctx, target, recordName, ch.Key)
+	}
+
 	// Get existing records to remove only the specific value
-	existingRecords, err := provider.GetRecords(ctx, zone)
+	existingRecords, err := providers.GetRecordsByName(ctx, provider, zone, recordName, "TXT")
 	if err != nil {
-		klog.Warningf("Failed to get existing records (will try delete): %v", err)
-		// Fall back to direct delete
-		records := []libdns.Record{
-			libdns.TXT{
-				Name: recordName,
-				Text: ch.Key,
-			},
-		}
-		deleted, err := provider.DeleteRecords(ctx, zone, records)
-		if err != nil {
-			return fmt.Errorf("failed to delete TXT record: %w", err)
+		if !caps.Delete {
+			return false, fmt.Errorf("failed to get existing TXT records: %w", err)
 		}
-		klog.Infof("Successfully deleted %d TXT record(s) for %s in zone %s", len(deleted), recordName, zone)
-		return nil
+		klog.Warningf("Failed to get existing records (will try delete): %v", err)
+		return deleteRecord(ctx, target, recordName, ch.Key)
 	}
 
-	// Collect TXT values for this record name, excluding the one we want to remove
+	// Collect TXT records for this record name, excluding the one we want to
+	// remove; the others keep their original TTL and provider data
 	var remainingRecords []libdns.Record
-	found := false
+	var found libdns.Record
 	for _, rec := range existingRecords {
 		rr := rec.RR()
 		if rr.Type == "TXT" && rr.Name == recordName {
 			if rr.Data == ch.Key {
-				found = true
+				found = existingTXT(rec, 0)
 				continue // Skip this one
 			}
-			remainingRecords = append(remainingRecords, libdns.TXT{
-				Name: recordName,
-				TTL:  ttl,
-				Text: rr.Data,
-			})
+			remainingRecords = append(remainingRecords, existingTXT(rec, ttl))
 		}
 	}
 
-	if !found {
+	if found == nil {
 		klog.Infof("TXT record with value not found for %s in zone %s (may already be deleted)", recordName, zone)
-		return nil
+		return false, nil
 	}
 
-	if len(remainingRecords) == 0 {
-		// No remaining records, delete entirely
-		records := []libdns.Record{
-			libdns.TXT{
-				Name: recordName,
-				Text: ch.Key,
-			},
-		}
-		deleted, err := provider.DeleteRecords(ctx, zone, records)
+	switch {
+	case caps.Delete && (len(remainingRecords) == 0 || !caps.Set):
+		// Delete just our value; the record as returned by the provider
+		// carries any ID it needs to find it
+		deleted, err := providers.DeleteRecords(ctx, provider, zone, []libdns.Record{found})
 		if err != nil {
-			return fmt.Errorf("failed to delete TXT record: %w", err)
+			return false, fmt.Errorf("failed to delete TXT record: %w", err)
 		}
 		klog.Infof("Successfully deleted %d TXT record(s) for %s in zone %s", len(deleted), recordName, zone)
-	} else {
+	case len(remainingRecords) == 0:
+		// Setting an empty set changes nothing in libdns, so without delete
+		// the last value cannot be removed. Failing would keep cert-manager's
+		// finalizer on the Challenge forever, and a stale challenge value is
+		// harmless, so warn and finish the clean-up. The value was found
+		// here, so other backends need not be searched for it.
+		klog.Warningf("Provider %s cannot delete records, the last TXT value for %s in zone %s could not be removed and is left in place",
+			target.providerName, recordName, zone)
+	default:
 		// Set remaining records (this removes the one we want to delete)
 		klog.V(2).Infof("Setting %d remaining TXT records for %s", len(remainingRecords), recordName)
-		set, err := provider.SetRecords(ctx, zone, remainingRecords)
+		set, err := providers.SetRecords(ctx, provider, zone, remainingRecords)
 		if err != nil {
-			return fmt.Errorf("failed to set remaining TXT records: %w", err)
+			return false, fmt.Errorf("failed to set remaining TXT records: %w", err)
 		}
 		klog.Infof("Successfully updated TXT records for %s in zone %s (%d remaining)", recordName, zone, len(set))
 	}
 
-	return nil
+	return true, nil
+}
+
+// deleteRecord removes key from the TXT record set at recordName without
+// reading it first and reports whether the provider deleted anything
+func deleteRecord(ctx context.Context, target *challengeTarget, recordName, key string) (bool, error) {
+	records := []libdns.Record{
+		libdns.TXT{
+			Name: recordName,
+			Text: key,
+		},
+	}
+	deleted, err := providers.DeleteRecords(ctx, target.provider, target.zone, records)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete TXT record: %w", err)
+	}
+	klog.Infof("Successfully deleted %d TXT record(s) for %s in zone %s", len(deleted), recordName, target.zone)
+	return len(deleted) > 0, nil
+}
+
+// baseContext returns the context all operations derive from, which is
+// cancelled when the webhook shuts down
+func (s *libdnsSolver) baseContext() context.Context {
+	if s.stopCtx == nil {
+		return context.Background()
+	}
+	return s.stopCtx
+}
+
+// providerRegistry returns the registry that DNS providers are created from
+func (s *libdnsSolver) providerRegistry() *providers.Registry {
+	if s.registry == nil {
+		return providers.DefaultRegistry()
+	}
+	return s.registry
+}
+
+// lockRecord serializes updates to recordName within this process and, when
+// Lease coordination is enabled, across all webhook replicas. Waiting for
+// either lock ends with ctx.
+func (s *libdnsSolver) lockRecord(ctx context.Context, target *challengeTarget, recordName string) (func(), error) {
+	unlock, err := s.recordLocks.LockContext(ctx, target.lockKey(recordName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock %s in zone %s: %w", recordName, target.zone, err)
+	}
+	if s.leases == nil {
+		return unlock, nil
+	}
+
+	release, err := s.leases.Lock(ctx, target.account(), target.zone, recordName)
+	if err != nil {
+		unlock()
+		return nil, fmt.Errorf("failed to lock %s in zone %s: %w", recordName, target.zone, err)
+	}
+	return func() {
+		release()
+		unlock()
+	}, nil
 }
 
 // Default TTL for DNS records (in seconds)
 const defaultTTL = 300
 
-// deSEC enforces a minimum TTL of 3600 seconds.
-const desecMinTTL = 3600
+// challengeTarget is the resolved provider, zone and TTL for a challenge
+type challengeTarget struct {
+	provider     providers.DNSProvider
+	providerName string
+	backend      string
+	credentials  map[string]string
+	zone         string
+	ttl          time.Duration
+
+	// propagation enables the authoritative nameserver check in Present
+	propagation *PropagationConfig
+
+	// timeouts bound the operation and each provider API call
+	timeouts timeouts
+
+	// capabilities are the record operations of the provider beneath the
+	// decorators, which choose how values are added and removed
+	capabilities providers.Capabilities
+}
+
+// providerWrapper is implemented by the retry, rate limit and timeout decorators.
+// They implement every record operation and providers.RecordLookup, passing
+// them through to the provider beneath, which falls back to GetRecords when it
+// lacks a lookup and returns providers.ErrUnsupported for missing operations.
+type providerWrapper interface {
+	unwrap() providers.DNSProvider
+}
+
+// unwrapProvider returns the provider created by the factory beneath all decorators
+func unwrapProvider(provider providers.DNSProvider) providers.DNSProvider {
+	for {
+		w, ok := provider.(providerWrapper)
+		if !ok {
+			return provider
+		}
+		provider = w.unwrap()
+	}
+}
+
+// account identifies the provider account of the target without carrying
+// secret material
+func (t *challengeTarget) account() string {
+	return t.providerName + "|" + credentialFingerprint(t.credentials)
+}
 
-// getProvider creates the DNS provider based on configuration
-func (s *libdnsSolver) getProvider(ch *v1alpha1.ChallengeRequest) (providers.DNSProvider, string, time.Duration, error) {
-	cfg, err := loadConfig(ch.Config)
+// lockKey returns the key serializing updates to recordName at this target
+func (t *challengeTarget) lockKey(recordName string) string {
+	return recordLockKey(t.providerName, t.credentials, t.zone, recordName)
+}
+
+// getProvider creates the primary DNS provider based on configuration
+func (s *libdnsSolver) getProvider(ch *v1alpha1.ChallengeRequest) (*challengeTarget, error) {
+	ch, cfg, err := s.challengeConfig(ch)
+	if err != nil {
+		return nil, err
+	}
+	return s.buildTarget(ch, cfg)
+}
+
+// challengeConfig loads the configuration that applies to the challenge's
+// FQDN. When CNAMEs are followed, the returned challenge is redirected to the
+// end of the chain.
+func (s *libdnsSolver) challengeConfig(ch *v1alpha1.ChallengeRequest) (*v1alpha1.ChallengeRequest, *LibdnsConfig, error) {
+	cluster := s.cluster.load()
+	if cluster == nil {
+		cluster = &clusterConfig{}
+	}
+	cfg, err := loadConfigWithDefaults(ch.Config, cluster.defaults)
 	if err != nil {
-		return nil, "", 0, fmt.Errorf("failed to load config: %w", err)
+		return nil, nil, fmt.Errorf("failed to load config: %w", err)
 	}
+	if err := cluster.policy.check(cfg, s.providerRegistry()); err != nil {
+		return nil, nil, err
+	}
+	if cfg.FollowCNAME != nil {
+		if ch, err = s.followChallengeCNAME(ch, cfg); err != nil {
+			return nil, nil, err
+		}
+	}
+	cfg, err = cfg.forFQDN(ch.ResolvedFQDN)
+	if err != nil {
+		return nil, nil, err
+	}
+	return ch, cfg, nil
+}
 
+// buildTarget creates the provider, zone and TTL for one backend configuration
+func (s *libdnsSolver) buildTarget(ch *v1alpha1.ChallengeRequest, cfg *LibdnsConfig) (*challengeTarget, error) {
 	klog.V(2).Infof("Loading credentials for provider %s from secret %s/%s",
 		cfg.Provider, cfg.SecretRef.Namespace, cfg.SecretRef.Name)
 
-	credentials, err := s.loadCredentials(ch, cfg)
+	credentials, rev, err := s.loadCredentials(ch, cfg)
 	if err != nil {
-		return nil, "", 0, fmt.Errorf("failed to load credentials: %w", err)
+		return nil, fmt.Errorf("failed to load credentials: %w", err)
 	}
 
-	provider, err := providers.CreateProvider(cfg.Provider, providers.ProviderConfig{
-		Credentials: credentials,
-	})
+	settings, err := s.loadSettings(ch, cfg)
 	if err != nil {
-		return nil, "", 0, fmt.Errorf("failed to create %s provider: %w", cfg.Provider, err)
+		return nil, fmt.Errorf("failed to load settings: %w", err)
 	}
-
-	// Determine zone
-	zone := cfg.Zone
-	if zone == "" {
-		zone = ch.ResolvedZone
+	if len(settings) > 0 {
+		// Settings are not versioned like Secrets; key the cache by their content
+		rev.Sources += "|settings=" + credentialFingerprint(settings)
 	}
-	// libdns providers expect zone WITHOUT trailing dot
-	zone = strings.TrimSuffix(zone, ".")
-	if zone == "" {
-		return nil, "", 0, fmt.Errorf("resolved zone is empty; set config.zone or verify challenge resolvedZone")
+
+	// An unknown provider is reported by Create
+	descriptor, _ := s.providerRegistry().Describe(cfg.Provider)
+	raw, err := s.providerCache.getOrCreate(cfg.Provider, rev, func() (providers.DNSProvider, error) {
+		for _, key := range unknownKeys(descriptor, credentials, settings) {
+			klog.Warningf("Provider %s does not read %s, is it misspelled? (known keys: %s)",
+				cfg.Provider, key, strings.Join(descriptor.Keys(), ", "))
+		}
+		return s.providerRegistry().Create(cfg.Provider, providers.ProviderConfig{
+			Credentials: credentials,
+			Settings:    settings,
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create %s provider: %w", cfg.Provider, err)
 	}
 
 	// Determine TTL
@@ -296,58 +679,206 @@ func (s *libdnsSolver) getProvider(ch *v1alpha1.ChallengeRequest) (providers.DNS
 	if cfg.TTL <= 0 {
 		ttl = defaultTTL * time.Second
 	}
-	if cfg.Provider == "desec" && ttl < desecMinTTL*time.Second {
-		klog.Infof("Provider %s requires minimum TTL of %ds, overriding configured TTL to %ds", cfg.Provider, desecMinTTL, desecMinTTL)
-		ttl = desecMinTTL * time.Second
+	if clamped := descriptor.ClampTTL(ttl); clamped != ttl {
+		klog.Infof("Provider %s does not accept a TTL of %s, using %s instead", cfg.Provider, ttl, clamped)
+		ttl = clamped
 	}
 
-	return provider, zone, ttl, nil
+	// Bound and rate limit each attempt, so retries are throttled as well and
+	// a hanging call can be retried within the operation timeout
+	account := cfg.Provider + "|" + credentialFingerprint(credentials)
+	timeouts := newTimeouts(cfg.Timeouts)
+	var provider providers.DNSProvider = newTimeoutProvider(raw, timeouts.call)
+	limiter := s.rateLimiters.get(account, resolveRateLimit(cfg.Provider, cfg.RateLimit))
+	provider = newRateLimitedProvider(provider, cfg.Provider, limiter)
+	provider = newRetryingProvider(provider, cfg.Provider, newRetryPolicy(cfg.Retry))
+
+	// Determine zone: an explicit override wins, then the longest zone the
+	// account hosts, then the zone cert-manager resolved
+	zone := cfg.Zone
+	if _, ok := raw.(libdns.ZoneLister); ok && zone == "" {
+		ctx, cancel := context.WithTimeout(s.baseContext(), timeouts.operation)
+		defer cancel()
+		if zone, err = s.zones.detect(ctx, account, provider, ch.ResolvedFQDN); err != nil {
+			return nil, fmt.Errorf("failed to detect zone of %s: %w", ch.ResolvedFQDN, err)
+		}
+		if normalizeDomain(zone) != normalizeDomain(ch.ResolvedZone) {
+			klog.Infof("Using zone %s hosted by %s for %s instead of resolved zone %s", zone, cfg.Provider, ch.ResolvedFQDN, ch.ResolvedZone)
+		}
+	}
+	if zone == "" {
+		zone = ch.ResolvedZone
+	}
+	// libdns providers expect zone WITHOUT trailing dot
+	zone = strings.TrimSuffix(zone, ".")
+	if zone == "" {
+		return nil, fmt.Errorf("resolved zone is empty; set config.zone or verify challenge resolvedZone")
+	}
+	// Outside the zone the record name would be the whole FQDN
+	if fqdn := strings.TrimSuffix(ch.ResolvedFQDN, "."); fqdn != zone && !strings.HasSuffix(fqdn, "."+zone) {
+		return nil, fmt.Errorf("%s is not in zone %s; set config.zone to a zone that contains it", ch.ResolvedFQDN, zone)
+	}
+
+	return &challengeTarget{
+		provider:     provider,
+		providerName: cfg.Provider,
+		backend:      backendID(ch, cfg),
+		credentials:  credentials,
+		zone:         zone,
+		ttl:          ttl,
+		propagation:  cfg.Propagation,
+		timeouts:     timeouts,
+		capabilities: providers.CapabilitiesOf(raw),
+	}, nil
 }
 
 // loadConfig parses the webhook configuration from JSON
 func loadConfig(cfgJSON *extapi.JSON) (*LibdnsConfig, error) {
+	return loadConfigWithDefaults(cfgJSON, nil)
+}
+
+// loadConfigWithDefaults parses and validates the issuer config on top of
+// the JSON of a default LibdnsConfig: objects and maps are merged, lists and
+// other values in the issuer config replace the defaults
+func loadConfigWithDefaults(cfgJSON *extapi.JSON, defaults []byte) (*LibdnsConfig, error) {
 	cfg := &LibdnsConfig{}
 	if cfgJSON == nil {
 		return nil, fmt.Errorf("no configuration provided")
 	}
-	if err := json.Unmarshal(cfgJSON.Raw, cfg); err != nil {
+	if len(defaults) > 0 {
+		if _, err := kjson.UnmarshalStrict(defaults, cfg); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal cluster defaults: %w", err)
+		}
+	}
+	// Field names are matched case-sensitively, so a misspelled key such as
+	// "secretref" is reported instead of silently filling SecretRef
+	strictErrs, err := kjson.UnmarshalStrict(cfgJSON.Raw, cfg)
+	if err != nil {
 		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
 	}
-	if cfg.Provider == "" {
-		return nil, fmt.Errorf("provider is required in config")
+
+	errs := &configErrors{}
+	for _, err := range strictErrs {
+		errs.add(err)
+	}
+	if cfg.Provider == "" && len(cfg.Routes) == 0 {
+		errs.addf("provider is required in config")
 	}
-	if cfg.SecretRef.Name == "" {
-		return nil, fmt.Errorf("secretRef.name is required in config")
+	if cfg.Provider != "" && cfg.SecretRef.Name == "" {
+		errs.addf("secretRef.name is required in config")
+	}
+	if cfg.MirrorQuorum < 0 {
+		errs.addf("mirrorQuorum must not be negative, got %d", cfg.MirrorQuorum)
+	}
+	validateZone(errs, "", cfg.Zone)
+	validateTTL(errs, "", cfg.TTL)
+	validateSecretRefs(errs, "", cfg.SecretRef, cfg.SecretRefs)
+	validateSettings(errs, "", cfg.Options, cfg.ConfigMapRef)
+	validateRoutes(errs, cfg.Routes, cfg.MirrorQuorum)
+	validateBackends(errs, "fallbacks", cfg.Fallbacks)
+	validateMirrors(errs, "", cfg.Mirrors, cfg.Fallbacks, cfg.MirrorQuorum)
+	cfg.Timeouts.validate(errs)
+	cfg.Retry.validate(errs)
+	cfg.RateLimit.validate(errs)
+	cfg.Propagation.validate(errs)
+	cfg.FollowCNAME.validate(errs)
+	if err := errs.err(); err != nil {
+		return nil, err
 	}
 	return cfg, nil
 }
 
 // loadCredentials fetches credentials from a Kubernetes Secret
-func (s *libdnsSolver) loadCredentials(ch *v1alpha1.ChallengeRequest, cfg *LibdnsConfig) (map[string]string, error) {
+func (s *libdnsSolver) loadCredentials(ch *v1alpha1.ChallengeRequest, cfg *LibdnsConfig) (map[string]string, secretRevision, error) {
 	namespace := cfg.SecretRef.Namespace
 	if namespace == "" {
 		namespace = ch.ResourceNamespace
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
-	secret, err := s.client.CoreV1().Secrets(namespace).Get(
-		ctx,
-		cfg.SecretRef.Name,
-		metav1.GetOptions{},
-	)
+	secret, err := s.getSecret(namespace, cfg.SecretRef.Name, newTimeouts(cfg.Timeouts).secretFetch)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get secret %s/%s: %w", namespace, cfg.SecretRef.Name, err)
+		return nil, secretRevision{}, err
 	}
 
 	credentials := make(map[string]string)
-	for key, value := range secret.Data {
-		credentials[key] = string(value)
+	if err := mergeCredentials(credentials, secret, cfg.SecretRef.Keys); err != nil {
+		return nil, secretRevision{}, err
+	}
+	rev := secretRevision{
+		Namespace:       namespace,
+		Name:            cfg.SecretRef.Name,
+		UID:             secret.UID,
+		ResourceVersion: secret.ResourceVersion,
+	}
+	if len(cfg.SecretRefs) == 0 && len(cfg.SecretRef.Keys) == 0 {
+		klog.V(3).Infof("Loaded %d credential keys from secret", len(credentials))
+		return credentials, rev, nil
+	}
+
+	// Compose further Secrets on top; the revision then covers all of them
+	// and the key mappings, so any change rebuilds the provider
+	sources := []string{secretSourceID(secret, cfg.SecretRef.Keys)}
+	versions := []string{secret.ResourceVersion}
+	for _, ref := range cfg.SecretRefs {
+		refNamespace := ref.Namespace
+		if refNamespace == "" {
+			refNamespace = ch.ResourceNamespace
+		}
+		extra, err := s.getSecret(refNamespace, ref.Name, newTimeouts(cfg.Timeouts).secretFetch)
+		if err != nil {
+			return nil, secretRevision{}, err
+		}
+		if err := mergeCredentials(credentials, extra, ref.Keys); err != nil {
+			return nil, secretRevision{}, err
+		}
+		sources = append(sources, secretSourceID(extra, ref.Keys))
+		versions = append(versions, extra.ResourceVersion)
+	}
+	rev.Sources = strings.Join(sources, ";")
+	rev.ResourceVersion = strings.Join(versions, ",")
+
+	klog.V(3).Infof("Loaded %d credential keys from %d secret(s)", len(credentials), len(sources))
+	return credentials, rev, nil
+}
+
+// getSecret reads a Secret from the informer cache, falling back to a direct
+// GET when the Secret is outside the informer's scope or not yet cached
+func (s *libdnsSolver) getSecret(namespace, name string, timeout time.Duration) (*corev1.Secret, error) {
+	if s.secrets != nil {
+		if secret, ok := s.secrets.get(namespace, name); ok {
+			return secret, nil
+		}
+		klog.V(3).Infof("Secret %s/%s not in informer cache, fetching from API server", namespace, name)
 	}
 
-	klog.V(3).Infof("Loaded %d credential keys from secret", len(credentials))
-	return credentials, nil
+	ctx, cancel := context.WithTimeout(s.baseContext(), timeout)
+	defer cancel()
+
+	secret, err := s.client.CoreV1().Secrets(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get secret %s/%s: %w", namespace, name, err)
+	}
+	return secret, nil
+}
+
+// existingTXT converts a TXT record returned by GetRecords into a libdns.TXT,
+// keeping its TTL and provider data. fallbackTTL is used when the provider
+// does not report a TTL.
+func existingTXT(rec libdns.Record, fallbackTTL time.Duration) libdns.TXT {
+	var txt libdns.TXT
+	switch r := rec.(type) {
+	case libdns.TXT:
+		txt = r
+	case *libdns.TXT:
+		txt = *r
+	default:
+		rr := rec.RR()
+		txt = libdns.TXT{Name: rr.Name, TTL: rr.TTL, Text: rr.Data}
+	}
+	if txt.TTL <= 0 {
+		txt.TTL = fallbackTTL
+	}
+	return txt
 }
 
 // extractRecordName removes the zone suffix from FQDN to get the relative record name
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"k8s.io/klog/v2"
+)
+
+// validateMirrors checks the mirror backends under prefix, that they are not
+// combined with fallbacks and that the quorum can be reached
+func validateMirrors(errs *configErrors, prefix string, mirrors, fallbacks []BackendConfig, quorum int) {
+	if len(mirrors) == 0 {
+		return
+	}
+	validateBackends(errs, prefix+"mirrors", mirrors)
+	if len(fallbacks) > 0 {
+		errs.addf("%smirrors and %sfallbacks cannot be combined", prefix, prefix)
+	}
+	if quorum > len(mirrors)+1 {
+		errs.addf("mirrorQuorum (%d) exceeds the %d providers in %smirrors and the provider", quorum, len(mirrors)+1, prefix)
+	}
+}
+
+// mirrors returns the primary configuration followed by one per mirror
+func (cfg *LibdnsConfig) mirrors() []*LibdnsConfig {
+	mirrors := []*LibdnsConfig{cfg}
+	for _, m := range cfg.Mirrors {
+		mirrors = append(mirrors, cfg.withBackend(m))
+	}
+	return mirrors
+}
+
+// quorum returns how many mirrors must succeed
+func (cfg *LibdnsConfig) quorum() int {
+	if cfg.MirrorQuorum > 0 {
+		return cfg.MirrorQuorum
+	}
+	return len(cfg.Mirrors) + 1
+}
+
+// forEachMirror runs op against every mirror in parallel. It returns the
+// targets op succeeded on, in configuration order, and the errors of the
+// others prefixed with their backend.
+func (s *libdnsSolver) forEachMirror(ch *v1alpha1.ChallengeRequest, mirrors []*LibdnsConfig, op func(*challengeTarget) error) ([]*challengeTarget, []error) {
+	targets := make([]*challengeTarget, len(mirrors))
+	errs := make([]error, len(mirrors))
+
+	var wg sync.WaitGroup
+	for i, mirror := range mirrors {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			target, err := s.buildTarget(ch, mirror)
+			if err != nil {
+				errs[i] = fmt.Errorf("%s: failed to get provider: %w", backendID(ch, mirror), err)
+				return
+			}
+			if err := op(target); err != nil {
+				errs[i] = fmt.Errorf("%s: %w", backendID(ch, mirror), err)
+				return
+			}
+			targets[i] = target
+		}()
+	}
+	wg.Wait()
+
+	var succeeded []*challengeTarget
+	var failed []error
+	for i := range mirrors {
+		if errs[i] != nil {
+			failed = append(failed, errs[i])
+		} else {
+			succeeded = append(succeeded, targets[i])
+		}
+	}
+	return succeeded, failed
+}
+
+// presentMirrored writes the challenge value to the provider and its mirrors
+// and succeeds once the quorum accepted it
+func (s *libdnsSolver) presentMirrored(ch *v1alpha1.ChallengeRequest, cfg *LibdnsConfig) error {
+	mirrors := cfg.mirrors()
+	succeeded, errs := s.forEachMirror(ch, mirrors, func(target *challengeTarget) error {
+		recordName := extractRecordName(ch.ResolvedFQDN, target.zone)
+		klog.V(2).Infof("Creating mirrored TXT record: provider=%s name=%s zone=%s ttl=%s", target.providerName, recordName, target.zone, target.ttl)
+
+		ctx, cancel := context.WithTimeout(s.baseContext(), target.timeouts.operation)
+		defer cancel()
+		return s.presentRecord(ctx, target, recordName, ch.Key)
+	})
+
+	if quorum := cfg.quorum(); len(succeeded) < quorum {
+		return fmt.Errorf("mirrored to %d of %d providers, %d required: %w", len(succeeded), len(mirrors), quorum, errors.Join(errs...))
+	}
+	if len(errs) > 0 {
+		klog.Warningf("Mirrored %s to %d of %d providers: %v", ch.ResolvedFQDN, len(succeeded), len(mirrors), errors.Join(errs...))
+	}
+
+	// All mirrors publish the same zone, so one check covers every nameserver
+	target := succeeded[0]
+	if target.propagation != nil {
+		if err := waitForPropagation(s.baseContext(), target.propagation, ch.ResolvedFQDN, target.zone, ch.Key); err != nil {
+			return fmt.Errorf("propagation check failed: %w", err)
+		}
+	}
+	return nil
+}
+
+// cleanUpMirrored removes the challenge value from the provider and all mirrors
+func (s *libdnsSolver) cleanUpMirrored(ch *v1alpha1.ChallengeRequest, cfg *LibdnsConfig) error {
+	mirrors := cfg.mirrors()
+	_, errs := s.forEachMirror(ch, mirrors, func(target *challengeTarget) error {
+		_, err := s.cleanUpTarget(ch, target)
+		return err
+	})
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to clean up on %d of %d providers: %w", len(errs), len(mirrors), errors.Join(errs...))
+	}
+	return nil
+}
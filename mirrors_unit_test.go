@@ -0,0 +1,227 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cert-manager-webhook-libdns/providers"
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// mirrorTestSetup registers two healthy providers and one failing every call
+// with a permanent error, and returns a solver and a challenge mirroring the
+// value across all three
+func mirrorTestSetup(t *testing.T, quorum int) (*libdnsSolver, *v1alpha1.ChallengeRequest, []*mockProvider) {
+	t.Helper()
+	healthy := []*mockProvider{{}, {}}
+	broken := newFlakyProvider(&mockProvider{}, map[string][]error{
+		// Present reads and fails to set; CleanUp fails to read and to delete
+		"GetRecords":    {nil, &statusError{code: 401}},
+		"SetRecords":    {&statusError{code: 401}},
+		"DeleteRecords": {&statusError{code: 401}},
+	})
+	names := []string{"a", "b", "broken"}
+	registry := providers.NewRegistry()
+	registerMockProvider(t, registry, names[0], healthy[0])
+	registerMockProvider(t, registry, names[1], healthy[1])
+	registerProvider(t, registry, names[2], broken)
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "dns-creds", Namespace: "cert-manager"},
+		Data:       map[string][]byte{"api_token": []byte("dummy")},
+	}
+	solver := &libdnsSolver{client: fake.NewSimpleClientset(secret), registry: registry}
+
+	ch := &v1alpha1.ChallengeRequest{
+		ResolvedFQDN:      "_acme-challenge.example.com.",
+		ResolvedZone:      "example.com.",
+		Key:               "mirrored-key",
+		ResourceNamespace: "cert-manager",
+		Config: routesConfigJSON(t, LibdnsConfig{
+			Provider:  names[0],
+			SecretRef: SecretReference{Name: "dns-creds"},
+			Retry:     fastRetry(1),
+			Mirrors: []BackendConfig{
+				{Provider: names[1], SecretRef: SecretReference{Name: "dns-creds"}},
+				{Provider: names[2], SecretRef: SecretReference{Name: "dns-creds"}},
+			},
+			MirrorQuorum: quorum,
+		}),
+	}
+	return solver, ch, healthy
+}
+
+func TestLoadConfigValidatesMirrors(t *testing.T) {
+	mirror := BackendConfig{Provider: "cloudflare", SecretRef: SecretReference{Name: "cf"}}
+	tests := []struct {
+		name    string
+		cfg     LibdnsConfig
+		wantErr string
+	}{
+		{
+			name:    "mirror without provider",
+			cfg:     LibdnsConfig{Provider: "desec", SecretRef: SecretReference{Name: "desec"}, Mirrors: []BackendConfig{{SecretRef: SecretReference{Name: "cf"}}}},
+			wantErr: "mirrors[0].provider is required",
+		},
+		{
+			name: "mirrors with fallbacks",
+			cfg: LibdnsConfig{
+				Provider: "desec", SecretRef: SecretReference{Name: "desec"},
+				Mirrors: []BackendConfig{mirror}, Fallbacks: []BackendConfig{mirror},
+			},
+			wantErr: "mirrors and fallbacks cannot be combined",
+		},
+		{
+			name:    "quorum above provider count",
+			cfg:     LibdnsConfig{Provider: "desec", SecretRef: SecretReference{Name: "desec"}, Mirrors: []BackendConfig{mirror}, MirrorQuorum: 3},
+			wantErr: "mirrorQuorum (3) exceeds the 2 providers",
+		},
+		{
+			name:    "negative quorum",
+			cfg:     LibdnsConfig{Provider: "desec", SecretRef: SecretReference{Name: "desec"}, MirrorQuorum: -1},
+			wantErr: "mirrorQuorum must not be negative",
+		},
+		{
+			name: "route quorum above provider count",
+			cfg: LibdnsConfig{
+				MirrorQuorum: 3,
+				Routes: []RouteConfig{{
+					Domain: "example.com", Provider: "desec", SecretRef: SecretReference{Name: "desec"},
+					Mirrors: []BackendConfig{mirror},
+				}},
+			},
+			wantErr: "exceeds the 2 providers in routes[0].mirrors",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := loadConfig(routesConfigJSON(t, tc.cfg))
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestPresentMirroredRequiresAllByDefault(t *testing.T) {
+	solver, ch, healthy := mirrorTestSetup(t, 0)
+
+	err := solver.Present(ch)
+	if err == nil || !strings.Contains(err.Error(), "mirrored to 2 of 3 providers, 3 required") {
+		t.Fatalf("expected a quorum failure, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "broken|cert-manager/dns-creds: ") {
+		t.Fatalf("expected the error to name the failing backend, got %v", err)
+	}
+	// The healthy mirrors were still written to in parallel
+	for i, mp := range healthy {
+		if values := txtValuesForName(mp.records, "_acme-challenge"); len(values) != 1 || values[0] != "mirrored-key" {
+			t.Fatalf("expected mirror %d to receive [mirrored-key], got %v", i, values)
+		}
+	}
+}
+
+func TestPresentMirroredSucceedsWithQuorum(t *testing.T) {
+	solver, ch, healthy := mirrorTestSetup(t, 2)
+
+	if err := solver.Present(ch); err != nil {
+		t.Fatalf("Present failed: %v", err)
+	}
+	for i, mp := range healthy {
+		if values := txtValuesForName(mp.records, "_acme-challenge"); len(values) != 1 || values[0] != "mirrored-key" {
+			t.Fatalf("expected mirror %d to receive [mirrored-key], got %v", i, values)
+		}
+	}
+}
+
+func TestCleanUpMirroredAggregatesErrors(t *testing.T) {
+	solver, ch, healthy := mirrorTestSetup(t, 2)
+	if err := solver.Present(ch); err != nil {
+		t.Fatalf("Present failed: %v", err)
+	}
+
+	err := solver.CleanUp(ch)
+	if err == nil || !strings.Contains(err.Error(), "failed to clean up on 1 of 3 providers") {
+		t.Fatalf("expected an aggregated CleanUp failure, got %v", err)
+	}
+	for i, mp := range healthy {
+		if values := txtValuesForName(mp.records, "_acme-challenge"); len(values) != 0 {
+			t.Fatalf("expected the value to be removed from mirror %d, got %v", i, values)
+		}
+	}
+}
+
+func TestPresentMirroredAcrossReplicasKeepsAllTXTValues(t *testing.T) {
+	primary := &mockProvider{getDelay: 2 * time.Millisecond}
+	mirror := &mockProvider{getDelay: 2 * time.Millisecond}
+	registry := providers.NewRegistry()
+	registerMockProvider(t, registry, "primary", primary)
+	registerMockProvider(t, registry, "mirror", mirror)
+
+	client := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "dns-creds", Namespace: "cert-manager"},
+		Data:       map[string][]byte{"api_token": []byte("dummy")},
+	})
+	// Each replica writes both mirrors in parallel while the other competes
+	// for the same records
+	replicas := []*libdnsSolver{
+		{client: client, registry: registry, leases: newTestLeaseLocker(client, "replica-a")},
+		{client: client, registry: registry, leases: newTestLeaseLocker(client, "replica-b")},
+	}
+	config := routesConfigJSON(t, LibdnsConfig{
+		Provider:  "primary",
+		SecretRef: SecretReference{Name: "dns-creds"},
+		Mirrors:   []BackendConfig{{Provider: "mirror", SecretRef: SecretReference{Name: "dns-creds"}}},
+	})
+
+	const perReplica = 4
+	var wg sync.WaitGroup
+	errs := make(chan error, perReplica*len(replicas))
+	for r, solver := range replicas {
+		for i := range perReplica {
+			wg.Go(func() {
+				errs <- solver.Present(&v1alpha1.ChallengeRequest{
+					ResolvedFQDN:      "_acme-challenge.example.com.",
+					ResolvedZone:      "example.com.",
+					Key:               fmt.Sprintf("replica-%d-%d", r, i),
+					ResourceNamespace: "cert-manager",
+					Config:            config,
+				})
+			})
+		}
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Present failed: %v", err)
+		}
+	}
+
+	for name, mp := range map[string]*mockProvider{"primary": primary, "mirror": mirror} {
+		values := txtValuesForName(mp.records, "_acme-challenge")
+		if len(values) != perReplica*len(replicas) {
+			t.Fatalf("expected %d TXT values at %s, got %v", perReplica*len(replicas), name, values)
+		}
+	}
+
+	// The mirrors hold separate Leases, so neither releases the other's
+	leases := map[string]bool{}
+	for _, action := range client.Actions() {
+		if create, ok := action.(k8stesting.CreateAction); ok && action.GetResource().Resource == "leases" {
+			leases[create.GetObject().(*coordinationv1.Lease).Name] = true
+		}
+	}
+	if len(leases) != 2 {
+		t.Fatalf("expected one Lease per mirror, got %v", leases)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// placementConfigMapName is the ConfigMap persisting placements
+	placementConfigMapName = "libdns-webhook-placements"
+
+	// placementMaxAge drops placements whose challenge was never cleaned up
+	placementMaxAge = 7 * 24 * time.Hour
+)
+
+// placement records the backend that received a challenge value
+type placement struct {
+	Backend string    `json:"backend"`
+	FQDN    string    `json:"fqdn"`
+	Time    time.Time `json:"time"`
+}
+
+// placementStore remembers which fallback backend received a challenge value,
+// so CleanUp removes it from there. Placements are kept in memory and, when a
+// namespace is configured, in a ConfigMap that survives restarts and is shared
+// by all replicas. The zero value keeps placements in memory only.
+type placementStore struct {
+	mu      sync.Mutex
+	entries map[string]placement
+
+	client    kubernetes.Interface
+	namespace string
+}
+
+// placementKey identifies a challenge value; ConfigMap keys allow only
+// alphanumerics, '-', '_' and '.'
+func placementKey(fqdn, key string) string {
+	sum := sha256.Sum256([]byte(fqdn + "\x00" + key))
+	return hex.EncodeToString(sum[:16])
+}
+
+// record remembers that backend received the value for key
+func (p *placementStore) record(ctx context.Context, key string, entry placement) error {
+	p.mu.Lock()
+	if p.entries == nil {
+		p.entries = make(map[string]placement)
+	}
+	p.entries[key] = entry
+	p.mu.Unlock()
+
+	if p.client == nil {
+		return nil
+	}
+	value, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return p.update(ctx, func(data map[string]string) {
+		data[key] = string(value)
+		pruneExpired(data, entry.Time)
+	})
+}
+
+// lookup returns the recorded placement for key, if any
+func (p *placementStore) lookup(ctx context.Context, key string) (placement, bool) {
+	p.mu.Lock()
+	entry, ok := p.entries[key]
+	p.mu.Unlock()
+	if ok || p.client == nil {
+		return entry, ok
+	}
+
+	cm, err := p.client.CoreV1().ConfigMaps(p.namespace).Get(ctx, placementConfigMapName, metav1.GetOptions{})
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			klog.Warningf("Failed to read placements from %s/%s: %v", p.namespace, placementConfigMapName, err)
+		}
+		return placement{}, false
+	}
+	raw, ok := cm.Data[key]
+	if !ok {
+		return placement{}, false
+	}
+	if err := json.Unmarshal([]byte(raw), &entry); err != nil {
+		klog.Warningf("Ignoring malformed placement %s: %v", key, err)
+		return placement{}, false
+	}
+	return entry, true
+}
+
+// forget drops the placement for key once the value has been cleaned up
+func (p *placementStore) forget(ctx context.Context, key string) error {
+	p.mu.Lock()
+	delete(p.entries, key)
+	p.mu.Unlock()
+
+	if p.client == nil {
+		return nil
+	}
+	return p.update(ctx, func(data map[string]string) {
+		delete(data, key)
+	})
+}
+
+// update applies mutate to the placement ConfigMap, creating it if needed
+func (p *placementStore) update(ctx context.Context, mutate func(map[string]string)) error {
+	configMaps := p.client.CoreV1().ConfigMaps(p.namespace)
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		cm, err := configMaps.Get(ctx, placementConfigMapName, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			cm = &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: placementConfigMapName, Namespace: p.namespace},
+				Data:       map[string]string{},
+			}
+			mutate(cm.Data)
+			_, err = configMaps.Create(ctx, cm, metav1.CreateOptions{})
+			if apierrors.IsAlreadyExists(err) {
+				// Another replica created it first; retry as an update
+				return apierrors.NewConflict(corev1.Resource("configmaps"), placementConfigMapName, err)
+			}
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		if cm.Data == nil {
+			cm.Data = map[string]string{}
+		}
+		mutate(cm.Data)
+		_, err = configMaps.Update(ctx, cm, metav1.UpdateOptions{})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update placements in %s/%s: %w", p.namespace, placementConfigMapName, err)
+	}
+	return nil
+}
+
+// pruneExpired drops placements older than placementMaxAge
+func pruneExpired(data map[string]string, now time.Time) {
+	for key, raw := range data {
+		var entry placement
+		if err := json.Unmarshal([]byte(raw), &entry); err != nil || now.Sub(entry.Time) > placementMaxAge {
+			delete(data, key)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+// Command example is a DNS provider plugin keeping records in memory. It
+// shows how to serve a libdns provider with the plugin SDK and backs the
+// end-to-end tests of the plugin provider.
+//
+// Like a real provider it requires an api_token credential, which shows how
+// credentials reach the plugin.
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+
+	"github.com/libdns/libdns"
+
+	"github.com/cert-manager-webhook-libdns/plugin"
+)
+
+func main() {
+	plugin.Main(func(credentials, _ map[string]string) (any, error) {
+		if credentials["api_token"] == "" {
+			return nil, errors.New("api_token is required")
+		}
+		return &memoryProvider{zones: make(map[string][]libdns.RR)}, nil
+	})
+}
+
+// memoryProvider implements the libdns record interfaces on a map of zones
+type memoryProvider struct {
+	mu    sync.Mutex
+	zones map[string][]libdns.RR
+}
+
+func (p *memoryProvider) GetRecords(_ context.Context, zone string) ([]libdns.Record, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return records(p.zones[zone]), nil
+}
+
+func (p *memoryProvider) AppendRecords(_ context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, rec := range recs {
+		p.zones[zone] = append(p.zones[zone], rec.RR())
+	}
+	return recs, nil
+}
+
+// SetRecords replaces the records of every name and type in recs
+func (p *memoryProvider) SetRecords(_ context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, rec := range recs {
+		rr := rec.RR()
+		p.zones[zone] = slices.DeleteFunc(p.zones[zone], func(existing libdns.RR) bool {
+			return existing.Name == rr.Name && existing.Type == rr.Type
+		})
+	}
+	for _, rec := range recs {
+		p.zones[zone] = append(p.zones[zone], rec.RR())
+	}
+	return recs, nil
+}
+
+// DeleteRecords removes the matching records; an empty type or data matches
+// any
+func (p *memoryProvider) DeleteRecords(_ context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var deleted []libdns.RR
+	for _, rec := range recs {
+		rr := rec.RR()
+		p.zones[zone] = slices.DeleteFunc(p.zones[zone], func(existing libdns.RR) bool {
+			match := existing.Name == rr.Name &&
+				(rr.Type == "" || existing.Type == rr.Type) &&
+				(rr.Data == "" || existing.Data == rr.Data)
+			if match {
+				deleted = append(deleted, existing)
+			}
+			return match
+		})
+	}
+	return records(deleted), nil
+}
+
+func records(rrs []libdns.RR) []libdns.Record {
+	out := make([]libdns.Record, 0, len(rrs))
+	for _, rr := range rrs {
+		out = append(out, rr)
+	}
+	return out
+}
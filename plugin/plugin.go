@@ -0,0 +1,281 @@
+// Package plugin serves a libdns provider as an out-of-process DNS provider
+// plugin of the webhook.
+//
+// A plugin is a program whose main function calls Main with a Factory:
+//
+//	func main() {
+//		plugin.Main(func(credentials, settings map[string]string) (any, error) {
+//			return &example.Provider{APIToken: credentials["api_token"]}, nil
+//		})
+//	}
+//
+// Launched by the webhook, the plugin listens on a Unix socket in a private
+// temporary directory, announces it on stdout and exits when its stdin is
+// closed. With LIBDNS_PLUGIN_ADDRESS set it listens on that address instead,
+// e.g. as a sidecar, until it receives SIGINT or SIGTERM. A TCP address is
+// served with TLS, using the certificate in LIBDNS_PLUGIN_TLS_CERT and
+// LIBDNS_PLUGIN_TLS_KEY.
+package plugin
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/libdns/libdns"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/cert-manager-webhook-libdns/plugin/protocol"
+	"github.com/cert-manager-webhook-libdns/providers/records"
+)
+
+// AddressEnv names the environment variable with the address a standalone
+// plugin listens on, unix:///path/to/socket or host:port
+const AddressEnv = "LIBDNS_PLUGIN_ADDRESS"
+
+// TLSCertEnv and TLSKeyEnv name the environment variables with the PEM
+// certificate and key files a plugin listening on TCP serves TLS with
+const (
+	TLSCertEnv = "LIBDNS_PLUGIN_TLS_CERT"
+	TLSKeyEnv  = "LIBDNS_PLUGIN_TLS_KEY"
+)
+
+// Factory creates a provider from the credentials and settings of a
+// handshake. The provider implements any of libdns.RecordGetter,
+// RecordAppender, RecordSetter and RecordDeleter, and optionally
+// records.RecordLookup.
+type Factory func(credentials, settings map[string]string) (any, error)
+
+// Main serves factory and exits the process when serving fails
+func Main(factory Factory) {
+	if err := Serve(factory); err != nil {
+		log.Fatalf("plugin: %v", err)
+	}
+}
+
+// Serve serves factory until the webhook closes stdin, or with AddressEnv
+// set until the process is interrupted
+func Serve(factory Factory) error {
+	address := os.Getenv(AddressEnv)
+	var opts []grpc.ServerOption
+	if address != "" && !strings.HasPrefix(address, "unix://") {
+		creds, err := serverTLS(os.Getenv(TLSCertEnv), os.Getenv(TLSKeyEnv))
+		if err != nil {
+			return err
+		}
+		opts = append(opts, grpc.Creds(creds))
+	}
+	srv := grpc.NewServer(opts...)
+	protocol.RegisterProviderServer(srv, NewServer(factory))
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		srv.GracefulStop()
+	}()
+
+	if address != "" {
+		lis, err := listen(address)
+		if err != nil {
+			return err
+		}
+		return srv.Serve(lis)
+	}
+
+	dir, err := os.MkdirTemp("", "libdns-plugin-")
+	if err != nil {
+		return fmt.Errorf("creating socket directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "plugin.sock")
+	lis, err := net.Listen("unix", socket)
+	if err != nil {
+		return fmt.Errorf("listening on %s: %w", socket, err)
+	}
+
+	// The webhook holds our stdin open for as long as it runs
+	go func() {
+		_, _ = io.Copy(io.Discard, bufio.NewReader(os.Stdin))
+		srv.GracefulStop()
+	}()
+
+	fmt.Println(protocol.Announce("unix://" + socket))
+	return srv.Serve(lis)
+}
+
+// serverTLS loads the certificate a plugin serves TCP connections with; the
+// webhook sends credentials over them and refuses plaintext TCP
+func serverTLS(certFile, keyFile string) (credentials.TransportCredentials, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, fmt.Errorf("listening on TCP requires %s and %s", TLSCertEnv, TLSKeyEnv)
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading TLS certificate: %w", err)
+	}
+	return credentials.NewTLS(&tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}), nil
+}
+
+// listen opens a Unix socket for unix:// addresses and a TCP listener otherwise
+func listen(address string) (net.Listener, error) {
+	if path, ok := strings.CutPrefix(address, "unix://"); ok {
+		return net.Listen("unix", path)
+	}
+	return net.Listen("tcp", address)
+}
+
+// Server implements the plugin protocol for providers created by a Factory
+type Server struct {
+	factory Factory
+
+	mu       sync.Mutex
+	sessions map[string]any
+}
+
+// NewServer returns a Server creating providers with factory
+func NewServer(factory Factory) *Server {
+	return &Server{factory: factory, sessions: make(map[string]any)}
+}
+
+// Handshake creates a provider, or reuses the one created for the same
+// credentials and settings, and reports its capabilities
+func (s *Server) Handshake(_ context.Context, req *protocol.HandshakeRequest) (*protocol.HandshakeResponse, error) {
+	if req.ProtocolVersion != protocol.Version {
+		return nil, status.Errorf(codes.FailedPrecondition, "plugin speaks protocol version %d, got %d", protocol.Version, req.ProtocolVersion)
+	}
+
+	session := sessionID(req.Credentials, req.Settings)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	provider, ok := s.sessions[session]
+	if !ok {
+		var err error
+		if provider, err = s.factory(req.Credentials, req.Settings); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		s.sessions[session] = provider
+	}
+
+	caps := records.CapabilitiesOf(provider)
+	return &protocol.HandshakeResponse{
+		ProtocolVersion: protocol.Version,
+		Session:         session,
+		Capabilities:    protocol.Capabilities{Get: caps.Get, Append: caps.Append, Set: caps.Set, Delete: caps.Delete},
+	}, nil
+}
+
+// GetRecords lists a zone, or the records of one name and type
+func (s *Server) GetRecords(ctx context.Context, req *protocol.GetRecordsRequest) (*protocol.RecordsResponse, error) {
+	provider, err := s.provider(req.Session)
+	if err != nil {
+		return nil, err
+	}
+	if req.Name != "" || req.Type != "" {
+		recs, err := records.GetRecordsByName(ctx, provider, req.Zone, req.Name, req.Type)
+		return respond(ctx, recs, err)
+	}
+	recs, err := records.GetRecords(ctx, provider, req.Zone)
+	return respond(ctx, recs, err)
+}
+
+// AppendRecords adds records to a zone
+func (s *Server) AppendRecords(ctx context.Context, req *protocol.RecordsRequest) (*protocol.RecordsResponse, error) {
+	provider, err := s.provider(req.Session)
+	if err != nil {
+		return nil, err
+	}
+	recs, err := records.AppendRecords(ctx, provider, req.Zone, protocol.ToLibdns(req.Records))
+	return respond(ctx, recs, err)
+}
+
+// SetRecords sets records in a zone
+func (s *Server) SetRecords(ctx context.Context, req *protocol.RecordsRequest) (*protocol.RecordsResponse, error) {
+	provider, err := s.provider(req.Session)
+	if err != nil {
+		return nil, err
+	}
+	recs, err := records.SetRecords(ctx, provider, req.Zone, protocol.ToLibdns(req.Records))
+	return respond(ctx, recs, err)
+}
+
+// DeleteRecords removes records from a zone
+func (s *Server) DeleteRecords(ctx context.Context, req *protocol.RecordsRequest) (*protocol.RecordsResponse, error) {
+	provider, err := s.provider(req.Session)
+	if err != nil {
+		return nil, err
+	}
+	recs, err := records.DeleteRecords(ctx, provider, req.Zone, protocol.ToLibdns(req.Records))
+	return respond(ctx, recs, err)
+}
+
+// provider returns the provider of a session; a restarted plugin has none,
+// which tells the webhook to repeat the handshake
+func (s *Server) provider(session string) (any, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	provider, ok := s.sessions[session]
+	if !ok {
+		return nil, status.Error(codes.NotFound, "unknown session")
+	}
+	return provider, nil
+}
+
+// respond converts the result of a provider call to a response, passing
+// the status code and Retry-After hint of errors in the trailer
+func respond(ctx context.Context, recs []libdns.Record, err error) (*protocol.RecordsResponse, error) {
+	if err == nil {
+		return &protocol.RecordsResponse{Records: protocol.FromLibdns(recs)}, nil
+	}
+	if errors.Is(err, records.ErrUnsupported) {
+		return nil, status.Error(codes.Unimplemented, err.Error())
+	}
+
+	trailer := metadata.MD{}
+	var sc interface{ StatusCode() int }
+	if errors.As(err, &sc) && sc.StatusCode() != 0 {
+		trailer.Set(protocol.StatusCodeTrailer, strconv.Itoa(sc.StatusCode()))
+	}
+	var ra interface{ RetryAfter() time.Duration }
+	if errors.As(err, &ra) && ra.RetryAfter() > 0 {
+		trailer.Set(protocol.RetryAfterTrailer, strconv.Itoa(int(ra.RetryAfter().Seconds())))
+	}
+	if len(trailer) > 0 {
+		_ = grpc.SetTrailer(ctx, trailer)
+	}
+	return nil, status.Error(codes.Unknown, err.Error())
+}
+
+// sessionID derives a stable session from credentials and settings, so a
+// handshake repeated after a restart of the webhook reuses the provider
+func sessionID(credentials, settings map[string]string) string {
+	h := sha256.New()
+	for _, m := range []map[string]string{credentials, settings} {
+		for _, k := range slices.Sorted(maps.Keys(m)) {
+			fmt.Fprintf(h, "%q=%q\n", k, m[k])
+		}
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
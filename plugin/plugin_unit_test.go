@@ -0,0 +1,166 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/cert-manager-webhook-libdns/plugin/protocol"
+)
+
+// apiError carries HTTP details like the errors of provider API clients
+type apiError struct{}
+
+func (apiError) Error() string             { return "too many requests" }
+func (apiError) StatusCode() int           { return 429 }
+func (apiError) RetryAfter() time.Duration { return 30 * time.Second }
+
+// appendOnlyProvider appends records and fails once full
+type appendOnlyProvider struct {
+	token   string
+	records []libdns.Record
+}
+
+func (p *appendOnlyProvider) AppendRecords(_ context.Context, _ string, recs []libdns.Record) ([]libdns.Record, error) {
+	if len(p.records) > 0 {
+		return nil, apiError{}
+	}
+	p.records = append(p.records, recs...)
+	return recs, nil
+}
+
+// serve starts a Server for factory and returns a client for it
+func serve(t *testing.T, factory Factory) *protocol.ProviderClient {
+	t.Helper()
+	socket := filepath.Join(t.TempDir(), "plugin.sock")
+	lis, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	srv := grpc.NewServer()
+	protocol.RegisterProviderServer(srv, NewServer(factory))
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+
+	cc, err := grpc.NewClient("unix://"+socket, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { _ = cc.Close() })
+	return protocol.NewProviderClient(cc)
+}
+
+func TestHandshakeReusesProviderForSameConfig(t *testing.T) {
+	created := 0
+	client := serve(t, func(credentials, _ map[string]string) (any, error) {
+		created++
+		if credentials["api_token"] == "" {
+			return nil, errors.New("api_token is required")
+		}
+		return &appendOnlyProvider{token: credentials["api_token"]}, nil
+	})
+	ctx := context.Background()
+
+	req := &protocol.HandshakeRequest{ProtocolVersion: protocol.Version, Credentials: map[string]string{"api_token": "a"}}
+	first, err := client.Handshake(ctx, req)
+	if err != nil {
+		t.Fatalf("Handshake failed: %v", err)
+	}
+	if first.Capabilities != (protocol.Capabilities{Append: true}) {
+		t.Fatalf("expected append only, got %+v", first.Capabilities)
+	}
+	second, err := client.Handshake(ctx, req)
+	if err != nil || second.Session != first.Session || created != 1 {
+		t.Fatalf("expected the session to be reused, got %q and %q after %d providers (%v)", first.Session, second.Session, created, err)
+	}
+
+	other, err := client.Handshake(ctx, &protocol.HandshakeRequest{ProtocolVersion: protocol.Version, Credentials: map[string]string{"api_token": "b"}})
+	if err != nil || other.Session == first.Session {
+		t.Fatalf("expected a new session for other credentials, got %q (%v)", other.Session, err)
+	}
+
+	_, err = client.Handshake(ctx, &protocol.HandshakeRequest{ProtocolVersion: protocol.Version})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("expected InvalidArgument for a failing factory, got %v", err)
+	}
+	_, err = client.Handshake(ctx, &protocol.HandshakeRequest{ProtocolVersion: protocol.Version + 1})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("expected FailedPrecondition for another protocol version, got %v", err)
+	}
+}
+
+func TestServerMapsProviderResults(t *testing.T) {
+	client := serve(t, func(map[string]string, map[string]string) (any, error) {
+		return &appendOnlyProvider{}, nil
+	})
+	ctx := context.Background()
+
+	hs, err := client.Handshake(ctx, &protocol.HandshakeRequest{ProtocolVersion: protocol.Version})
+	if err != nil {
+		t.Fatalf("Handshake failed: %v", err)
+	}
+
+	records := []protocol.Record{{Name: "_acme-challenge", Type: "TXT", Data: "token", TTL: 60}}
+	res, err := client.AppendRecords(ctx, &protocol.RecordsRequest{Session: hs.Session, Zone: "example.com.", Records: records})
+	if err != nil || len(res.Records) != 1 || res.Records[0] != records[0] {
+		t.Fatalf("expected the appended record, got %+v (%v)", res, err)
+	}
+
+	var trailer metadata.MD
+	_, err = client.AppendRecords(ctx, &protocol.RecordsRequest{Session: hs.Session, Zone: "example.com.", Records: records}, grpc.Trailer(&trailer))
+	if status.Code(err) != codes.Unknown {
+		t.Fatalf("expected Unknown for a provider error, got %v", err)
+	}
+	if got := trailer.Get(protocol.StatusCodeTrailer); len(got) != 1 || got[0] != "429" {
+		t.Fatalf("expected status code 429 in the trailer, got %v", trailer)
+	}
+	if got := trailer.Get(protocol.RetryAfterTrailer); len(got) != 1 || got[0] != "30" {
+		t.Fatalf("expected retry after 30 in the trailer, got %v", trailer)
+	}
+
+	_, err = client.SetRecords(ctx, &protocol.RecordsRequest{Session: hs.Session, Zone: "example.com.", Records: records})
+	if status.Code(err) != codes.Unimplemented {
+		t.Fatalf("expected Unimplemented for an unsupported operation, got %v", err)
+	}
+	_, err = client.DeleteRecords(ctx, &protocol.RecordsRequest{Session: "unknown", Zone: "example.com.", Records: records})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("expected NotFound for an unknown session, got %v", err)
+	}
+}
+
+func TestServeRequiresTLSOnTCP(t *testing.T) {
+	t.Setenv(AddressEnv, "127.0.0.1:0")
+	t.Setenv(TLSCertEnv, "")
+	t.Setenv(TLSKeyEnv, "")
+	err := Serve(func(map[string]string, map[string]string) (any, error) { return nil, nil })
+	if err == nil || !strings.Contains(err.Error(), "listening on TCP requires "+TLSCertEnv) {
+		t.Fatalf("expected Serve to refuse plaintext TCP, got %v", err)
+	}
+}
+
+func TestSDKDoesNotLinkProviders(t *testing.T) {
+	if testing.Short() {
+		t.Skip("listing dependencies is skipped in short mode")
+	}
+	out, err := exec.Command("go", "list", "-deps", ".").CombinedOutput()
+	if err != nil {
+		t.Fatalf("go list failed: %v\n%s", err, out)
+	}
+	for dep := range strings.Lines(string(out)) {
+		if strings.TrimSpace(dep) == "github.com/cert-manager-webhook-libdns/providers" {
+			t.Fatal("expected the plugin SDK not to depend on the providers package")
+		}
+	}
+}
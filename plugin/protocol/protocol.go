@@ -0,0 +1,246 @@
+// Package protocol defines the gRPC protocol between the webhook and
+// out-of-process DNS provider plugins.
+//
+// The service mirrors the provider operations of the webhook: a handshake
+// passes credentials and settings and opens a session, then GetRecords,
+// AppendRecords, SetRecords and DeleteRecords act on a zone within that
+// session. Messages are JSON encoded with the gRPC content subtype "json"
+// (content type application/grpc+json), so plugins in other languages need
+// no generated code.
+package protocol
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/libdns/libdns"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+)
+
+// Version is the protocol version exchanged in the handshake
+const Version = 1
+
+// ServiceName is the full gRPC service name of a plugin
+const ServiceName = "libdns.plugin.v1.Provider"
+
+// AnnouncePrefix starts the line a launched plugin writes to stdout once it
+// listens, followed by the protocol version and its gRPC target:
+//
+//	libdns-plugin 1 unix:///tmp/libdns-plugin-123/plugin.sock
+const AnnouncePrefix = "libdns-plugin"
+
+// Trailer keys carrying details of a failed provider call
+const (
+	// StatusCodeTrailer holds the HTTP status code of a provider API error
+	StatusCodeTrailer = "libdns-status-code"
+
+	// RetryAfterTrailer holds the seconds the provider API asked to wait
+	RetryAfterTrailer = "libdns-retry-after"
+)
+
+// Announce formats the stdout line announcing target
+func Announce(target string) string {
+	return fmt.Sprintf("%s %d %s", AnnouncePrefix, Version, target)
+}
+
+// ParseAnnouncement returns the gRPC target of an announcement line
+func ParseAnnouncement(line string) (string, error) {
+	fields := strings.Fields(line)
+	if len(fields) != 3 || fields[0] != AnnouncePrefix {
+		return "", fmt.Errorf("expected %q followed by version and address, got %q", AnnouncePrefix, line)
+	}
+	if version, err := strconv.Atoi(fields[1]); err != nil || version != Version {
+		return "", fmt.Errorf("plugin speaks protocol version %s, expected %d", fields[1], Version)
+	}
+	return fields[2], nil
+}
+
+// codec marshals messages as JSON
+type codec struct{}
+
+func (codec) Marshal(v any) ([]byte, error)      { return json.Marshal(v) }
+func (codec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+func (codec) Name() string                       { return "json" }
+
+func init() {
+	encoding.RegisterCodec(codec{})
+}
+
+// CallOptions are the options clients pass to select the JSON codec
+func CallOptions() []grpc.CallOption {
+	return []grpc.CallOption{grpc.CallContentSubtype(codec{}.Name())}
+}
+
+// Capabilities lists the record operations a plugin's provider implements
+type Capabilities struct {
+	Get    bool `json:"get"`
+	Append bool `json:"append"`
+	Set    bool `json:"set"`
+	Delete bool `json:"delete"`
+}
+
+// HandshakeRequest configures a provider in the plugin
+type HandshakeRequest struct {
+	ProtocolVersion int               `json:"protocolVersion"`
+	Credentials     map[string]string `json:"credentials,omitempty"`
+	Settings        map[string]string `json:"settings,omitempty"`
+}
+
+// HandshakeResponse identifies the session of the configured provider
+type HandshakeResponse struct {
+	ProtocolVersion int          `json:"protocolVersion"`
+	Session         string       `json:"session"`
+	Capabilities    Capabilities `json:"capabilities"`
+}
+
+// Record is a DNS record in its generic form. Provider data, such as record
+// IDs, does not cross the process boundary.
+type Record struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	Data string `json:"data"`
+	TTL  int64  `json:"ttl,omitempty"` // seconds
+}
+
+// GetRecordsRequest lists the records of a zone, optionally only those of
+// one name and type
+type GetRecordsRequest struct {
+	Session string `json:"session"`
+	Zone    string `json:"zone"`
+	Name    string `json:"name,omitempty"`
+	Type    string `json:"type,omitempty"`
+}
+
+// RecordsRequest appends, sets or deletes records in a zone
+type RecordsRequest struct {
+	Session string   `json:"session"`
+	Zone    string   `json:"zone"`
+	Records []Record `json:"records"`
+}
+
+// RecordsResponse returns the records a call read or changed
+type RecordsResponse struct {
+	Records []Record `json:"records"`
+}
+
+// FromLibdns converts libdns records to their generic form
+func FromLibdns(recs []libdns.Record) []Record {
+	out := make([]Record, 0, len(recs))
+	for _, rec := range recs {
+		rr := rec.RR()
+		out = append(out, Record{Name: rr.Name, Type: rr.Type, Data: rr.Data, TTL: int64(rr.TTL / time.Second)})
+	}
+	return out
+}
+
+// ToLibdns converts records to typed libdns records where their type is
+// known and to libdns.RR otherwise
+func ToLibdns(recs []Record) []libdns.Record {
+	out := make([]libdns.Record, 0, len(recs))
+	for _, r := range recs {
+		rr := libdns.RR{Name: r.Name, Type: r.Type, Data: r.Data, TTL: time.Duration(r.TTL) * time.Second}
+		if parsed, err := rr.Parse(); err == nil {
+			out = append(out, parsed)
+		} else {
+			out = append(out, rr)
+		}
+	}
+	return out
+}
+
+// ProviderServer is implemented by plugins
+type ProviderServer interface {
+	Handshake(context.Context, *HandshakeRequest) (*HandshakeResponse, error)
+	GetRecords(context.Context, *GetRecordsRequest) (*RecordsResponse, error)
+	AppendRecords(context.Context, *RecordsRequest) (*RecordsResponse, error)
+	SetRecords(context.Context, *RecordsRequest) (*RecordsResponse, error)
+	DeleteRecords(context.Context, *RecordsRequest) (*RecordsResponse, error)
+}
+
+// RegisterProviderServer registers srv with a gRPC server
+func RegisterProviderServer(s grpc.ServiceRegistrar, srv ProviderServer) {
+	s.RegisterService(&serviceDesc, srv)
+}
+
+// serviceDesc describes the service as protoc-gen-go-grpc would
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*ProviderServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "Handshake", Handler: handler("Handshake", ProviderServer.Handshake)},
+		{MethodName: "GetRecords", Handler: handler("GetRecords", ProviderServer.GetRecords)},
+		{MethodName: "AppendRecords", Handler: handler("AppendRecords", ProviderServer.AppendRecords)},
+		{MethodName: "SetRecords", Handler: handler("SetRecords", ProviderServer.SetRecords)},
+		{MethodName: "DeleteRecords", Handler: handler("DeleteRecords", ProviderServer.DeleteRecords)},
+	},
+}
+
+// methodHandler is the signature of grpc.MethodDesc.Handler
+type methodHandler = func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error)
+
+// handler adapts a ProviderServer method to a unary gRPC method handler
+func handler[Req, Resp any](name string, method func(ProviderServer, context.Context, *Req) (*Resp, error)) methodHandler {
+	return func(srv any, ctx context.Context, dec func(any) error, interceptor grpc.UnaryServerInterceptor) (any, error) {
+		req := new(Req)
+		if err := dec(req); err != nil {
+			return nil, err
+		}
+		call := func(ctx context.Context, req any) (any, error) {
+			return method(srv.(ProviderServer), ctx, req.(*Req))
+		}
+		if interceptor == nil {
+			return call(ctx, req)
+		}
+		return interceptor(ctx, req, &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + ServiceName + "/" + name}, call)
+	}
+}
+
+// ProviderClient calls a plugin
+type ProviderClient struct {
+	cc grpc.ClientConnInterface
+}
+
+// NewProviderClient returns a client for the plugin behind cc
+func NewProviderClient(cc grpc.ClientConnInterface) *ProviderClient {
+	return &ProviderClient{cc: cc}
+}
+
+// Handshake configures a provider and opens a session
+func (c *ProviderClient) Handshake(ctx context.Context, req *HandshakeRequest, opts ...grpc.CallOption) (*HandshakeResponse, error) {
+	return invoke[HandshakeResponse](ctx, c.cc, "Handshake", req, opts)
+}
+
+// GetRecords lists records of a zone
+func (c *ProviderClient) GetRecords(ctx context.Context, req *GetRecordsRequest, opts ...grpc.CallOption) (*RecordsResponse, error) {
+	return invoke[RecordsResponse](ctx, c.cc, "GetRecords", req, opts)
+}
+
+// AppendRecords adds records to a zone
+func (c *ProviderClient) AppendRecords(ctx context.Context, req *RecordsRequest, opts ...grpc.CallOption) (*RecordsResponse, error) {
+	return invoke[RecordsResponse](ctx, c.cc, "AppendRecords", req, opts)
+}
+
+// SetRecords sets records in a zone
+func (c *ProviderClient) SetRecords(ctx context.Context, req *RecordsRequest, opts ...grpc.CallOption) (*RecordsResponse, error) {
+	return invoke[RecordsResponse](ctx, c.cc, "SetRecords", req, opts)
+}
+
+// DeleteRecords removes records from a zone
+func (c *ProviderClient) DeleteRecords(ctx context.Context, req *RecordsRequest, opts ...grpc.CallOption) (*RecordsResponse, error) {
+	return invoke[RecordsResponse](ctx, c.cc, "DeleteRecords", req, opts)
+}
+
+// invoke calls method with the JSON codec
+func invoke[Resp any](ctx context.Context, cc grpc.ClientConnInterface, method string, req any, opts []grpc.CallOption) (*Resp, error) {
+	resp := new(Resp)
+	opts = append(CallOptions(), opts...)
+	if err := cc.Invoke(ctx, "/"+ServiceName+"/"+method, req, resp, opts...); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
@@ -0,0 +1,42 @@
+package protocol
+
+import (
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+func TestAnnouncementRoundTrip(t *testing.T) {
+	target := "unix:///tmp/libdns-plugin-1/plugin.sock"
+	got, err := ParseAnnouncement(Announce(target))
+	if err != nil || got != target {
+		t.Fatalf("expected %q, got %q (%v)", target, got, err)
+	}
+
+	for _, line := range []string{"", "hello", "libdns-plugin 2 unix:///x", "libdns-plugin one unix:///x", "other 1 unix:///x"} {
+		if _, err := ParseAnnouncement(line); err == nil {
+			t.Errorf("expected an error for %q", line)
+		}
+	}
+}
+
+func TestRecordConversion(t *testing.T) {
+	recs := []libdns.Record{
+		libdns.TXT{Name: "_acme-challenge", Text: "token", TTL: 2 * time.Minute},
+		libdns.RR{Name: "www", Type: "CNAME", Data: "example.com."},
+	}
+	generic := FromLibdns(recs)
+	if generic[0] != (Record{Name: "_acme-challenge", Type: "TXT", Data: "token", TTL: 120}) {
+		t.Fatalf("unexpected generic TXT record %+v", generic[0])
+	}
+
+	back := ToLibdns(generic)
+	txt, ok := back[0].(libdns.TXT)
+	if !ok || txt.Text != "token" || txt.TTL != 2*time.Minute {
+		t.Fatalf("expected a libdns.TXT, got %#v", back[0])
+	}
+	if rr := back[1].RR(); rr.Type != "CNAME" || rr.Data != "example.com." {
+		t.Fatalf("unexpected CNAME record %+v", rr)
+	}
+}
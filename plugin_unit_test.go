@@ -0,0 +1,84 @@
+//go:build !slim || plugin
+
+package main
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/cert-manager-webhook-libdns/providers"
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+)
+
+// buildExamplePlugin compiles the example plugin into a temporary plugin
+// directory
+func buildExamplePlugin(t *testing.T) {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("building the example plugin is skipped in short mode")
+	}
+	dir := t.TempDir()
+	out, err := exec.Command("go", "build", "-o", filepath.Join(dir, "example"), "./plugin/example").CombinedOutput()
+	if err != nil {
+		t.Fatalf("building the example plugin failed: %v\n%s", err, out)
+	}
+	t.Setenv("PLUGIN_DIR", dir)
+}
+
+func TestPluginProviderEndToEnd(t *testing.T) {
+	requireProvider(t, "plugin")
+	buildExamplePlugin(t)
+
+	solver := newTestSolver(providers.DefaultRegistry(), "cert-manager", "dns-creds")
+	challenge := func(key string) *v1alpha1.ChallengeRequest {
+		return &v1alpha1.ChallengeRequest{
+			ResolvedFQDN:      "_acme-challenge.example.com.",
+			ResolvedZone:      "example.com.",
+			Key:               key,
+			ResourceNamespace: "cert-manager",
+			Config: routesConfigJSON(t, LibdnsConfig{
+				Provider:  "plugin",
+				SecretRef: SecretReference{Name: "dns-creds"},
+				Options:   map[string]string{"plugin_name": "example"},
+				TTL:       120,
+			}),
+		}
+	}
+	for _, key := range []string{"first", "second"} {
+		if err := solver.Present(challenge(key)); err != nil {
+			t.Fatalf("Present(%s) failed: %v", key, err)
+		}
+	}
+
+	// The same credentials open the same session in the running plugin
+	plugin, err := providers.CreateProvider("plugin", providers.ProviderConfig{
+		Credentials: map[string]string{"api_token": "dummy"},
+		Settings:    map[string]string{"plugin_name": "example"},
+	})
+	if err != nil {
+		t.Fatalf("connecting to the plugin failed: %v", err)
+	}
+	if got := providers.CapabilitiesOf(plugin); !got.CanMerge() || !got.Append || !got.Delete {
+		t.Fatalf("expected the example plugin to support all operations, got %s", got)
+	}
+	records := func() []string {
+		t.Helper()
+		recs, err := providers.GetRecords(context.Background(), plugin, "example.com")
+		if err != nil {
+			t.Fatalf("GetRecords failed: %v", err)
+		}
+		return txtValuesForName(recs, "_acme-challenge")
+	}
+	if values := records(); len(values) != 2 {
+		t.Fatalf("expected both challenge values in the plugin, got %v", values)
+	}
+
+	if err := solver.CleanUp(challenge("first")); err != nil {
+		t.Fatalf("CleanUp failed: %v", err)
+	}
+	if values := records(); len(values) != 1 || values[0] != "second" {
+		t.Fatalf("expected only [second] to remain, got %v", values)
+	}
+}
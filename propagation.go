@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+// Defaults for the authoritative nameserver propagation check
+const (
+	defaultPropagationTimeout  = 2 * time.Minute
+	defaultPropagationInterval = 5 * time.Second
+	defaultNameserverPort      = 53
+	defaultResolvConf          = "/etc/resolv.conf"
+)
+
+// PropagationConfig makes Present wait until the TXT value is served by
+// every authoritative nameserver of the zone
+type PropagationConfig struct {
+	// Resolvers are used to look up the zone's nameservers (host or host:port, default: /etc/resolv.conf)
+	Resolvers []string `json:"resolvers,omitempty"`
+
+	// Nameservers skips the NS lookup and queries these servers directly (host or host:port)
+	Nameservers []string `json:"nameservers,omitempty"`
+
+	// Port is used for discovered authoritative nameservers (default: 53)
+	Port int `json:"port,omitempty"`
+
+	// Timeout bounds the whole check (default: 2m)
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+
+	// Interval is the pause between polls (default: 5s)
+	Interval *metav1.Duration `json:"interval,omitempty"`
+}
+
+// validate rejects an invalid port and non-positive durations
+func (c *PropagationConfig) validate(errs *configErrors) {
+	if c == nil {
+		return
+	}
+	if c.Port < 0 || c.Port > maxPort {
+		errs.addf("propagation.port must be between 1 and %d, got %d", maxPort, c.Port)
+	}
+	validateDuration(errs, "propagation.timeout", c.Timeout)
+	validateDuration(errs, "propagation.interval", c.Interval)
+}
+
+// timeout returns the configured timeout or the default
+func (c *PropagationConfig) timeout() time.Duration {
+	if c.Timeout != nil && c.Timeout.Duration > 0 {
+		return c.Timeout.Duration
+	}
+	return defaultPropagationTimeout
+}
+
+// interval returns the configured polling interval or the default
+func (c *PropagationConfig) interval() time.Duration {
+	if c.Interval != nil && c.Interval.Duration > 0 {
+		return c.Interval.Duration
+	}
+	return defaultPropagationInterval
+}
+
+// port returns the configured authoritative nameserver port or the default
+func (c *PropagationConfig) port() int {
+	if c.Port > 0 {
+		return c.Port
+	}
+	return defaultNameserverPort
+}
+
+// waitForPropagation polls the authoritative nameservers of zone until each
+// of them serves value at fqdn, or the configured timeout expires
+func waitForPropagation(ctx context.Context, cfg *PropagationConfig, fqdn, zone, value string) error {
+	ctx, cancel := context.WithTimeout(ctx, cfg.timeout())
+	defer cancel()
+
+	fqdn = dns.Fqdn(fqdn)
+	zone = dns.Fqdn(zone)
+
+	nameservers, err := authoritativeNameservers(ctx, cfg, zone)
+	if err != nil {
+		return fmt.Errorf("failed to find authoritative nameservers for %s: %w", zone, err)
+	}
+	klog.V(2).Infof("Waiting for TXT %s to propagate to %v", fqdn, nameservers)
+
+	pending := nameservers
+	for {
+		var stillPending []nameserver
+		for _, ns := range pending {
+			if !ns.serves(ctx, fqdn, value) {
+				stillPending = append(stillPending, ns)
+			}
+		}
+		if len(stillPending) == 0 {
+			klog.Infof("TXT record %s is visible on all %d authoritative nameservers", fqdn, len(nameservers))
+			return nil
+		}
+		pending = stillPending
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("TXT record %s not visible on %v after %s", fqdn, pending, cfg.timeout())
+		case <-time.After(cfg.interval()):
+		}
+	}
+}
+
+// nameserver is an authoritative nameserver and the host:port addresses it
+// is reachable at
+type nameserver struct {
+	host  string
+	addrs []string
+}
+
+func (ns nameserver) String() string {
+	return ns.host
+}
+
+// serves reports whether any address of the nameserver serves value at fqdn.
+// One is enough: a pod without IPv6 cannot reach the AAAA addresses, which
+// belong to the same server as the reachable A addresses.
+func (ns nameserver) serves(ctx context.Context, fqdn, value string) bool {
+	for _, addr := range ns.addrs {
+		found, err := txtServedBy(ctx, addr, fqdn, value)
+		if err != nil {
+			klog.V(3).Infof("Propagation check of %s against %s (%s) failed: %v", fqdn, ns.host, addr, err)
+		}
+		if found {
+			return true
+		}
+	}
+	return false
+}
+
+// authoritativeNameservers returns the zone's nameservers with their
+// host:port addresses
+func authoritativeNameservers(ctx context.Context, cfg *PropagationConfig, zone string) ([]nameserver, error) {
+	if len(cfg.Nameservers) > 0 {
+		var nameservers []nameserver
+		for _, addr := range withDefaultPort(cfg.Nameservers, cfg.port()) {
+			nameservers = append(nameservers, nameserver{host: addr, addrs: []string{addr}})
+		}
+		return nameservers, nil
+	}
+
+	resolvers, err := resolversOrDefault(cfg.Resolvers)
+	if err != nil {
+		return nil, err
+	}
+
+	nsMsg, err := queryResolvers(ctx, resolvers, zone, dns.TypeNS)
+	if err != nil {
+		return nil, err
+	}
+	var hosts []string
+	for _, rr := range nsMsg.Answer {
+		if ns, ok := rr.(*dns.NS); ok {
+			hosts = append(hosts, ns.Ns)
+		}
+	}
+	if len(hosts) == 0 {
+		return nil, fmt.Errorf("no NS records found")
+	}
+
+	var nameservers []nameserver
+	for _, host := range hosts {
+		ns := nameserver{host: host}
+		// A first, so IPv4-only pods try a reachable address first
+		for _, qtype := range []uint16{dns.TypeA, dns.TypeAAAA} {
+			msg, err := queryResolvers(ctx, resolvers, host, qtype)
+			if err != nil {
+				klog.V(3).Infof("Failed to resolve nameserver %s: %v", host, err)
+				continue
+			}
+			for _, rr := range msg.Answer {
+				switch a := rr.(type) {
+				case *dns.A:
+					ns.addrs = append(ns.addrs, net.JoinHostPort(a.A.String(), strconv.Itoa(cfg.port())))
+				case *dns.AAAA:
+					ns.addrs = append(ns.addrs, net.JoinHostPort(a.AAAA.String(), strconv.Itoa(cfg.port())))
+				}
+			}
+		}
+		if len(ns.addrs) == 0 {
+			klog.V(3).Infof("Nameserver %s has no addresses", host)
+			continue
+		}
+		nameservers = append(nameservers, ns)
+	}
+	if len(nameservers) == 0 {
+		return nil, fmt.Errorf("could not resolve any of the nameservers %v", hosts)
+	}
+	return nameservers, nil
+}
+
+// resolversOrDefault returns the configured resolvers or those from /etc/resolv.conf
+func resolversOrDefault(configured []string) ([]string, error) {
+	if len(configured) > 0 {
+		return withDefaultPort(configured, defaultNameserverPort), nil
+	}
+
+	clientConfig, err := dns.ClientConfigFromFile(defaultResolvConf)
+	if err != nil {
+		return nil, fmt.Errorf("no resolvers configured and failed to read %s: %w", defaultResolvConf, err)
+	}
+	var resolvers []string
+	for _, server := range clientConfig.Servers {
+		resolvers = append(resolvers, net.JoinHostPort(server, clientConfig.Port))
+	}
+	return resolvers, nil
+}
+
+// queryResolvers sends a recursive query to each resolver until one answers;
+// NXDOMAIN counts as an answer, with no records
+func queryResolvers(ctx context.Context, resolvers []string, name string, qtype uint16) (*dns.Msg, error) {
+	msg := new(dns.Msg)
+	msg.SetQuestion(dns.Fqdn(name), qtype)
+	msg.RecursionDesired = true
+
+	var lastErr error
+	for _, resolver := range resolvers {
+		in, err := exchange(ctx, msg, resolver)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if in.Rcode != dns.RcodeSuccess && in.Rcode != dns.RcodeNameError {
+			lastErr = fmt.Errorf("%s returned %s for %s %s", resolver, dns.RcodeToString[in.Rcode], dns.TypeToString[qtype], name)
+			continue
+		}
+		return in, nil
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no resolvers available")
+	}
+	return nil, lastErr
+}
+
+// txtServedBy reports whether the nameserver answers authoritatively with value at fqdn
+func txtServedBy(ctx context.Context, nameserver, fqdn, value string) (bool, error) {
+	msg := new(dns.Msg)
+	msg.SetQuestion(fqdn, dns.TypeTXT)
+	msg.RecursionDesired = false
+
+	in, err := exchange(ctx, msg, nameserver)
+	if err != nil {
+		return false, err
+	}
+	for _, rr := range in.Answer {
+		if txt, ok := rr.(*dns.TXT); ok && strings.Join(txt.Txt, "") == value {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// exchange sends msg over UDP and retries over TCP when the answer is truncated
+func exchange(ctx context.Context, msg *dns.Msg, addr string) (*dns.Msg, error) {
+	client := &dns.Client{Net: "udp", Timeout: 5 * time.Second}
+	in, _, err := client.ExchangeContext(ctx, msg, addr)
+	if err == nil && in.Truncated {
+		client.Net = "tcp"
+		in, _, err = client.ExchangeContext(ctx, msg, addr)
+	}
+	return in, err
+}
+
+// withDefaultPort appends port to addresses that do not specify one
+func withDefaultPort(addrs []string, port int) []string {
+	out := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			addr = net.JoinHostPort(strings.Trim(addr, "[]"), strconv.Itoa(port))
+		}
+		out = append(out, addr)
+	}
+	return out
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cert-manager-webhook-libdns/providers"
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"github.com/miekg/dns"
+	extapi "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// startTestDNSServer runs an in-process DNS server on 127.0.0.1 that answers
+// with records returned by answer and returns its port
+func startTestDNSServer(t *testing.T, answer func(q dns.Question) []dns.RR) int {
+	t.Helper()
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	started := make(chan struct{})
+	server := &dns.Server{
+		PacketConn:        pc,
+		NotifyStartedFunc: func() { close(started) },
+		Handler: dns.HandlerFunc(func(w dns.ResponseWriter, r *dns.Msg) {
+			m := new(dns.Msg)
+			m.SetReply(r)
+			m.Authoritative = true
+			for _, q := range r.Question {
+				m.Answer = append(m.Answer, answer(q)...)
+			}
+			_ = w.WriteMsg(m)
+		}),
+	}
+	go func() { _ = server.ActivateAndServe() }()
+	t.Cleanup(func() { _ = server.Shutdown() })
+	<-started
+
+	return pc.LocalAddr().(*net.UDPAddr).Port
+}
+
+// zoneAnswers serves NS and glue for example.com. pointing at 127.0.0.1 and
+// TXT values for _acme-challenge.example.com. from txt
+func zoneAnswers(txt func() []string) func(q dns.Question) []dns.RR {
+	return func(q dns.Question) []dns.RR {
+		hdr := dns.RR_Header{Name: q.Name, Rrtype: q.Qtype, Class: dns.ClassINET, Ttl: 60}
+		switch {
+		case q.Qtype == dns.TypeNS && q.Name == "example.com.":
+			return []dns.RR{&dns.NS{Hdr: hdr, Ns: "ns1.example.com."}}
+		case q.Qtype == dns.TypeA && q.Name == "ns1.example.com.":
+			return []dns.RR{&dns.A{Hdr: hdr, A: net.ParseIP("127.0.0.1")}}
+		case q.Qtype == dns.TypeTXT && q.Name == "_acme-challenge.example.com.":
+			var out []dns.RR
+			for _, v := range txt() {
+				out = append(out, &dns.TXT{Hdr: hdr, Txt: []string{v}})
+			}
+			return out
+		}
+		return nil
+	}
+}
+
+func propagationConfigJSON(t *testing.T, providerName string, propagation *PropagationConfig) *extapi.JSON {
+	t.Helper()
+	raw, err := json.Marshal(LibdnsConfig{
+		Provider:    providerName,
+		SecretRef:   SecretReference{Name: "dns-creds"},
+		TTL:         300,
+		Propagation: propagation,
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal config: %v", err)
+	}
+	return &extapi.JSON{Raw: raw}
+}
+
+func TestPresentWaitsForAuthoritativePropagation(t *testing.T) {
+	mp := &mockProvider{}
+	providerName := "mock"
+	registry := providers.NewRegistry()
+	registerMockProvider(t, registry, providerName, mp)
+
+	// The nameserver only starts serving the provider's records after a few polls,
+	// like a provider that publishes asynchronously.
+	var txtQueries atomic.Int32
+	port := startTestDNSServer(t, zoneAnswers(func() []string {
+		if txtQueries.Add(1) < 3 {
+			return nil
+		}
+		mp.mu.Lock()
+		defer mp.mu.Unlock()
+		return txtValuesForName(mp.records, "_acme-challenge")
+	}))
+
+	solver := newTestSolver(registry, "cert-manager", "dns-creds")
+	ch := &v1alpha1.ChallengeRequest{
+		ResolvedFQDN:      "_acme-challenge.example.com.",
+		ResolvedZone:      "example.com.",
+		Key:               "new-value",
+		ResourceNamespace: "cert-manager",
+		Config: propagationConfigJSON(t, providerName, &PropagationConfig{
+			Resolvers: []string{"127.0.0.1:" + strconv.Itoa(port)},
+			Port:      port,
+			Timeout:   &metav1.Duration{Duration: 5 * time.Second},
+			Interval:  &metav1.Duration{Duration: 10 * time.Millisecond},
+		}),
+	}
+
+	if err := solver.Present(ch); err != nil {
+		t.Fatalf("Present failed: %v", err)
+	}
+	if got := txtQueries.Load(); got < 3 {
+		t.Fatalf("expected Present to poll until the value was visible, got %d TXT queries", got)
+	}
+}
+
+func TestPresentFailsWhenRecordNeverPropagates(t *testing.T) {
+	mp := &mockProvider{}
+	providerName := "mock"
+	registry := providers.NewRegistry()
+	registerMockProvider(t, registry, providerName, mp)
+
+	port := startTestDNSServer(t, zoneAnswers(func() []string { return []string{"stale"} }))
+
+	solver := newTestSolver(registry, "cert-manager", "dns-creds")
+	ch := &v1alpha1.ChallengeRequest{
+		ResolvedFQDN:      "_acme-challenge.example.com.",
+		ResolvedZone:      "example.com.",
+		Key:               "new-value",
+		ResourceNamespace: "cert-manager",
+		Config: propagationConfigJSON(t, providerName, &PropagationConfig{
+			Nameservers: []string{"127.0.0.1:" + strconv.Itoa(port)},
+			Timeout:     &metav1.Duration{Duration: 100 * time.Millisecond},
+			Interval:    &metav1.Duration{Duration: 10 * time.Millisecond},
+		}),
+	}
+
+	err := solver.Present(ch)
+	if err == nil || !strings.Contains(err.Error(), "not visible") {
+		t.Fatalf("expected propagation timeout error, got %v", err)
+	}
+	if values := txtValuesForName(mp.records, "_acme-challenge"); len(values) != 1 {
+		t.Fatalf("expected the record to be written before waiting, got %v", values)
+	}
+}
+
+func TestAuthoritativeNameserversResolvesNSRecords(t *testing.T) {
+	port := startTestDNSServer(t, zoneAnswers(func() []string { return nil }))
+
+	cfg := &PropagationConfig{
+		Resolvers: []string{"127.0.0.1:" + strconv.Itoa(port)},
+		Port:      5353,
+	}
+	got, err := authoritativeNameservers(context.Background(), cfg, "example.com.")
+	if err != nil {
+		t.Fatalf("authoritativeNameservers failed: %v", err)
+	}
+	if len(got) != 1 || got[0].host != "ns1.example.com." || !slices.Equal(got[0].addrs, []string{"127.0.0.1:5353"}) {
+		t.Fatalf("expected ns1.example.com. at [127.0.0.1:5353], got %+v", got)
+	}
+}
+
+func TestPresentNeedsOneReachableAddressPerNameserver(t *testing.T) {
+	mp := &mockProvider{}
+	providerName := "mock"
+	registry := providers.NewRegistry()
+	registerMockProvider(t, registry, providerName, mp)
+
+	// ns1 also has an IPv6 address where nothing answers, like the AAAA
+	// address of a nameserver seen from an IPv4-only pod
+	answers := zoneAnswers(func() []string {
+		mp.mu.Lock()
+		defer mp.mu.Unlock()
+		return txtValuesForName(mp.records, "_acme-challenge")
+	})
+	port := startTestDNSServer(t, func(q dns.Question) []dns.RR {
+		if q.Qtype == dns.TypeAAAA && q.Name == "ns1.example.com." {
+			hdr := dns.RR_Header{Name: q.Name, Rrtype: q.Qtype, Class: dns.ClassINET, Ttl: 60}
+			return []dns.RR{&dns.AAAA{Hdr: hdr, AAAA: net.ParseIP("::1")}}
+		}
+		return answers(q)
+	})
+
+	solver := newTestSolver(registry, "cert-manager", "dns-creds")
+	ch := &v1alpha1.ChallengeRequest{
+		ResolvedFQDN:      "_acme-challenge.example.com.",
+		ResolvedZone:      "example.com.",
+		Key:               "new-value",
+		ResourceNamespace: "cert-manager",
+		Config: propagationConfigJSON(t, providerName, &PropagationConfig{
+			Resolvers: []string{"127.0.0.1:" + strconv.Itoa(port)},
+			Port:      port,
+			Timeout:   &metav1.Duration{Duration: 5 * time.Second},
+			Interval:  &metav1.Duration{Duration: 10 * time.Millisecond},
+		}),
+	}
+
+	if err := solver.Present(ch); err != nil {
+		t.Fatalf("expected the reachable address of ns1 to suffice, got %v", err)
+	}
+}
+
+func TestTxtServedByMatchesSplitStrings(t *testing.T) {
+	long := strings.Repeat("a", 300)
+	port := startTestDNSServer(t, func(q dns.Question) []dns.RR {
+		hdr := dns.RR_Header{Name: q.Name, Rrtype: dns.TypeTXT, Class: dns.ClassINET, Ttl: 60}
+		return []dns.RR{&dns.TXT{Hdr: hdr, Txt: []string{long[:255], long[255:]}}}
+	})
+
+	found, err := txtServedBy(context.Background(), "127.0.0.1:"+strconv.Itoa(port), "_acme-challenge.example.com.", long)
+	if err != nil {
+		t.Fatalf("txtServedBy failed: %v", err)
+	}
+	if !found {
+		t.Fatal("expected TXT value split across strings to match")
+	}
+}
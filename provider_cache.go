@@ -0,0 +1,131 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/klog/v2"
+
+	"github.com/cert-manager-webhook-libdns/providers"
+)
+
+// defaultProviderCacheIdleTimeout is how long an unused provider is kept
+const defaultProviderCacheIdleTimeout = 10 * time.Minute
+
+// secretRevision identifies one revision of a credential Secret
+type secretRevision struct {
+	Namespace       string
+	Name            string
+	UID             types.UID
+	ResourceVersion string
+
+	// Sources identifies the key mapping and further Secrets the credentials
+	// were composed from, if any
+	Sources string
+}
+
+// providerCache keeps constructed DNS providers so that HTTP connection pools,
+// auth sessions and provider-side lookups survive across challenges.
+// Entries are keyed by provider name and Secret UID; an entry built from an
+// older resourceVersion of the Secret is replaced on the next lookup.
+// The zero value is ready to use.
+type providerCache struct {
+	mu sync.Mutex
+
+	// idleTimeout drops entries not used for this long (default: 10m)
+	idleTimeout time.Duration
+
+	entries map[string]*providerCacheEntry
+
+	// now is overridable for tests
+	now func() time.Time
+}
+
+// providerCacheEntry is a cached provider together with the Secret revision
+// it was built from. ready is closed once provider or err is set, so lookups
+// for an entry that is being created wait for it.
+type providerCacheEntry struct {
+	provider        providers.DNSProvider
+	err             error
+	ready           chan struct{}
+	resourceVersion string
+	lastUsed        time.Time
+}
+
+// getOrCreate returns the cached provider for providerName and rev, calling
+// create when there is no entry for the current Secret revision. create runs
+// without holding the lock, so a slow provider does not hold up the others;
+// concurrent lookups of the same entry wait for it and share its result.
+func (c *providerCache) getOrCreate(providerName string, rev secretRevision, create func() (providers.DNSProvider, error)) (providers.DNSProvider, error) {
+	c.mu.Lock()
+	now := c.clock()
+	c.evictIdle(now)
+
+	key := providerName + "|" + rev.Namespace + "/" + rev.Name + "|" + string(rev.UID) + "|" + rev.Sources
+	if entry, ok := c.entries[key]; ok {
+		if entry.resourceVersion == rev.ResourceVersion {
+			entry.lastUsed = now
+			c.mu.Unlock()
+			<-entry.ready
+			return entry.provider, entry.err
+		}
+		klog.V(2).Infof("Secret %s/%s changed (resourceVersion %s -> %s), recreating %s provider",
+			rev.Namespace, rev.Name, entry.resourceVersion, rev.ResourceVersion, providerName)
+		delete(c.entries, key)
+	}
+
+	if c.entries == nil {
+		c.entries = make(map[string]*providerCacheEntry)
+	}
+	entry := &providerCacheEntry{
+		ready:           make(chan struct{}),
+		resourceVersion: rev.ResourceVersion,
+		lastUsed:        now,
+	}
+	c.entries[key] = entry
+	c.mu.Unlock()
+
+	entry.provider, entry.err = create()
+	if entry.err != nil {
+		// Let the next lookup try again
+		c.mu.Lock()
+		if c.entries[key] == entry {
+			delete(c.entries, key)
+		}
+		c.mu.Unlock()
+	}
+	close(entry.ready)
+	return entry.provider, entry.err
+}
+
+// evictIdle drops entries that have not been used within idleTimeout
+func (c *providerCache) evictIdle(now time.Time) {
+	idleTimeout := c.idleTimeout
+	if idleTimeout <= 0 {
+		idleTimeout = defaultProviderCacheIdleTimeout
+	}
+	for key, entry := range c.entries {
+		if now.Sub(entry.lastUsed) > idleTimeout && entry.done() {
+			klog.V(3).Infof("Dropping idle provider %s", key)
+			delete(c.entries, key)
+		}
+	}
+}
+
+// done reports whether the entry's provider was created
+func (e *providerCacheEntry) done() bool {
+	select {
+	case <-e.ready:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *providerCache) clock() time.Time {
+	if c.now != nil {
+		return c.now()
+	}
+	return time.Now()
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cert-manager-webhook-libdns/providers"
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestGetProviderReusesProviderPerSecretRevision(t *testing.T) {
+	providerName := "mock"
+	factoryCalls := 0
+	registry := providers.NewRegistry()
+	providers.RegisterWith(registry, providerName, func(config providers.ProviderConfig) (*mockProvider, error) {
+		factoryCalls++
+		return &mockProvider{}, nil
+	}, providers.Descriptor{})
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "dns-creds",
+			Namespace:       "cert-manager",
+			UID:             "uid-1",
+			ResourceVersion: "1",
+		},
+		Data: map[string][]byte{"api_token": []byte("first")},
+	}
+	client := fake.NewSimpleClientset(secret)
+	solver := &libdnsSolver{client: client, registry: registry}
+	ch := &v1alpha1.ChallengeRequest{
+		ResolvedFQDN:      "_acme-challenge.example.com.",
+		ResolvedZone:      "example.com.",
+		Key:               "value",
+		ResourceNamespace: "cert-manager",
+		Config:            challengeConfigJSON(t, providerName, "dns-creds", "", 300),
+	}
+
+	first, err := solver.getProvider(ch)
+	if err != nil {
+		t.Fatalf("getProvider failed: %v", err)
+	}
+	second, err := solver.getProvider(ch)
+	if err != nil {
+		t.Fatalf("getProvider failed: %v", err)
+	}
+	if factoryCalls != 1 {
+		t.Fatalf("expected factory to be called once for an unchanged Secret, got %d calls", factoryCalls)
+	}
+	if unwrapProvider(first.provider) != unwrapProvider(second.provider) {
+		t.Fatal("expected the cached provider instance to be reused")
+	}
+
+	secret.ResourceVersion = "2"
+	secret.Data["api_token"] = []byte("rotated")
+	if _, err := client.CoreV1().Secrets("cert-manager").Update(context.Background(), secret, metav1.UpdateOptions{}); err != nil {
+		t.Fatalf("failed to update secret: %v", err)
+	}
+
+	third, err := solver.getProvider(ch)
+	if err != nil {
+		t.Fatalf("getProvider failed: %v", err)
+	}
+	if factoryCalls != 2 {
+		t.Fatalf("expected factory to be called again after the Secret changed, got %d calls", factoryCalls)
+	}
+	if unwrapProvider(third.provider) == unwrapProvider(first.provider) {
+		t.Fatal("expected a new provider instance after the Secret changed")
+	}
+}
+
+func TestProviderCacheEvictsIdleEntries(t *testing.T) {
+	now := time.Unix(0, 0)
+	cache := &providerCache{
+		idleTimeout: time.Minute,
+		now:         func() time.Time { return now },
+	}
+
+	created := 0
+	create := func() (providers.DNSProvider, error) {
+		created++
+		return &mockProvider{}, nil
+	}
+	active := secretRevision{Namespace: "cert-manager", Name: "active", UID: "uid-active", ResourceVersion: "1"}
+	idle := secretRevision{Namespace: "cert-manager", Name: "idle", UID: "uid-idle", ResourceVersion: "1"}
+
+	for _, rev := range []secretRevision{active, idle} {
+		if _, err := cache.getOrCreate("mock", rev, create); err != nil {
+			t.Fatalf("getOrCreate failed: %v", err)
+		}
+	}
+
+	// Keep one entry busy while the other goes idle.
+	now = now.Add(45 * time.Second)
+	if _, err := cache.getOrCreate("mock", active, create); err != nil {
+		t.Fatalf("getOrCreate failed: %v", err)
+	}
+	now = now.Add(45 * time.Second)
+	if _, err := cache.getOrCreate("mock", active, create); err != nil {
+		t.Fatalf("getOrCreate failed: %v", err)
+	}
+
+	if created != 2 {
+		t.Fatalf("expected 2 providers to be created, got %d", created)
+	}
+	if len(cache.entries) != 1 {
+		t.Fatalf("expected idle entry to be evicted, %d entries remain", len(cache.entries))
+	}
+
+	if _, err := cache.getOrCreate("mock", idle, create); err != nil {
+		t.Fatalf("getOrCreate failed: %v", err)
+	}
+	if created != 3 {
+		t.Fatalf("expected evicted provider to be recreated, got %d creations", created)
+	}
+}
+
+func TestProviderCacheDoesNotCacheFactoryErrors(t *testing.T) {
+	cache := &providerCache{}
+	rev := secretRevision{Namespace: "cert-manager", Name: "dns-creds", UID: "uid", ResourceVersion: "1"}
+
+	_, err := cache.getOrCreate("mock", rev, func() (providers.DNSProvider, error) {
+		return nil, fmt.Errorf("api_token is required")
+	})
+	if err == nil {
+		t.Fatal("expected factory error to be returned")
+	}
+	if len(cache.entries) != 0 {
+		t.Fatalf("expected failed creation not to be cached, got %d entries", len(cache.entries))
+	}
+}
+
+func TestProviderCacheCreatesOutsideTheLock(t *testing.T) {
+	cache := &providerCache{}
+	slow := secretRevision{Namespace: "cert-manager", Name: "slow", UID: "uid-slow", ResourceVersion: "1"}
+	fast := secretRevision{Namespace: "cert-manager", Name: "fast", UID: "uid-fast", ResourceVersion: "1"}
+
+	started, release := make(chan struct{}, 2), make(chan struct{})
+	var slowCalls atomic.Int32
+	createSlow := func() (providers.DNSProvider, error) {
+		slowCalls.Add(1)
+		started <- struct{}{}
+		<-release
+		return &mockProvider{}, nil
+	}
+
+	results := make(chan providers.DNSProvider, 2)
+	for range 2 {
+		go func() {
+			provider, err := cache.getOrCreate("mock", slow, createSlow)
+			if err != nil {
+				t.Errorf("getOrCreate failed: %v", err)
+			}
+			results <- provider
+		}()
+	}
+
+	// Another provider is created while the slow one is still starting
+	<-started
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if _, err := cache.getOrCreate("mock", fast, func() (providers.DNSProvider, error) {
+			return &mockProvider{}, nil
+		}); err != nil {
+			t.Errorf("getOrCreate failed: %v", err)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("creating one provider blocked creating another")
+	}
+
+	close(release)
+	first, second := <-results, <-results
+	if first != second {
+		t.Fatal("expected concurrent lookups to share one provider")
+	}
+	if got := slowCalls.Load(); got != 1 {
+		t.Fatalf("expected one creation for concurrent lookups, got %d", got)
+	}
+}
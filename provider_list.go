@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/cert-manager-webhook-libdns/providers"
+)
+
+// providerInfo is the JSON form of a provider descriptor
+type providerInfo struct {
+	Name                string    `json:"name"`
+	RequiredCredentials []keyInfo `json:"requiredCredentials"`
+	OptionalCredentials []keyInfo `json:"optionalCredentials"`
+	RequiredSettings    []keyInfo `json:"requiredSettings"`
+	OptionalSettings    []keyInfo `json:"optionalSettings"`
+	MinTTL              int       `json:"minTTL,omitempty"`
+	MaxTTL              int       `json:"maxTTL,omitempty"`
+	AmbientCredentials  bool      `json:"ambientCredentials"`
+	Passthrough         bool      `json:"passthrough,omitempty"`
+	DocsURL             string    `json:"docsURL,omitempty"`
+}
+
+// keyInfo is the JSON form of a credential or setting
+type keyInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// flagValue returns the value of a --name value or --name=value argument
+func flagValue(args []string, name string) string {
+	for i, arg := range args {
+		if arg == name && i+1 < len(args) {
+			return args[i+1]
+		}
+		if value, ok := strings.CutPrefix(arg, name+"="); ok {
+			return value
+		}
+	}
+	return ""
+}
+
+// printProviders writes the compiled-in providers to w, as a list for
+// output "" or "text" and with their descriptors for output "json"
+func printProviders(w io.Writer, output string) error {
+	switch output {
+	case "", "text":
+		fmt.Fprintln(w, "Compiled-in DNS providers:")
+		for _, p := range providers.ListProviders() {
+			fmt.Fprintf(w, "  - %s\n", p)
+		}
+		return nil
+	case "json":
+		infos := []providerInfo{}
+		for _, name := range providers.ListProviders() {
+			d, err := providers.Describe(name)
+			if err != nil {
+				return err
+			}
+			infos = append(infos, providerInfo{
+				Name:                name,
+				RequiredCredentials: keyInfos(d.RequiredCredentials),
+				OptionalCredentials: keyInfos(d.OptionalCredentials),
+				RequiredSettings:    keyInfos(d.RequiredSettings),
+				OptionalSettings:    keyInfos(d.OptionalSettings),
+				MinTTL:              int(d.MinTTL.Seconds()),
+				MaxTTL:              int(d.MaxTTL.Seconds()),
+				AmbientCredentials:  d.AmbientCredentials,
+				Passthrough:         d.Passthrough,
+				DocsURL:             d.DocsURL,
+			})
+		}
+		out, err := json.MarshalIndent(infos, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(out))
+		return err
+	}
+	return fmt.Errorf("unknown output format %q (use text or json)", output)
+}
+
+// keyInfos converts keys to their JSON form, never returning nil
+func keyInfos(keys []providers.Key) []keyInfo {
+	infos := make([]keyInfo, 0, len(keys))
+	for _, k := range keys {
+		infos = append(infos, keyInfo{Name: k.Name, Description: k.Description})
+	}
+	return infos
+}
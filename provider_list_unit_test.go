@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestFlagValue(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{args: []string{"webhook", "--list-providers", "--output", "json"}, want: "json"},
+		{args: []string{"webhook", "--output=json", "--list-providers"}, want: "json"},
+		{args: []string{"webhook", "--list-providers"}, want: ""},
+		{args: []string{"webhook", "--list-providers", "--output"}, want: ""},
+	}
+	for _, tc := range tests {
+		if got := flagValue(tc.args, "--output"); got != tc.want {
+			t.Errorf("flagValue(%v) = %q, want %q", tc.args, got, tc.want)
+		}
+	}
+}
+
+func TestPrintProvidersJSON(t *testing.T) {
+	requireProvider(t, "desec")
+	var buf bytes.Buffer
+	if err := printProviders(&buf, "json"); err != nil {
+		t.Fatalf("printProviders failed: %v", err)
+	}
+
+	var infos []providerInfo
+	if err := json.Unmarshal(buf.Bytes(), &infos); err != nil {
+		t.Fatalf("output is not valid JSON: %v\n%s", err, buf.String())
+	}
+	i := slices.IndexFunc(infos, func(p providerInfo) bool { return p.Name == "desec" })
+	if i < 0 {
+		t.Fatalf("desec missing from %s", buf.String())
+	}
+	desec := infos[i]
+	if desec.MinTTL != 3600 || len(desec.RequiredCredentials) != 1 || desec.RequiredCredentials[0].Name != "api_token" {
+		t.Fatalf("unexpected deSEC descriptor %+v", desec)
+	}
+}
+
+func TestPrintProvidersRejectsUnknownFormat(t *testing.T) {
+	err := printProviders(&bytes.Buffer{}, "yaml")
+	if err == nil || !strings.Contains(err.Error(), `unknown output format "yaml"`) {
+		t.Fatalf("expected an unknown format error, got %v", err)
+	}
+}
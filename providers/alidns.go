@@ -1,3 +1,5 @@
+//go:build !slim || alidns
+
 package providers
 
 import (
@@ -7,7 +9,19 @@ import (
 )
 
 func init() {
-	Register("alidns", NewAlidnsProvider)
+	Register("alidns", NewAlidnsProvider, Descriptor{
+		RequiredCredentials: []Key{
+			{Name: "access_key_id", Description: "Alibaba Cloud access key ID"},
+			{Name: "access_key_secret", Description: "Alibaba Cloud access key secret"},
+		},
+		OptionalCredentials: []Key{
+			{Name: "security_token", Description: "STS security token (for temporary credentials)"},
+		},
+		OptionalSettings: []Key{
+			{Name: "region_id", Description: "Alibaba Cloud region (default: cn-hangzhou)"},
+		},
+		DocsURL: "https://github.com/libdns/alidns",
+	})
 }
 
 // NewAlidnsProvider creates an Alibaba Cloud DNS provider
@@ -17,9 +31,11 @@ func init() {
 //   - access_key_secret: Alibaba Cloud access key secret
 //
 // Optional credentials:
-//   - region_id: Alibaba Cloud region (default: cn-hangzhou)
 //   - security_token: STS security token (for temporary credentials)
-func NewAlidnsProvider(config ProviderConfig) (DNSProvider, error) {
+//
+// Optional settings:
+//   - region_id: Alibaba Cloud region (default: cn-hangzhou)
+func NewAlidnsProvider(config ProviderConfig) (*alidns.Provider, error) {
 	accessKeyID := config.Credentials["access_key_id"]
 	accessKeySecret := config.Credentials["access_key_secret"]
 
@@ -37,7 +53,7 @@ func NewAlidnsProvider(config ProviderConfig) (DNSProvider, error) {
 		},
 	}
 
-	if regionID := config.Credentials["region_id"]; regionID != "" {
+	if regionID := config.Setting("region_id"); regionID != "" {
 		provider.CredentialInfo.RegionID = regionID
 	}
 
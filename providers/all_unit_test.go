@@ -0,0 +1,15 @@
+//go:build !slim
+
+package providers
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestDefaultBuildIncludesAllProviders(t *testing.T) {
+	want := []string{"alidns", "cloudflare", "desec", "hetzner", "linode", "ovh", "plugin", "route53"}
+	if got := ListProviders(); !slices.Equal(got, want) {
+		t.Fatalf("expected all providers %v without build tags, got %v", want, got)
+	}
+}
@@ -0,0 +1,74 @@
+package providers
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/libdns/libdns"
+
+	"github.com/cert-manager-webhook-libdns/providers/records"
+)
+
+// The capability and record helpers live in the records package, which
+// plugins import without linking in the providers
+
+// ErrUnsupported is returned when a provider lacks the libdns interface of
+// the requested operation
+var ErrUnsupported = records.ErrUnsupported
+
+// Capabilities reports which record operations a provider implements
+type Capabilities = records.Capabilities
+
+// CapabilityReporter is implemented by providers whose operations are only
+// known at runtime, such as plugins
+type CapabilityReporter = records.CapabilityReporter
+
+// RecordLookup is an optional interface for providers whose API can return the
+// records of a single name and type, so large zones need not be listed in full
+type RecordLookup = records.RecordLookup
+
+// CapabilitiesOf inspects which libdns record interfaces provider implements,
+// or asks a CapabilityReporter
+func CapabilitiesOf(provider DNSProvider) Capabilities {
+	return records.CapabilitiesOf(provider)
+}
+
+// checkProviderType returns an error unless providers of type t can solve
+// challenges. A CapabilityReporter is only checked once created.
+func checkProviderType(t reflect.Type) error {
+	if t.Implements(reflect.TypeFor[CapabilityReporter]()) {
+		return nil
+	}
+	return records.TypeCapabilities(t).Validate()
+}
+
+// GetRecords lists the records of zone, or returns ErrUnsupported if the
+// provider is no libdns.RecordGetter
+func GetRecords(ctx context.Context, provider DNSProvider, zone string) ([]libdns.Record, error) {
+	return records.GetRecords(ctx, provider, zone)
+}
+
+// GetRecordsByName returns the records of recordType at name using the
+// provider's RecordLookup if it has one, and otherwise by filtering
+// GetRecords
+func GetRecordsByName(ctx context.Context, provider DNSProvider, zone, name, recordType string) ([]libdns.Record, error) {
+	return records.GetRecordsByName(ctx, provider, zone, name, recordType)
+}
+
+// AppendRecords adds recs to zone, or returns ErrUnsupported if the provider
+// is no libdns.RecordAppender
+func AppendRecords(ctx context.Context, provider DNSProvider, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	return records.AppendRecords(ctx, provider, zone, recs)
+}
+
+// SetRecords sets recs in zone, or returns ErrUnsupported if the provider is
+// no libdns.RecordSetter
+func SetRecords(ctx context.Context, provider DNSProvider, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	return records.SetRecords(ctx, provider, zone, recs)
+}
+
+// DeleteRecords removes recs from zone, or returns ErrUnsupported if the
+// provider is no libdns.RecordDeleter
+func DeleteRecords(ctx context.Context, provider DNSProvider, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	return records.DeleteRecords(ctx, provider, zone, recs)
+}
@@ -0,0 +1,110 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/libdns/libdns"
+)
+
+// appendOnlyProvider can add records but never remove them
+type appendOnlyProvider struct{}
+
+func (appendOnlyProvider) AppendRecords(_ context.Context, _ string, recs []libdns.Record) ([]libdns.Record, error) {
+	return recs, nil
+}
+
+// appendDeleteProvider is a write-only dynamic DNS style provider
+type appendDeleteProvider struct{ appendOnlyProvider }
+
+func (appendDeleteProvider) DeleteRecords(_ context.Context, _ string, recs []libdns.Record) ([]libdns.Record, error) {
+	return recs, nil
+}
+
+func TestCapabilitiesOf(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider DNSProvider
+		want     Capabilities
+	}{
+		{name: "all", provider: stubProvider{}, want: Capabilities{Get: true, Append: true, Set: true, Delete: true}},
+		{name: "append and delete", provider: appendDeleteProvider{}, want: Capabilities{Append: true, Delete: true}},
+		{name: "lookup counts as get", provider: nativeLookupProvider{&lookupProvider{}}, want: Capabilities{Get: true}},
+		{name: "none", provider: struct{}{}, want: Capabilities{}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := CapabilitiesOf(tc.provider); got != tc.want {
+				t.Fatalf("CapabilitiesOf = %+v, want %+v", got, tc.want)
+			}
+		})
+	}
+}
+
+// reportingProvider reports capabilities chosen at runtime, like a plugin
+type reportingProvider struct {
+	stubProvider
+	caps Capabilities
+}
+
+func (p reportingProvider) Capabilities() Capabilities {
+	return p.caps
+}
+
+func TestRegisterRejectsProviderTypesThatCannotSolveChallenges(t *testing.T) {
+	r := NewRegistry()
+	func() {
+		defer func() {
+			msg, _ := recover().(string)
+			if !strings.Contains(msg, "cannot register append-only: provider supports append") {
+				t.Fatalf("expected a capability panic, got %q", msg)
+			}
+		}()
+		RegisterWith(r, "append-only", func(ProviderConfig) (appendOnlyProvider, error) {
+			return appendOnlyProvider{}, nil
+		}, Descriptor{})
+	}()
+	if _, err := r.Get("append-only"); err == nil {
+		t.Fatal("expected the rejected provider not to be registered")
+	}
+
+	RegisterWith(r, "dyndns", func(ProviderConfig) (appendDeleteProvider, error) {
+		return appendDeleteProvider{}, nil
+	}, Descriptor{})
+	if _, err := r.Create("dyndns", ProviderConfig{}); err != nil {
+		t.Fatalf("expected an append and delete provider to be accepted, got %v", err)
+	}
+}
+
+func TestCreateRejectsReportedCapabilitiesThatCannotSolveChallenges(t *testing.T) {
+	r := NewRegistry()
+	RegisterWith(r, "reporting", func(config ProviderConfig) (reportingProvider, error) {
+		if config.Setting("mode") == "append" {
+			return reportingProvider{caps: Capabilities{Append: true}}, nil
+		}
+		return reportingProvider{caps: Capabilities{Append: true, Delete: true}}, nil
+	}, Descriptor{})
+
+	if _, err := r.Create("reporting", ProviderConfig{Settings: map[string]string{"mode": "append"}}); err == nil || !strings.Contains(err.Error(), "reporting: provider supports append") {
+		t.Fatalf("expected a capability error, got %v", err)
+	}
+	if _, err := r.Create("reporting", ProviderConfig{}); err != nil {
+		t.Fatalf("expected an append and delete provider to be accepted, got %v", err)
+	}
+}
+
+func TestOperationsReturnErrUnsupported(t *testing.T) {
+	ctx := context.Background()
+	p := appendDeleteProvider{}
+	if _, err := SetRecords(ctx, p, "example.com", nil); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("expected ErrUnsupported from SetRecords, got %v", err)
+	}
+	if _, err := GetRecordsByName(ctx, p, "example.com", "_acme-challenge", "TXT"); !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("expected ErrUnsupported from GetRecordsByName, got %v", err)
+	}
+	if _, err := AppendRecords(ctx, p, "example.com", nil); err != nil {
+		t.Fatalf("AppendRecords failed: %v", err)
+	}
+}
@@ -1,13 +1,43 @@
+//go:build !slim || cloudflare
+
 package providers
 
 import (
+	"context"
 	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/libdns/cloudflare"
+	"github.com/libdns/libdns"
 )
 
 func init() {
-	Register("cloudflare", NewCloudflareProvider)
+	Register("cloudflare", NewCloudflareProvider, Descriptor{
+		RequiredCredentials: []Key{
+			{Name: "api_token", Description: "Cloudflare API token with Zone:DNS:Edit permissions"},
+		},
+		MinTTL:  60 * time.Second,
+		MaxTTL:  24 * time.Hour,
+		DocsURL: "https://github.com/libdns/cloudflare",
+	})
+}
+
+// cloudflareAPI is the base URL of the Cloudflare API
+const cloudflareAPI = "https://api.cloudflare.com/client/v4"
+
+// cloudflareProvider adds filtered record lookups to the libdns Cloudflare provider
+type cloudflareProvider struct {
+	*cloudflare.Provider
+
+	baseURL string
+	client  *http.Client
+
+	// zoneIDs caches zone name to ID lookups
+	zoneIDs sync.Map
 }
 
 // NewCloudflareProvider creates a Cloudflare DNS provider
@@ -16,13 +46,96 @@ func init() {
 //   - api_token: Cloudflare API token with Zone:DNS:Edit permissions
 //
 // Note: Use scoped API tokens, NOT global API keys
-func NewCloudflareProvider(config ProviderConfig) (DNSProvider, error) {
+func NewCloudflareProvider(config ProviderConfig) (*cloudflareProvider, error) {
 	apiToken := config.Credentials["api_token"]
 	if apiToken == "" {
 		return nil, fmt.Errorf("cloudflare: api_token is required")
 	}
 
-	return &cloudflare.Provider{
-		APIToken: apiToken,
+	return &cloudflareProvider{
+		Provider: &cloudflare.Provider{
+			APIToken: apiToken,
+		},
+		baseURL: cloudflareAPI,
 	}, nil
 }
+
+// cloudflareRecord is a DNS record as returned by the Cloudflare API
+type cloudflareRecord struct {
+	ID      string `json:"id"`
+	Type    string `json:"type"`
+	Name    string `json:"name"`
+	Content string `json:"content"`
+	TTL     int    `json:"ttl"`
+}
+
+// GetRecordsByName lists the records filtered by name and type
+func (p *cloudflareProvider) GetRecordsByName(ctx context.Context, zone, name, recordType string) ([]libdns.Record, error) {
+	zone = strings.TrimSuffix(zone, ".")
+	zoneID, err := p.zoneID(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+
+	qs := make(url.Values)
+	qs.Set("type", recordType)
+	qs.Set("name.exact", strings.TrimSuffix(libdns.AbsoluteName(name, zone+"."), "."))
+	qs.Set("per_page", "100")
+	reqURL := fmt.Sprintf("%s/zones/%s/dns_records?%s", p.baseURL, url.PathEscape(zoneID), qs.Encode())
+
+	var resp struct {
+		Result []cloudflareRecord `json:"result"`
+	}
+	if err := getJSON(ctx, p.client, "cloudflare", reqURL, "Bearer "+p.APIToken, &resp); err != nil {
+		return nil, err
+	}
+
+	records := make([]libdns.Record, 0, len(resp.Result))
+	for _, r := range resp.Result {
+		relative := libdns.RelativeName(strings.TrimSuffix(r.Name, ".")+".", zone+".")
+		ttl := time.Duration(r.TTL) * time.Second
+		if r.Type == "TXT" {
+			// Match the libdns provider, which strips one pair of enclosing quotes
+			records = append(records, libdns.TXT{Name: relative, TTL: ttl, Text: cloudflareUnwrap(r.Content), ProviderData: r})
+			continue
+		}
+		rec, err := libdns.RR{Name: relative, TTL: ttl, Type: r.Type, Data: r.Content}.Parse()
+		if err != nil {
+			return nil, fmt.Errorf("cloudflare: parsing %s record %q: %w", r.Type, r.Content, err)
+		}
+		records = append(records, withProviderData(rec, r))
+	}
+	return records, nil
+}
+
+// zoneID resolves and caches the Cloudflare ID of zone
+func (p *cloudflareProvider) zoneID(ctx context.Context, zone string) (string, error) {
+	if id, ok := p.zoneIDs.Load(zone); ok {
+		return id.(string), nil
+	}
+
+	qs := make(url.Values)
+	qs.Set("name", zone)
+	var resp struct {
+		Result []struct {
+			ID string `json:"id"`
+		} `json:"result"`
+	}
+	if err := getJSON(ctx, p.client, "cloudflare", p.baseURL+"/zones?"+qs.Encode(), "Bearer "+p.APIToken, &resp); err != nil {
+		return "", err
+	}
+	if len(resp.Result) != 1 {
+		return "", fmt.Errorf("cloudflare: expected 1 zone, got %d for %s", len(resp.Result), zone)
+	}
+
+	p.zoneIDs.Store(zone, resp.Result[0].ID)
+	return resp.Result[0].ID, nil
+}
+
+// cloudflareUnwrap removes the quotes Cloudflare may put around TXT content
+func cloudflareUnwrap(content string) string {
+	if len(content) >= 2 && strings.HasPrefix(content, `"`) && strings.HasSuffix(content, `"`) {
+		return content[1 : len(content)-1]
+	}
+	return content
+}
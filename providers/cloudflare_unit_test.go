@@ -0,0 +1,62 @@
+//go:build !slim || cloudflare
+
+package providers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+func TestCloudflareGetRecordsByName(t *testing.T) {
+	server := startLookupServer(t, map[string]string{
+		"/zones?name=example.com": `{"success":true,"result":[{"id":"zone-1","name":"example.com"}]}`,
+		"/zones/zone-1/dns_records?name.exact=_acme-challenge.example.com&per_page=100&type=TXT": `{"success":true,"result":[` +
+			`{"id":"rec-1","type":"TXT","name":"_acme-challenge.example.com","content":"\"quoted\"","ttl":120},` +
+			`{"id":"rec-2","type":"TXT","name":"_acme-challenge.example.com","content":"plain","ttl":1}]}`,
+	})
+	p, err := NewCloudflareProvider(ProviderConfig{Credentials: map[string]string{"api_token": "token"}})
+	if err != nil {
+		t.Fatalf("NewCloudflareProvider failed: %v", err)
+	}
+	p.baseURL = server.URL
+
+	for range 2 { // the second lookup reuses the cached zone ID
+		got, err := GetRecordsByName(context.Background(), p, "example.com.", "_acme-challenge", "TXT")
+		if err != nil {
+			t.Fatalf("GetRecordsByName failed: %v", err)
+		}
+		assertTXT(t, got,
+			libdns.TXT{Name: "_acme-challenge", TTL: 120 * time.Second, Text: "quoted"},
+			libdns.TXT{Name: "_acme-challenge", TTL: time.Second, Text: "plain"},
+		)
+		// The record IDs are kept for precise updates and deletes
+		for i, want := range []string{"rec-1", "rec-2"} {
+			if data, ok := got[i].(libdns.TXT).ProviderData.(cloudflareRecord); !ok || data.ID != want {
+				t.Fatalf("expected record %d to carry ID %s, got %#v", i, want, got[i].(libdns.TXT).ProviderData)
+			}
+		}
+	}
+}
+
+func TestCloudflareGetRecordsByNameReturnsStatusError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "7")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	t.Cleanup(server.Close)
+
+	p, _ := NewCloudflareProvider(ProviderConfig{Credentials: map[string]string{"api_token": "token"}})
+	p.baseURL = server.URL
+
+	_, err := GetRecordsByName(context.Background(), p, "example.com", "_acme-challenge", "TXT")
+	var status *StatusError
+	if !errors.As(err, &status) || status.StatusCode() != http.StatusTooManyRequests || status.RetryAfter() != 7*time.Second {
+		t.Fatalf("expected a 429 StatusError with Retry-After 7s, got %v", err)
+	}
+}
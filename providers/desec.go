@@ -1,26 +1,128 @@
+//go:build !slim || desec
+
 package providers
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/libdns/desec"
+	"github.com/libdns/libdns"
 )
 
 func init() {
-	Register("desec", NewDesecProvider)
+	Register("desec", NewDesecProvider, Descriptor{
+		RequiredCredentials: []Key{
+			{Name: "api_token", Description: "deSEC API token"},
+		},
+		MinTTL:  time.Hour,
+		DocsURL: "https://github.com/libdns/desec",
+	})
+}
+
+// desecAPI is the base URL of the deSEC API
+const desecAPI = "https://desec.io/api/v1"
+
+// desecProvider adds RRset lookups to the libdns deSEC provider
+type desecProvider struct {
+	*desec.Provider
+
+	baseURL string
+	client  *http.Client
 }
 
 // NewDesecProvider creates a deSEC DNS provider
 //
 // Required credentials:
 //   - api_token: deSEC API token
-func NewDesecProvider(config ProviderConfig) (DNSProvider, error) {
+func NewDesecProvider(config ProviderConfig) (*desecProvider, error) {
 	apiToken := config.Credentials["api_token"]
 	if apiToken == "" {
 		return nil, fmt.Errorf("desec: api_token is required")
 	}
 
-	return &desec.Provider{
-		Token: apiToken,
+	return &desecProvider{
+		Provider: &desec.Provider{
+			Token: apiToken,
+		},
+		baseURL: desecAPI,
 	}, nil
 }
+
+// desecRRSet is an RRset as returned by the deSEC API
+type desecRRSet struct {
+	Subname string   `json:"subname"`
+	Type    string   `json:"type"`
+	TTL     int      `json:"ttl"`
+	Records []string `json:"records"`
+}
+
+// GetRecordsByName fetches a single RRset instead of listing the zone
+func (p *desecProvider) GetRecordsByName(ctx context.Context, zone, name, recordType string) ([]libdns.Record, error) {
+	// https://desec.readthedocs.io/en/latest/dns/rrsets.html#retrieving-a-specific-rrset
+	subname := name
+	if subname == "" {
+		subname = "@"
+	}
+	reqURL := fmt.Sprintf("%s/domains/%s/rrsets/%s/%s/", p.baseURL,
+		url.PathEscape(strings.TrimSuffix(zone, ".")), url.PathEscape(subname), url.PathEscape(recordType))
+
+	var rrset desecRRSet
+	if err := getJSON(ctx, p.client, "desec", reqURL, "Token "+p.Token, &rrset); err != nil {
+		var status *StatusError
+		if errors.As(err, &status) && status.Code == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	records := make([]libdns.Record, 0, len(rrset.Records))
+	for _, data := range rrset.Records {
+		if rrset.Type == "TXT" {
+			text, err := desecUnquoteTXT(data)
+			if err != nil {
+				return nil, fmt.Errorf("desec: %w", err)
+			}
+			data = text
+		}
+		rec, err := libdns.RR{
+			Name: name,
+			Type: rrset.Type,
+			TTL:  time.Duration(rrset.TTL) * time.Second,
+			Data: data,
+		}.Parse()
+		if err != nil {
+			return nil, fmt.Errorf("desec: parsing %s record %q: %w", rrset.Type, data, err)
+		}
+		records = append(records, withProviderData(rec, &rrset))
+	}
+	return records, nil
+}
+
+// desecUnquoteTXT reverses deSEC's quoting of TXT values the same way the
+// libdns provider does, so values compare equal to those from GetRecords
+func desecUnquoteTXT(data string) (string, error) {
+	if len(data) < 2 || data[0] != '"' || data[len(data)-1] != '"' {
+		return "", fmt.Errorf("parsing TXT record value %q: not in quotes", data)
+	}
+	var sb strings.Builder
+	for i := 1; i < len(data)-1; {
+		r, size := utf8.DecodeRuneInString(data[i:])
+		if r == '\\' {
+			i += size
+			r, size = utf8.DecodeRuneInString(data[i:])
+			if r != '\\' && r != '"' {
+				return "", fmt.Errorf("parsing TXT record value %q: invalid escape sequence", data)
+			}
+		}
+		sb.WriteRune(r)
+		i += size
+	}
+	return sb.String(), nil
+}
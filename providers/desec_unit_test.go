@@ -0,0 +1,50 @@
+//go:build !slim || desec
+
+package providers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+func TestDesecGetRecordsByName(t *testing.T) {
+	server := startLookupServer(t, map[string]string{
+		"/domains/example.com/rrsets/_acme-challenge/TXT/": `{"subname":"_acme-challenge","type":"TXT","ttl":3600,"records":["\"first\"","\"with \\\"quotes\\\"\""]}`,
+	})
+	p, err := NewDesecProvider(ProviderConfig{Credentials: map[string]string{"api_token": "token"}})
+	if err != nil {
+		t.Fatalf("NewDesecProvider failed: %v", err)
+	}
+	p.baseURL = server.URL
+
+	got, err := GetRecordsByName(context.Background(), p, "example.com", "_acme-challenge", "TXT")
+	if err != nil {
+		t.Fatalf("GetRecordsByName failed: %v", err)
+	}
+	assertTXT(t, got,
+		libdns.TXT{Name: "_acme-challenge", TTL: time.Hour, Text: "first"},
+		libdns.TXT{Name: "_acme-challenge", TTL: time.Hour, Text: `with "quotes"`},
+	)
+}
+
+func TestDesecGetRecordsByNameMissingRRSet(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = fmt.Fprint(w, `{"detail":"Not found."}`)
+	}))
+	t.Cleanup(server.Close)
+
+	p, _ := NewDesecProvider(ProviderConfig{Credentials: map[string]string{"api_token": "token"}})
+	p.baseURL = server.URL
+
+	got, err := GetRecordsByName(context.Background(), p, "example.com", "_acme-challenge", "TXT")
+	if err != nil || len(got) != 0 {
+		t.Fatalf("expected no records and no error for a missing RRset, got %v, %v", got, err)
+	}
+}
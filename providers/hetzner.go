@@ -1,26 +1,115 @@
+//go:build !slim || hetzner
+
 package providers
 
 import (
+	"context"
 	"fmt"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/hetznercloud/hcloud-go/v2/hcloud"
 	hetzner "github.com/libdns/hetzner/v2" // Note: v2 module path
+	"github.com/libdns/libdns"
 )
 
 func init() {
-	Register("hetzner", NewHetznerProvider)
+	Register("hetzner", NewHetznerProvider, Descriptor{
+		RequiredCredentials: []Key{
+			{Name: "api_token", Description: "Hetzner DNS API token"},
+		},
+		DocsURL: "https://github.com/libdns/hetzner",
+	})
+}
+
+// hetznerProvider adds RRset lookups to the libdns Hetzner provider
+type hetznerProvider struct {
+	*hetzner.Provider
+
+	// endpoint overrides the Hetzner Cloud API endpoint; empty uses the default
+	endpoint string
+
+	clientOnce sync.Once
+	client     *hcloud.Client
 }
 
 // NewHetznerProvider creates a Hetzner DNS provider
 //
 // Required credentials:
 //   - api_token: Hetzner DNS API token
-func NewHetznerProvider(config ProviderConfig) (DNSProvider, error) {
+func NewHetznerProvider(config ProviderConfig) (*hetznerProvider, error) {
 	apiToken := config.Credentials["api_token"]
 	if apiToken == "" {
 		return nil, fmt.Errorf("hetzner: api_token is required")
 	}
 
-	return &hetzner.Provider{
-		APIToken: apiToken,
+	return &hetznerProvider{
+		Provider: &hetzner.Provider{
+			APIToken: apiToken,
+		},
 	}, nil
 }
+
+func (p *hetznerProvider) hcloudClient() *hcloud.Client {
+	p.clientOnce.Do(func() {
+		opts := []hcloud.ClientOption{
+			hcloud.WithToken(p.APIToken),
+			hcloud.WithApplication("cert-manager-webhook-libdns", ""),
+		}
+		if p.endpoint != "" {
+			opts = append(opts, hcloud.WithEndpoint(p.endpoint))
+		}
+		p.client = hcloud.NewClient(opts...)
+	})
+	return p.client
+}
+
+// GetRecordsByName fetches a single RRset instead of listing the zone
+func (p *hetznerProvider) GetRecordsByName(ctx context.Context, zone, name, recordType string) ([]libdns.Record, error) {
+	client := p.hcloudClient()
+	hcloudZone := &hcloud.Zone{Name: strings.TrimSuffix(zone, ".")}
+
+	set, _, err := client.Zone.GetRRSetByNameAndType(ctx, hcloudZone, name, hcloud.ZoneRRSetType(recordType))
+	if err != nil {
+		return nil, fmt.Errorf("hetzner: %w", err)
+	}
+	if set == nil {
+		return nil, nil
+	}
+
+	// An RRset without its own TTL uses the zone's default, as in GetRecords
+	var ttl int
+	if set.TTL != nil {
+		ttl = *set.TTL
+	} else {
+		z, _, err := client.Zone.Get(ctx, hcloudZone.Name)
+		if err != nil {
+			return nil, fmt.Errorf("hetzner: %w", err)
+		}
+		if z == nil {
+			return nil, fmt.Errorf("hetzner: zone '%s' not found", hcloudZone.Name)
+		}
+		ttl = z.TTL
+	}
+
+	records := make([]libdns.Record, 0, len(set.Records))
+	for _, r := range set.Records {
+		rec, err := libdns.RR{
+			Name: set.Name,
+			TTL:  time.Duration(ttl) * time.Second,
+			Type: string(set.Type),
+			Data: r.Value,
+		}.Parse()
+		if err != nil {
+			return nil, fmt.Errorf("hetzner: parsing %s record %q: %w", set.Type, r.Value, err)
+		}
+		// Remove enclosing quotation marks like the libdns provider does
+		if txt, ok := rec.(libdns.TXT); ok {
+			txt.Text = strings.Trim(txt.Text, `"`)
+			rec = txt
+		}
+		records = append(records, withProviderData(rec, &r))
+	}
+	return records, nil
+}
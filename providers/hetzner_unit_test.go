@@ -0,0 +1,34 @@
+//go:build !slim || hetzner
+
+package providers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+func TestHetznerGetRecordsByName(t *testing.T) {
+	server := startLookupServer(t, map[string]string{
+		"/zones/example.com/rrsets/_acme-challenge/TXT": `{"rrset":{"id":"_acme-challenge/TXT","name":"_acme-challenge","type":"TXT","ttl":null,` +
+			`"records":[{"value":"\"first\""},{"value":"\"second\""}],"zone":1}}`,
+		"/zones/example.com": `{"zone":{"id":1,"name":"example.com","ttl":600}}`,
+	})
+	p, err := NewHetznerProvider(ProviderConfig{Credentials: map[string]string{"api_token": "token"}})
+	if err != nil {
+		t.Fatalf("NewHetznerProvider failed: %v", err)
+	}
+	p.endpoint = server.URL
+
+	got, err := GetRecordsByName(context.Background(), p, "example.com", "_acme-challenge", "TXT")
+	if err != nil {
+		t.Fatalf("GetRecordsByName failed: %v", err)
+	}
+	// The RRset has no TTL of its own, so the zone default applies
+	assertTXT(t, got,
+		libdns.TXT{Name: "_acme-challenge", TTL: 10 * time.Minute, Text: "first"},
+		libdns.TXT{Name: "_acme-challenge", TTL: 10 * time.Minute, Text: "second"},
+	)
+}
@@ -1,3 +1,5 @@
+//go:build !slim || linode
+
 package providers
 
 import (
@@ -7,14 +9,19 @@ import (
 )
 
 func init() {
-	Register("linode", NewLinodeProvider)
+	Register("linode", NewLinodeProvider, Descriptor{
+		RequiredCredentials: []Key{
+			{Name: "api_token", Description: "Linode API token with DNS access"},
+		},
+		DocsURL: "https://github.com/libdns/linode",
+	})
 }
 
 // NewLinodeProvider creates a Linode DNS provider
 //
 // Required credentials:
 //   - api_token: Linode API token with DNS access
-func NewLinodeProvider(config ProviderConfig) (DNSProvider, error) {
+func NewLinodeProvider(config ProviderConfig) (*linode.Provider, error) {
 	apiToken := config.Credentials["api_token"]
 	if apiToken == "" {
 		return nil, fmt.Errorf("linode: api_token is required")
@@ -0,0 +1,107 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+// withProviderData attaches data, the record as returned by the provider's
+// API, to a record parsed from it. Record IDs and similar details then reach
+// SetRecords and DeleteRecords as with records from GetRecords.
+func withProviderData(rec libdns.Record, data any) libdns.Record {
+	switch r := rec.(type) {
+	case libdns.Address:
+		r.ProviderData = data
+		return r
+	case libdns.CAA:
+		r.ProviderData = data
+		return r
+	case libdns.CNAME:
+		r.ProviderData = data
+		return r
+	case libdns.MX:
+		r.ProviderData = data
+		return r
+	case libdns.NS:
+		r.ProviderData = data
+		return r
+	case libdns.SRV:
+		r.ProviderData = data
+		return r
+	case libdns.ServiceBinding:
+		r.ProviderData = data
+		return r
+	case libdns.TXT:
+		r.ProviderData = data
+		return r
+	}
+	return rec
+}
+
+// StatusError is returned by the lookups for unexpected HTTP responses. It
+// exposes the status code and Retry-After hint for retry classification.
+type StatusError struct {
+	Provider string
+	Code     int
+	Body     string
+	Header   http.Header
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s: unexpected status code %d: %s", e.Provider, e.Code, e.Body)
+}
+
+// StatusCode returns the HTTP status code of the response
+func (e *StatusError) StatusCode() int {
+	return e.Code
+}
+
+// RetryAfter returns the delay requested by the Retry-After header, or 0
+func (e *StatusError) RetryAfter() time.Duration {
+	if e.Header == nil {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(e.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	return 0
+}
+
+// getJSON sends a GET request with the given Authorization header and decodes
+// a successful JSON response into out
+func getJSON(ctx context.Context, client *http.Client, provider, url, authorization string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("%s: creating request: %w", provider, err)
+	}
+	req.Header.Set("Authorization", authorization)
+	req.Header.Set("Accept", "application/json")
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: sending request: %w", provider, err)
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return fmt.Errorf("%s: reading response body: %w", provider, err)
+	}
+	if res.StatusCode != http.StatusOK {
+		return &StatusError{Provider: provider, Code: res.StatusCode, Body: string(body), Header: res.Header}
+	}
+	if err := json.Unmarshal(body, out); err != nil {
+		return fmt.Errorf("%s: decoding response: %w", provider, err)
+	}
+	return nil
+}
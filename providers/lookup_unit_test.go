@@ -0,0 +1,107 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/libdns/libdns"
+)
+
+// lookupProvider is a DNSProvider that records which lookup was used
+type lookupProvider struct {
+	records     []libdns.Record
+	getCalls    int
+	lookupCalls int
+}
+
+func (p *lookupProvider) GetRecords(context.Context, string) ([]libdns.Record, error) {
+	p.getCalls++
+	return p.records, nil
+}
+
+// getOnlyProvider lacks RecordLookup, so GetRecordsByName must filter GetRecords
+type getOnlyProvider struct{ *lookupProvider }
+
+// nativeLookupProvider serves GetRecordsByName itself
+type nativeLookupProvider struct{ *lookupProvider }
+
+func (p nativeLookupProvider) GetRecordsByName(_ context.Context, _, name, recordType string) ([]libdns.Record, error) {
+	p.lookupCalls++
+	return []libdns.Record{libdns.TXT{Name: name, Text: "native"}}, nil
+}
+
+func TestGetRecordsByNameFallsBackToGetRecords(t *testing.T) {
+	inner := &lookupProvider{records: []libdns.Record{
+		libdns.TXT{Name: "_acme-challenge", Text: "match", ProviderData: "id-1"},
+		libdns.TXT{Name: "other", Text: "other-name"},
+		libdns.RR{Name: "_acme-challenge", Type: "CNAME", Data: "target.example.net."},
+	}}
+
+	got, err := GetRecordsByName(context.Background(), getOnlyProvider{inner}, "example.com", "_acme-challenge", "TXT")
+	if err != nil {
+		t.Fatalf("GetRecordsByName failed: %v", err)
+	}
+	if len(got) != 1 || got[0] != inner.records[0] {
+		t.Fatalf("expected only the matching TXT record as returned by GetRecords, got %v", got)
+	}
+	if inner.getCalls != 1 {
+		t.Fatalf("expected a single GetRecords call, got %d", inner.getCalls)
+	}
+
+	inner = &lookupProvider{}
+	got, err = GetRecordsByName(context.Background(), nativeLookupProvider{inner}, "example.com", "_acme-challenge", "TXT")
+	if err != nil {
+		t.Fatalf("GetRecordsByName failed: %v", err)
+	}
+	if len(got) != 1 || got[0].RR().Data != "native" || inner.lookupCalls != 1 || inner.getCalls != 0 {
+		t.Fatalf("expected the native lookup to be used, got %v (lookups=%d gets=%d)", got, inner.lookupCalls, inner.getCalls)
+	}
+}
+
+// startLookupServer serves canned responses by request path and fails on anything else
+func startLookupServer(t *testing.T, responses map[string]string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.URL.Path
+		if r.URL.RawQuery != "" {
+			key += "?" + r.URL.RawQuery
+		}
+		body, ok := responses[key]
+		if !ok {
+			body, ok = responses[r.URL.Path]
+		}
+		if !ok {
+			t.Errorf("unexpected request %s %s", r.Method, key)
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = fmt.Fprint(w, `{"error":{"code":"not_found","message":"not found"}}`)
+			return
+		}
+		_, _ = fmt.Fprint(w, body)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func assertTXT(t *testing.T, got []libdns.Record, want ...libdns.TXT) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("expected %d records, got %v", len(want), got)
+	}
+	for i, rec := range got {
+		txt, ok := rec.(libdns.TXT)
+		if !ok {
+			t.Fatalf("record %d is %T, want libdns.TXT", i, rec)
+		}
+		// Provider data is checked by the tests that care about it
+		if txt.ProviderData == nil {
+			t.Fatalf("record %d = %+v carries no provider data", i, txt)
+		}
+		txt.ProviderData = nil
+		if txt != want[i] {
+			t.Fatalf("record %d = %+v, want %+v", i, txt, want[i])
+		}
+	}
+}
@@ -1,3 +1,5 @@
+//go:build !slim || ovh
+
 package providers
 
 import (
@@ -7,18 +9,30 @@ import (
 )
 
 func init() {
-	Register("ovh", NewOVHProvider)
+	Register("ovh", NewOVHProvider, Descriptor{
+		RequiredCredentials: []Key{
+			{Name: "application_key", Description: "OVH application key"},
+			{Name: "application_secret", Description: "OVH application secret"},
+			{Name: "consumer_key", Description: "OVH consumer key"},
+		},
+		RequiredSettings: []Key{
+			{Name: "endpoint", Description: "OVH API endpoint (e.g., ovh-eu, ovh-ca, ovh-us)"},
+		},
+		DocsURL: "https://github.com/libdns/ovh",
+	})
 }
 
 // NewOVHProvider creates an OVH DNS provider
 //
 // Required credentials:
-//   - endpoint: OVH API endpoint (e.g., ovh-eu, ovh-ca, ovh-us)
 //   - application_key: OVH application key
 //   - application_secret: OVH application secret
 //   - consumer_key: OVH consumer key
-func NewOVHProvider(config ProviderConfig) (DNSProvider, error) {
-	endpoint := config.Credentials["endpoint"]
+//
+// Required settings:
+//   - endpoint: OVH API endpoint (e.g., ovh-eu, ovh-ca, ovh-us)
+func NewOVHProvider(config ProviderConfig) (*ovh.Provider, error) {
+	endpoint := config.Setting("endpoint")
 	applicationKey := config.Credentials["application_key"]
 	applicationSecret := config.Credentials["application_secret"]
 	consumerKey := config.Credentials["consumer_key"]
@@ -0,0 +1,483 @@
+//go:build !slim || plugin
+
+package providers
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/libdns/libdns"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"k8s.io/klog/v2"
+
+	"github.com/cert-manager-webhook-libdns/plugin/protocol"
+)
+
+// defaultPluginDir holds the plugin binaries the webhook may launch
+const defaultPluginDir = "/usr/local/lib/libdns-webhook/plugins"
+
+// pluginStartTimeout bounds launching a plugin and the handshake
+const pluginStartTimeout = 30 * time.Second
+
+func init() {
+	Register("plugin", NewPluginProvider, Descriptor{
+		OptionalSettings: []Key{
+			{Name: "plugin_name", Description: "Plugin binary in the plugin directory (PLUGIN_DIR) for the webhook to launch"},
+			{Name: "plugin_address", Description: "Address of a running plugin, unix:///path/to/socket or a host:port listed in PLUGIN_ADDRESSES"},
+		},
+		Passthrough: true,
+		DocsURL:     "https://github.com/git001/cert-manager-webhook-libdns#provider-plugins",
+	})
+}
+
+// NewPluginProvider creates a provider served by an out-of-process plugin.
+// All credentials and the remaining settings are passed to the plugin in
+// the handshake.
+//
+// Settings (exactly one):
+//   - plugin_name: binary in PLUGIN_DIR that the webhook launches
+//   - plugin_address: address of a running plugin, a Unix socket or a TCP
+//     address listed in PLUGIN_ADDRESSES
+func NewPluginProvider(config ProviderConfig) (*pluginProvider, error) {
+	name, address := config.Setting("plugin_name"), config.Setting("plugin_address")
+	var target pluginTarget
+	switch {
+	case name != "" && address != "":
+		return nil, fmt.Errorf("plugin: set only one of plugin_name and plugin_address")
+	case name != "":
+		if filepath.Base(name) != name || name == "." || name == ".." {
+			return nil, fmt.Errorf("plugin: plugin_name %q must be a file name without a path", name)
+		}
+		dir := os.Getenv("PLUGIN_DIR")
+		if dir == "" {
+			dir = defaultPluginDir
+		}
+		target = pluginTarget{command: filepath.Join(dir, name)}
+	case address != "":
+		if err := checkPluginAddress(address); err != nil {
+			return nil, fmt.Errorf("plugin: %w", err)
+		}
+		target = pluginTarget{address: address}
+	default:
+		return nil, fmt.Errorf("plugin: plugin_name or plugin_address is required")
+	}
+
+	p := &pluginProvider{
+		target: target,
+		handshake: protocol.HandshakeRequest{
+			ProtocolVersion: protocol.Version,
+			Credentials:     withoutPluginKeys(config.Credentials),
+			Settings:        withoutPluginKeys(config.Settings),
+		},
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), pluginStartTimeout)
+	defer cancel()
+	if _, err := p.connect(ctx); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// checkPluginAddress allows Unix sockets, which are local to the webhook's
+// pod, and TCP addresses the webhook's operator listed in PLUGIN_ADDRESSES.
+// Otherwise any issuer could send its credentials to a host of its choice.
+func checkPluginAddress(address string) error {
+	if strings.HasPrefix(address, "unix://") {
+		return nil
+	}
+	for allowed := range strings.SplitSeq(os.Getenv("PLUGIN_ADDRESSES"), ",") {
+		if strings.TrimSpace(allowed) == address {
+			return nil
+		}
+	}
+	return fmt.Errorf("plugin_address %q must be a unix:// socket or be listed in PLUGIN_ADDRESSES", address)
+}
+
+// pluginTransport returns the credentials for dialing address: none for Unix
+// sockets and TLS for TCP, verified against PLUGIN_CA_FILE if it is set and
+// the system roots otherwise
+func pluginTransport(address string) (credentials.TransportCredentials, error) {
+	if strings.HasPrefix(address, "unix://") {
+		return insecure.NewCredentials(), nil
+	}
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if file := os.Getenv("PLUGIN_CA_FILE"); file != "" {
+		pem, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("reading PLUGIN_CA_FILE: %w", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("PLUGIN_CA_FILE %s holds no PEM certificates", file)
+		}
+	}
+	return credentials.NewTLS(config), nil
+}
+
+// withoutPluginKeys copies m without the settings that select the plugin
+func withoutPluginKeys(m map[string]string) map[string]string {
+	out := maps.Clone(m)
+	delete(out, "plugin_name")
+	delete(out, "plugin_address")
+	return out
+}
+
+// pluginTarget is a plugin binary to launch or the address of a running plugin
+type pluginTarget struct {
+	command string
+	address string
+}
+
+func (t pluginTarget) String() string {
+	if t.command != "" {
+		return t.command
+	}
+	return t.address
+}
+
+// pluginProvider calls a plugin within the session of its handshake
+type pluginProvider struct {
+	target    pluginTarget
+	handshake protocol.HandshakeRequest
+
+	mu      sync.Mutex
+	conn    *pluginConn
+	session string
+	caps    Capabilities
+}
+
+var _ CapabilityReporter = (*pluginProvider)(nil)
+
+// Capabilities returns the operations the plugin reported in the handshake
+func (p *pluginProvider) Capabilities() Capabilities {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.caps
+}
+
+// connect returns a connection with an open session, launching or dialing
+// the plugin and repeating the handshake when the plugin was restarted
+func (p *pluginProvider) connect(ctx context.Context) (*pluginConn, error) {
+	conn, err := pluginConns.get(ctx, p.target)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if conn == p.conn && p.session != "" {
+		return conn, nil
+	}
+	res, err := conn.client.Handshake(ctx, &p.handshake)
+	if err != nil {
+		return nil, fmt.Errorf("plugin %s: handshake: %w", p.target, pluginError(p.target, err, nil))
+	}
+	if res.ProtocolVersion != protocol.Version {
+		return nil, fmt.Errorf("plugin %s speaks protocol version %d, expected %d", p.target, res.ProtocolVersion, protocol.Version)
+	}
+	p.conn, p.session = conn, res.Session
+	p.caps = Capabilities{Get: res.Capabilities.Get, Append: res.Capabilities.Append, Set: res.Capabilities.Set, Delete: res.Capabilities.Delete}
+	return conn, nil
+}
+
+// call runs a plugin call, repeating the handshake once if the plugin lost
+// the session
+func (p *pluginProvider) call(ctx context.Context, fn func(client *protocol.ProviderClient, session string, opts ...grpc.CallOption) (*protocol.RecordsResponse, error)) ([]libdns.Record, error) {
+	for attempt := 0; ; attempt++ {
+		conn, err := p.connect(ctx)
+		if err != nil {
+			return nil, err
+		}
+		p.mu.Lock()
+		session := p.session
+		p.mu.Unlock()
+
+		var trailer metadata.MD
+		res, err := fn(conn.client, session, grpc.Trailer(&trailer))
+		if status.Code(err) == codes.NotFound && attempt == 0 {
+			p.mu.Lock()
+			p.session = ""
+			p.mu.Unlock()
+			continue
+		}
+		if err != nil {
+			return nil, pluginError(p.target, err, trailer)
+		}
+		return protocol.ToLibdns(res.Records), nil
+	}
+}
+
+func (p *pluginProvider) GetRecords(ctx context.Context, zone string) ([]libdns.Record, error) {
+	return p.call(ctx, func(client *protocol.ProviderClient, session string, opts ...grpc.CallOption) (*protocol.RecordsResponse, error) {
+		return client.GetRecords(ctx, &protocol.GetRecordsRequest{Session: session, Zone: zone}, opts...)
+	})
+}
+
+// GetRecordsByName lets the plugin filter the records, so they do not all
+// cross the process boundary
+func (p *pluginProvider) GetRecordsByName(ctx context.Context, zone, name, recordType string) ([]libdns.Record, error) {
+	return p.call(ctx, func(client *protocol.ProviderClient, session string, opts ...grpc.CallOption) (*protocol.RecordsResponse, error) {
+		return client.GetRecords(ctx, &protocol.GetRecordsRequest{Session: session, Zone: zone, Name: name, Type: recordType}, opts...)
+	})
+}
+
+func (p *pluginProvider) AppendRecords(ctx context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	return p.call(ctx, func(client *protocol.ProviderClient, session string, opts ...grpc.CallOption) (*protocol.RecordsResponse, error) {
+		return client.AppendRecords(ctx, &protocol.RecordsRequest{Session: session, Zone: zone, Records: protocol.FromLibdns(recs)}, opts...)
+	})
+}
+
+func (p *pluginProvider) SetRecords(ctx context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	return p.call(ctx, func(client *protocol.ProviderClient, session string, opts ...grpc.CallOption) (*protocol.RecordsResponse, error) {
+		return client.SetRecords(ctx, &protocol.RecordsRequest{Session: session, Zone: zone, Records: protocol.FromLibdns(recs)}, opts...)
+	})
+}
+
+func (p *pluginProvider) DeleteRecords(ctx context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	return p.call(ctx, func(client *protocol.ProviderClient, session string, opts ...grpc.CallOption) (*protocol.RecordsResponse, error) {
+		return client.DeleteRecords(ctx, &protocol.RecordsRequest{Session: session, Zone: zone, Records: protocol.FromLibdns(recs)}, opts...)
+	})
+}
+
+// PluginError is a failed plugin call. It exposes the status code and
+// Retry-After hint of the provider API for retry classification.
+type PluginError struct {
+	Plugin  string
+	Message string
+	Code    int
+	Retry   time.Duration
+	cause   error
+}
+
+func (e *PluginError) Error() string {
+	return fmt.Sprintf("plugin %s: %s", e.Plugin, e.Message)
+}
+
+// StatusCode returns the HTTP status code of the provider API, or 0
+func (e *PluginError) StatusCode() int {
+	return e.Code
+}
+
+// RetryAfter returns the delay the provider API asked for, or 0
+func (e *PluginError) RetryAfter() time.Duration {
+	return e.Retry
+}
+
+func (e *PluginError) Unwrap() error {
+	return e.cause
+}
+
+// pluginError converts a gRPC error of a plugin call
+func pluginError(target pluginTarget, err error, trailer metadata.MD) error {
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	e := &PluginError{Plugin: target.String(), Message: st.Message()}
+	switch st.Code() {
+	case codes.Unimplemented:
+		e.cause = ErrUnsupported
+	case codes.Unavailable:
+		// The plugin is not running (yet); like a 503 this is worth retrying
+		e.Code = 503
+	case codes.DeadlineExceeded:
+		e.cause = context.DeadlineExceeded
+	case codes.Canceled:
+		e.cause = context.Canceled
+	}
+	if values := trailer.Get(protocol.StatusCodeTrailer); len(values) > 0 {
+		e.Code, _ = strconv.Atoi(values[0])
+	}
+	if values := trailer.Get(protocol.RetryAfterTrailer); len(values) > 0 {
+		if seconds, err := strconv.Atoi(values[0]); err == nil {
+			e.Retry = time.Duration(seconds) * time.Second
+		}
+	}
+	return e
+}
+
+// pluginConns shares one connection, and one process, per plugin target
+var pluginConns = &pluginPool{entries: make(map[pluginTarget]*pluginEntry)}
+
+// pluginPool holds the connections to plugins
+type pluginPool struct {
+	mu      sync.Mutex
+	entries map[pluginTarget]*pluginEntry
+}
+
+// pluginEntry is the connection to one target; ready is closed once conn or
+// err is set, so callers for a target that is being launched wait for it
+type pluginEntry struct {
+	ready chan struct{}
+	conn  *pluginConn
+	err   error
+}
+
+// pluginConn is a connection to a plugin and, if launched, its process
+type pluginConn struct {
+	cc     *grpc.ClientConn
+	client *protocol.ProviderClient
+	cmd    *exec.Cmd
+	stdin  io.Closer
+}
+
+// get returns the connection to target, launching the plugin if it is not
+// running. Only the first caller for a target launches it, without holding
+// the lock, so other targets are not held up by a slow start.
+func (p *pluginPool) get(ctx context.Context, target pluginTarget) (*pluginConn, error) {
+	p.mu.Lock()
+	entry, ok := p.entries[target]
+	if !ok {
+		entry = &pluginEntry{ready: make(chan struct{})}
+		p.entries[target] = entry
+	}
+	p.mu.Unlock()
+
+	if ok {
+		select {
+		case <-entry.ready:
+			return entry.conn, entry.err
+		case <-ctx.Done():
+			return nil, fmt.Errorf("plugin %s: waiting for the plugin to start: %w", target, ctx.Err())
+		}
+	}
+
+	entry.conn, entry.err = p.connect(ctx, target, entry)
+	if entry.err != nil {
+		// Let the next call try again
+		p.forget(target, entry)
+	}
+	close(entry.ready)
+	return entry.conn, entry.err
+}
+
+// forget removes entry unless it was already replaced
+func (p *pluginPool) forget(target pluginTarget, entry *pluginEntry) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.entries[target] == entry {
+		delete(p.entries, target)
+	}
+}
+
+// connect launches the plugin if target is a command and dials it
+func (p *pluginPool) connect(ctx context.Context, target pluginTarget, entry *pluginEntry) (*pluginConn, error) {
+	address := target.address
+	var cmd *exec.Cmd
+	var stdin io.Closer
+	if target.command != "" {
+		var err error
+		if cmd, stdin, address, err = launchPlugin(ctx, target.command); err != nil {
+			return nil, err
+		}
+	}
+	kill := func() {
+		if cmd != nil {
+			_ = stdin.Close()
+			_ = cmd.Process.Kill()
+			_ = cmd.Wait()
+		}
+	}
+
+	transport, err := pluginTransport(address)
+	if err != nil {
+		kill()
+		return nil, fmt.Errorf("plugin %s: %w", target, err)
+	}
+	cc, err := grpc.NewClient(address, grpc.WithTransportCredentials(transport))
+	if err != nil {
+		kill()
+		return nil, fmt.Errorf("plugin %s: connecting to %s: %w", target, address, err)
+	}
+	conn := &pluginConn{cc: cc, client: protocol.NewProviderClient(cc), cmd: cmd, stdin: stdin}
+
+	if cmd != nil {
+		// Forget the plugin when it exits, so the next call launches it again
+		go func() {
+			if err := cmd.Wait(); err != nil {
+				klog.Errorf("Plugin %s exited: %v", target, err)
+			} else {
+				klog.V(2).Infof("Plugin %s exited", target)
+			}
+			p.forget(target, entry)
+			_ = cc.Close()
+		}()
+	}
+	return conn, nil
+}
+
+// launchPlugin starts a plugin binary and reads the address it announces.
+// The plugin inherits stderr and exits when its stdin is closed, which
+// happens at the latest when the webhook exits.
+func launchPlugin(ctx context.Context, command string) (*exec.Cmd, io.Closer, string, error) {
+	cmd := exec.Command(command)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("plugin %s: %w", command, err)
+	}
+	// An os.Pipe instead of StdoutPipe, so the process can be waited for
+	// while its output is still being read
+	stdout, w, err := os.Pipe()
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("plugin %s: %w", command, err)
+	}
+	cmd.Stdout = w
+	err = cmd.Start()
+	_ = w.Close()
+	if err != nil {
+		_ = stdout.Close()
+		return nil, nil, "", fmt.Errorf("plugin %s: starting: %w", command, err)
+	}
+
+	announced := make(chan string, 1)
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		if scanner.Scan() {
+			announced <- scanner.Text()
+		}
+		close(announced)
+		// Pass further output on instead of blocking the plugin
+		_, _ = io.Copy(os.Stderr, stdout)
+		_ = stdout.Close()
+	}()
+
+	fail := func(err error) (*exec.Cmd, io.Closer, string, error) {
+		_ = stdin.Close()
+		_ = cmd.Process.Kill()
+		// Reap the process, so failed launches leave no zombies
+		_ = cmd.Wait()
+		return nil, nil, "", fmt.Errorf("plugin %s: %w", command, err)
+	}
+	select {
+	case line, ok := <-announced:
+		if !ok {
+			return fail(errors.New("exited without announcing its address"))
+		}
+		address, err := protocol.ParseAnnouncement(line)
+		if err != nil {
+			return fail(err)
+		}
+		return cmd, stdin, address, nil
+	case <-ctx.Done():
+		return fail(fmt.Errorf("waiting for its address: %w", ctx.Err()))
+	}
+}
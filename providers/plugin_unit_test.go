@@ -0,0 +1,364 @@
+//go:build !slim || plugin
+
+package providers
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/cert-manager-webhook-libdns/plugin/protocol"
+)
+
+// fakePlugin serves the plugin protocol with append and delete only and
+// records the handshakes it receives
+type fakePlugin struct {
+	mu         sync.Mutex
+	handshakes []protocol.HandshakeRequest
+	sessions   map[string]bool
+	records    []protocol.Record
+	deleteErr  error
+}
+
+func (f *fakePlugin) Handshake(_ context.Context, req *protocol.HandshakeRequest) (*protocol.HandshakeResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.handshakes = append(f.handshakes, *req)
+	f.sessions["s1"] = true
+	return &protocol.HandshakeResponse{
+		ProtocolVersion: protocol.Version,
+		Session:         "s1",
+		Capabilities:    protocol.Capabilities{Append: true, Delete: true},
+	}, nil
+}
+
+func (f *fakePlugin) session(session string) error {
+	if !f.sessions[session] {
+		return status.Error(codes.NotFound, "unknown session")
+	}
+	return nil
+}
+
+func (f *fakePlugin) GetRecords(context.Context, *protocol.GetRecordsRequest) (*protocol.RecordsResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "get records: operation not supported by provider")
+}
+
+func (f *fakePlugin) AppendRecords(_ context.Context, req *protocol.RecordsRequest) (*protocol.RecordsResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.session(req.Session); err != nil {
+		return nil, err
+	}
+	f.records = append(f.records, req.Records...)
+	return &protocol.RecordsResponse{Records: req.Records}, nil
+}
+
+func (f *fakePlugin) SetRecords(context.Context, *protocol.RecordsRequest) (*protocol.RecordsResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "set records: operation not supported by provider")
+}
+
+func (f *fakePlugin) DeleteRecords(ctx context.Context, req *protocol.RecordsRequest) (*protocol.RecordsResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.session(req.Session); err != nil {
+		return nil, err
+	}
+	if f.deleteErr != nil {
+		_ = grpc.SetTrailer(ctx, metadata.Pairs(protocol.StatusCodeTrailer, "429", protocol.RetryAfterTrailer, "7"))
+		return nil, status.Error(codes.Unknown, f.deleteErr.Error())
+	}
+	f.records = nil
+	return &protocol.RecordsResponse{Records: req.Records}, nil
+}
+
+// serveFakePlugin serves plugin on a Unix socket and returns its address
+func serveFakePlugin(t *testing.T, plugin *fakePlugin) string {
+	t.Helper()
+	socket := filepath.Join(t.TempDir(), "plugin.sock")
+	lis, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	servePlugin(t, plugin, lis)
+	return "unix://" + socket
+}
+
+// servePlugin serves plugin on lis with opts until the test ends
+func servePlugin(t *testing.T, plugin *fakePlugin, lis net.Listener, opts ...grpc.ServerOption) {
+	t.Helper()
+	plugin.sessions = make(map[string]bool)
+	srv := grpc.NewServer(opts...)
+	protocol.RegisterProviderServer(srv, plugin)
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+}
+
+// selfSignedCert returns a certificate for 127.0.0.1 and its PEM encoding
+func selfSignedCert(t *testing.T) (tls.Certificate, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "plugin"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("creating certificate: %v", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestNewPluginProviderValidatesSettings(t *testing.T) {
+	tests := []struct {
+		name     string
+		settings map[string]string
+		wantErr  string
+	}{
+		{name: "neither", settings: nil, wantErr: "plugin_name or plugin_address is required"},
+		{name: "both", settings: map[string]string{"plugin_name": "example", "plugin_address": "localhost:1"}, wantErr: "only one of"},
+		{name: "path", settings: map[string]string{"plugin_name": "../bin/sh"}, wantErr: "without a path"},
+		{name: "dot dot", settings: map[string]string{"plugin_name": ".."}, wantErr: "without a path"},
+		{name: "unlisted tcp address", settings: map[string]string{"plugin_address": "attacker.example:443"}, wantErr: "must be a unix:// socket or be listed in PLUGIN_ADDRESSES"},
+	}
+	t.Setenv("PLUGIN_ADDRESSES", "localhost:9000")
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewPluginProvider(ProviderConfig{Settings: tc.settings})
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestPluginProviderRequiresTLSForTCP(t *testing.T) {
+	cert, certPEM := selfSignedCert(t)
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, certPEM, 0o600); err != nil {
+		t.Fatalf("writing CA file: %v", err)
+	}
+	t.Setenv("PLUGIN_CA_FILE", caFile)
+
+	tlsLis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	servePlugin(t, &fakePlugin{}, tlsLis, grpc.Creds(credentials.NewServerTLSFromCert(&cert)))
+	plainLis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	servePlugin(t, &fakePlugin{}, plainLis)
+	t.Setenv("PLUGIN_ADDRESSES", tlsLis.Addr().String()+", "+plainLis.Addr().String())
+
+	provider, err := NewPluginProvider(ProviderConfig{Settings: map[string]string{"plugin_address": tlsLis.Addr().String()}})
+	if err != nil {
+		t.Fatalf("expected a listed TLS plugin to be accepted, got %v", err)
+	}
+	if got, want := provider.Capabilities(), (Capabilities{Append: true, Delete: true}); got != want {
+		t.Fatalf("expected capabilities %+v, got %+v", want, got)
+	}
+
+	if _, err := NewPluginProvider(ProviderConfig{Settings: map[string]string{"plugin_address": plainLis.Addr().String()}}); err == nil {
+		t.Fatal("expected the handshake with a plaintext TCP plugin to fail")
+	}
+}
+
+func TestPluginPoolLaunchesOutsideTheLock(t *testing.T) {
+	// The plugin never announces its address, so launching it hangs
+	dir := t.TempDir()
+	script := filepath.Join(dir, "hanging")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\necho started >> \"$0.log\"\nexec sleep 30\n"), 0o755); err != nil {
+		t.Fatalf("writing plugin: %v", err)
+	}
+	address := serveFakePlugin(t, &fakePlugin{})
+	pool := &pluginPool{entries: make(map[pluginTarget]*pluginEntry)}
+	hanging := pluginTarget{command: script}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 2)
+	for range 2 {
+		go func() {
+			_, err := pool.get(ctx, hanging)
+			errs <- err
+		}()
+	}
+
+	// Another target connects while the hanging plugin is being launched
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if log, _ := os.ReadFile(script + ".log"); len(log) > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the hanging plugin was not launched")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	getCtx, getCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer getCancel()
+	if _, err := pool.get(getCtx, pluginTarget{address: address}); err != nil {
+		t.Fatalf("expected another target to connect while a plugin launches, got %v", err)
+	}
+
+	cancel()
+	for range 2 {
+		if err := <-errs; err == nil || !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected the launch to be canceled, got %v", err)
+		}
+	}
+	if log, _ := os.ReadFile(script + ".log"); strings.Count(string(log), "started") != 1 {
+		t.Fatalf("expected the plugin to be launched once, got %q", log)
+	}
+	if _, ok := pool.entries[hanging]; ok {
+		t.Fatal("expected the failed launch to be forgotten")
+	}
+}
+
+func TestLaunchPluginReapsFailedPlugins(t *testing.T) {
+	dir := t.TempDir()
+	script := filepath.Join(dir, "garbage")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\necho $$ > \"$0.pid\"\necho garbage\nexec sleep 30\n"), 0o755); err != nil {
+		t.Fatalf("writing plugin: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, _, _, err := launchPlugin(ctx, script); err == nil || !strings.Contains(err.Error(), "libdns-plugin") {
+		t.Fatalf("expected the bad announcement to be rejected, got %v", err)
+	}
+
+	raw, err := os.ReadFile(script + ".pid")
+	if err != nil {
+		t.Fatalf("reading the plugin's pid: %v", err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(raw)))
+	if err != nil {
+		t.Fatalf("parsing the plugin's pid: %v", err)
+	}
+	// A zombie still accepts signal 0; a reaped process is gone
+	if err := syscall.Kill(pid, 0); !errors.Is(err, syscall.ESRCH) {
+		t.Fatalf("expected the failed plugin to be reaped, got %v", err)
+	}
+}
+
+func TestNewPluginProviderReportsMissingBinary(t *testing.T) {
+	t.Setenv("PLUGIN_DIR", t.TempDir())
+	_, err := NewPluginProvider(ProviderConfig{Settings: map[string]string{"plugin_name": "missing"}})
+	if err == nil || !strings.Contains(err.Error(), "starting") {
+		t.Fatalf("expected a start error, got %v", err)
+	}
+}
+
+func TestPluginProviderForwardsConfigAndCapabilities(t *testing.T) {
+	fake := &fakePlugin{}
+	address := serveFakePlugin(t, fake)
+
+	provider, err := CreateProvider("plugin", ProviderConfig{
+		Credentials: map[string]string{"api_token": "secret"},
+		Settings:    map[string]string{"plugin_address": address, "region": "eu"},
+	})
+	if err != nil {
+		t.Fatalf("CreateProvider failed: %v", err)
+	}
+
+	if len(fake.handshakes) != 1 {
+		t.Fatalf("expected one handshake, got %d", len(fake.handshakes))
+	}
+	hs := fake.handshakes[0]
+	if hs.Credentials["api_token"] != "secret" || hs.Settings["region"] != "eu" {
+		t.Fatalf("expected credentials and settings to be forwarded, got %+v", hs)
+	}
+	if _, ok := hs.Settings["plugin_address"]; ok {
+		t.Fatalf("expected plugin_address not to be forwarded, got %+v", hs.Settings)
+	}
+	if got, want := CapabilitiesOf(provider), (Capabilities{Append: true, Delete: true}); got != want {
+		t.Fatalf("expected capabilities %+v, got %+v", want, got)
+	}
+
+	_, err = GetRecords(context.Background(), provider, "example.com.")
+	if !errors.Is(err, ErrUnsupported) {
+		t.Fatalf("expected ErrUnsupported for get, got %v", err)
+	}
+}
+
+func TestPluginProviderRepeatsHandshakeForUnknownSession(t *testing.T) {
+	fake := &fakePlugin{}
+	address := serveFakePlugin(t, fake)
+	provider, err := NewPluginProvider(ProviderConfig{Settings: map[string]string{"plugin_address": address}})
+	if err != nil {
+		t.Fatalf("NewPluginProvider failed: %v", err)
+	}
+
+	// A restarted plugin forgets its sessions
+	fake.mu.Lock()
+	clear(fake.sessions)
+	fake.mu.Unlock()
+
+	recs := []libdns.Record{libdns.TXT{Name: "_acme-challenge", Text: "token", TTL: time.Minute}}
+	if _, err := AppendRecords(context.Background(), provider, "example.com.", recs); err != nil {
+		t.Fatalf("AppendRecords failed: %v", err)
+	}
+	if len(fake.handshakes) != 2 {
+		t.Fatalf("expected the handshake to be repeated, got %d handshakes", len(fake.handshakes))
+	}
+	if len(fake.records) != 1 || fake.records[0] != (protocol.Record{Name: "_acme-challenge", Type: "TXT", Data: "token", TTL: 60}) {
+		t.Fatalf("expected the record to reach the plugin, got %+v", fake.records)
+	}
+}
+
+func TestPluginProviderPassesErrorDetails(t *testing.T) {
+	fake := &fakePlugin{deleteErr: errors.New("rate limited")}
+	address := serveFakePlugin(t, fake)
+	provider, err := NewPluginProvider(ProviderConfig{Settings: map[string]string{"plugin_address": address}})
+	if err != nil {
+		t.Fatalf("NewPluginProvider failed: %v", err)
+	}
+
+	_, err = DeleteRecords(context.Background(), provider, "example.com.", []libdns.Record{libdns.TXT{Name: "_acme-challenge", Text: "token"}})
+	var pluginErr *PluginError
+	if !errors.As(err, &pluginErr) {
+		t.Fatalf("expected a PluginError, got %v", err)
+	}
+	if pluginErr.StatusCode() != 429 || pluginErr.RetryAfter() != 7*time.Second {
+		t.Fatalf("expected status 429 and retry after 7s, got %d and %v", pluginErr.StatusCode(), pluginErr.RetryAfter())
+	}
+	if !strings.Contains(err.Error(), "rate limited") {
+		t.Fatalf("expected the plugin's message, got %v", err)
+	}
+}
@@ -0,0 +1,177 @@
+// Package records inspects which libdns record interfaces a provider
+// implements and calls them. It depends on libdns only, so plugins can use
+// it without linking in the webhook's providers.
+package records
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/libdns/libdns"
+)
+
+// ErrUnsupported is returned when a provider lacks the libdns interface of
+// the requested operation
+var ErrUnsupported = errors.New("operation not supported by provider")
+
+// Capabilities reports which record operations a provider implements
+type Capabilities struct {
+	// Get is true for a libdns.RecordGetter or a RecordLookup
+	Get bool
+
+	Append bool
+	Set    bool
+	Delete bool
+}
+
+// CapabilityReporter is implemented by providers whose operations are only
+// known at runtime, such as plugins. They implement every record interface
+// and return ErrUnsupported for the operations not reported.
+type CapabilityReporter interface {
+	Capabilities() Capabilities
+}
+
+// CapabilitiesOf inspects which libdns record interfaces provider implements,
+// or asks a CapabilityReporter
+func CapabilitiesOf(provider any) Capabilities {
+	if reporter, ok := provider.(CapabilityReporter); ok {
+		return reporter.Capabilities()
+	}
+	return TypeCapabilities(reflect.TypeOf(provider))
+}
+
+var (
+	getterType   = reflect.TypeFor[libdns.RecordGetter]()
+	lookupType   = reflect.TypeFor[RecordLookup]()
+	appenderType = reflect.TypeFor[libdns.RecordAppender]()
+	setterType   = reflect.TypeFor[libdns.RecordSetter]()
+	deleterType  = reflect.TypeFor[libdns.RecordDeleter]()
+)
+
+// TypeCapabilities reports which libdns record interfaces values of type t
+// implement; a nil type implements none
+func TypeCapabilities(t reflect.Type) Capabilities {
+	if t == nil {
+		return Capabilities{}
+	}
+	return Capabilities{
+		Get:    t.Implements(getterType) || t.Implements(lookupType),
+		Append: t.Implements(appenderType),
+		Set:    t.Implements(setterType),
+		Delete: t.Implements(deleterType),
+	}
+}
+
+// CanMerge reports whether the TXT record set can be read and rewritten as
+// a whole, which keeps the values of other challenges
+func (c Capabilities) CanMerge() bool {
+	return c.Get && c.Set
+}
+
+// Validate returns an error unless the capabilities suffice to add a
+// challenge value (append, or get and set) and remove it again (delete, or
+// get and set)
+func (c Capabilities) Validate() error {
+	var missing []string
+	if !c.Append && !c.CanMerge() {
+		missing = append(missing, "adding records needs append, or get and set")
+	}
+	if !c.Delete && !c.CanMerge() {
+		missing = append(missing, "removing records needs delete, or get and set")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("provider supports %s: %s", c, strings.Join(missing, "; "))
+	}
+	return nil
+}
+
+// String lists the supported operations, e.g. "append, delete"
+func (c Capabilities) String() string {
+	var ops []string
+	for _, op := range []struct {
+		name string
+		ok   bool
+	}{{"get", c.Get}, {"append", c.Append}, {"set", c.Set}, {"delete", c.Delete}} {
+		if op.ok {
+			ops = append(ops, op.name)
+		}
+	}
+	if len(ops) == 0 {
+		return "no record operations"
+	}
+	return strings.Join(ops, ", ")
+}
+
+// GetRecords lists the records of zone, or returns ErrUnsupported if the
+// provider is no libdns.RecordGetter
+func GetRecords(ctx context.Context, provider any, zone string) ([]libdns.Record, error) {
+	getter, ok := provider.(libdns.RecordGetter)
+	if !ok {
+		return nil, fmt.Errorf("get records: %w", ErrUnsupported)
+	}
+	return getter.GetRecords(ctx, zone)
+}
+
+// AppendRecords adds recs to zone, or returns ErrUnsupported if the provider
+// is no libdns.RecordAppender
+func AppendRecords(ctx context.Context, provider any, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	appender, ok := provider.(libdns.RecordAppender)
+	if !ok {
+		return nil, fmt.Errorf("append records: %w", ErrUnsupported)
+	}
+	return appender.AppendRecords(ctx, zone, recs)
+}
+
+// SetRecords sets recs in zone, or returns ErrUnsupported if the provider is
+// no libdns.RecordSetter
+func SetRecords(ctx context.Context, provider any, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	setter, ok := provider.(libdns.RecordSetter)
+	if !ok {
+		return nil, fmt.Errorf("set records: %w", ErrUnsupported)
+	}
+	return setter.SetRecords(ctx, zone, recs)
+}
+
+// DeleteRecords removes recs from zone, or returns ErrUnsupported if the
+// provider is no libdns.RecordDeleter
+func DeleteRecords(ctx context.Context, provider any, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	deleter, ok := provider.(libdns.RecordDeleter)
+	if !ok {
+		return nil, fmt.Errorf("delete records: %w", ErrUnsupported)
+	}
+	return deleter.DeleteRecords(ctx, zone, recs)
+}
+
+// RecordLookup is an optional interface for providers whose API can return the
+// records of a single name and type, so large zones need not be listed in full
+type RecordLookup interface {
+	// GetRecordsByName returns the records of recordType at name, which is
+	// relative to zone as in libdns ("@" for the apex). A name without records
+	// is not an error.
+	GetRecordsByName(ctx context.Context, zone, name, recordType string) ([]libdns.Record, error)
+}
+
+// GetRecordsByName returns the records of recordType at name using the
+// provider's RecordLookup if it has one, and otherwise by filtering
+// GetRecords. Providers with neither return ErrUnsupported.
+func GetRecordsByName(ctx context.Context, provider any, zone, name, recordType string) ([]libdns.Record, error) {
+	if lookup, ok := provider.(RecordLookup); ok {
+		return lookup.GetRecordsByName(ctx, zone, name, recordType)
+	}
+
+	all, err := GetRecords(ctx, provider, zone)
+	if err != nil {
+		return nil, err
+	}
+	var records []libdns.Record
+	for _, rec := range all {
+		rr := rec.RR()
+		if rr.Type == recordType && rr.Name == name {
+			records = append(records, rec)
+		}
+	}
+	return records, nil
+}
@@ -0,0 +1,31 @@
+package records
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCapabilitiesValidate(t *testing.T) {
+	tests := []struct {
+		caps    Capabilities
+		wantErr string
+	}{
+		{caps: Capabilities{Get: true, Append: true, Set: true, Delete: true}},
+		{caps: Capabilities{Append: true, Delete: true}},
+		{caps: Capabilities{Get: true, Set: true}},
+		{caps: Capabilities{Get: true, Append: true, Delete: true}},
+		{caps: Capabilities{Append: true}, wantErr: "provider supports append: removing records needs delete, or get and set"},
+		{caps: Capabilities{Set: true, Delete: true}, wantErr: "provider supports set, delete: adding records needs append, or get and set"},
+		{caps: Capabilities{Get: true}, wantErr: "adding records needs append, or get and set; removing records needs delete, or get and set"},
+		{caps: Capabilities{}, wantErr: "provider supports no record operations"},
+	}
+	for _, tc := range tests {
+		err := tc.caps.Validate()
+		if tc.wantErr == "" && err != nil {
+			t.Errorf("%s: unexpected error %v", tc.caps, err)
+		}
+		if tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)) {
+			t.Errorf("%s: expected error containing %q, got %v", tc.caps, tc.wantErr, err)
+		}
+	}
+}
@@ -1,107 +1,222 @@
 package providers
 
 import (
-	"context"
 	"fmt"
+	"reflect"
 	"sort"
 	"sync"
-
-	"github.com/libdns/libdns"
+	"time"
 )
 
-// DNSProvider combines the libdns interfaces needed for ACME DNS-01 challenges
-type DNSProvider interface {
-	libdns.RecordAppender
-	libdns.RecordDeleter
-	libdns.RecordGetter
-	libdns.RecordSetter
-}
+// DNSProvider is a provider instance implementing some of
+// libdns.RecordGetter, RecordAppender, RecordSetter and RecordDeleter.
+// CapabilitiesOf reports which. Go cannot express the valid combinations as
+// one interface, so RegisterWith checks them for the factory's provider type
+// and Create checks them again for a CapabilityReporter.
+type DNSProvider any
 
 // ProviderConfig holds the configuration needed to instantiate a provider
 type ProviderConfig struct {
 	// Provider-specific configuration as key-value pairs
 	// Populated from Kubernetes Secret data
 	Credentials map[string]string
+
+	// Settings are non-secret options such as regions and endpoints
+	// Populated from the issuer's options and its referenced ConfigMap
+	Settings map[string]string
+}
+
+// Setting returns the non-secret option key. A value in Settings takes
+// precedence over one of the same name in Credentials, which is still read
+// so that Secrets holding the option keep working.
+func (c ProviderConfig) Setting(key string) string {
+	if value := c.Settings[key]; value != "" {
+		return value
+	}
+	return c.Credentials[key]
 }
 
 // ProviderFactory creates a DNSProvider from configuration
 type ProviderFactory func(config ProviderConfig) (DNSProvider, error)
 
-// Registry holds all registered provider factories
+// Key is a credential or setting read by a provider factory
+type Key struct {
+	Name        string
+	Description string
+}
+
+// Descriptor describes what a provider needs and accepts
+type Descriptor struct {
+	// RequiredCredentials and OptionalCredentials are read from Secrets
+	RequiredCredentials []Key
+	OptionalCredentials []Key
+
+	// RequiredSettings and OptionalSettings are non-secret options, read
+	// from the issuer's options, a ConfigMap or a Secret
+	RequiredSettings []Key
+	OptionalSettings []Key
+
+	// MinTTL and MaxTTL bound the record TTL the provider's API accepts;
+	// zero means no bound
+	MinTTL time.Duration
+	MaxTTL time.Duration
+
+	// AmbientCredentials is true if the provider can authenticate without
+	// credentials, e.g. from a workload identity
+	AmbientCredentials bool
+
+	// Passthrough is true if the provider forwards credentials and settings
+	// it does not declare, so unknown keys are accepted
+	Passthrough bool
+
+	// DocsURL points to the provider's documentation
+	DocsURL string
+}
+
+// Keys returns the names of all credentials and settings the provider reads
+func (d Descriptor) Keys() []string {
+	var names []string
+	for _, keys := range [][]Key{d.RequiredCredentials, d.OptionalCredentials, d.RequiredSettings, d.OptionalSettings} {
+		for _, k := range keys {
+			names = append(names, k.Name)
+		}
+	}
+	return names
+}
+
+// ClampTTL raises or lowers ttl into the range the provider accepts
+func (d Descriptor) ClampTTL(ttl time.Duration) time.Duration {
+	if d.MinTTL > 0 && ttl < d.MinTTL {
+		return d.MinTTL
+	}
+	if d.MaxTTL > 0 && ttl > d.MaxTTL {
+		return d.MaxTTL
+	}
+	return ttl
+}
+
+// Registry holds registered provider factories and their descriptors
 type Registry struct {
-	mu        sync.RWMutex
-	factories map[string]ProviderFactory
+	mu          sync.RWMutex
+	factories   map[string]ProviderFactory
+	descriptors map[string]Descriptor
 }
 
-// globalRegistry is the default registry instance
-var globalRegistry = &Registry{
-	factories: make(map[string]ProviderFactory),
+// NewRegistry returns an empty registry
+func NewRegistry() *Registry {
+	return &Registry{
+		factories:   make(map[string]ProviderFactory),
+		descriptors: make(map[string]Descriptor),
+	}
 }
 
-// Register adds a provider factory to the global registry
-func Register(name string, factory ProviderFactory) {
-	globalRegistry.mu.Lock()
-	defer globalRegistry.mu.Unlock()
-	globalRegistry.factories[name] = factory
+// globalRegistry is the default registry the providers' init functions
+// register with
+var globalRegistry = NewRegistry()
+
+// DefaultRegistry returns the registry holding the compiled-in providers
+func DefaultRegistry() *Registry {
+	return globalRegistry
 }
 
-// Get retrieves a provider factory by name from the global registry
-func Get(name string) (ProviderFactory, error) {
-	globalRegistry.mu.RLock()
-	defer globalRegistry.mu.RUnlock()
+// RegisterWith adds a provider factory and its descriptor to r, replacing a
+// provider of the same name. It panics if providers of type P lack the
+// capabilities to solve challenges, so such a provider fails at start-up
+// instead of at its first challenge.
+func RegisterWith[P DNSProvider](r *Registry, name string, factory func(ProviderConfig) (P, error), descriptor Descriptor) {
+	if err := checkProviderType(reflect.TypeFor[P]()); err != nil {
+		panic(fmt.Sprintf("providers: cannot register %s: %v", name, err))
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.factories[name] = func(config ProviderConfig) (DNSProvider, error) {
+		provider, err := factory(config)
+		if err != nil {
+			// Do not wrap a typed nil in a non-nil DNSProvider
+			return nil, err
+		}
+		return provider, nil
+	}
+	r.descriptors[name] = descriptor
+}
+
+// Describe returns the descriptor of a provider
+func (r *Registry) Describe(name string) (Descriptor, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	descriptor, ok := r.descriptors[name]
+	if !ok {
+		return Descriptor{}, fmt.Errorf("unknown DNS provider: %s", name)
+	}
+	return descriptor, nil
+}
+
+// Get retrieves a provider factory by name
+func (r *Registry) Get(name string) (ProviderFactory, error) {
+	r.mu.RLock()
+	factory, ok := r.factories[name]
+	r.mu.RUnlock()
 
-	factory, ok := globalRegistry.factories[name]
 	if !ok {
-		return nil, fmt.Errorf("unknown DNS provider: %s (available: %v)", name, ListProviders())
+		return nil, fmt.Errorf("unknown DNS provider: %s (available: %v)", name, r.List())
 	}
 	return factory, nil
 }
 
-// ListProviders returns all registered provider names
-func ListProviders() []string {
-	globalRegistry.mu.RLock()
-	defer globalRegistry.mu.RUnlock()
+// List returns all registered provider names, sorted
+func (r *Registry) List() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
 
-	names := make([]string, 0, len(globalRegistry.factories))
-	for name := range globalRegistry.factories {
+	names := make([]string, 0, len(r.factories))
+	for name := range r.factories {
 		names = append(names, name)
 	}
 	sort.Strings(names)
 	return names
 }
 
-// CreateProvider is a convenience function that gets and invokes a provider factory
-func CreateProvider(name string, config ProviderConfig) (DNSProvider, error) {
-	factory, err := Get(name)
+// Create gets and invokes a provider factory and checks that the provider
+// has the capabilities to solve challenges; only a CapabilityReporter can
+// fail this check after RegisterWith accepted its type
+func (r *Registry) Create(name string, config ProviderConfig) (DNSProvider, error) {
+	factory, err := r.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	provider, err := factory(config)
 	if err != nil {
 		return nil, err
 	}
-	return factory(config)
+	if err := CapabilitiesOf(provider).Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return provider, nil
 }
 
-// Ensure DNSProvider interface is compatible with libdns at compile time
-var _ DNSProvider = (*wrappedProvider)(nil)
-
-// wrappedProvider is a compile-time check helper
-type wrappedProvider struct {
-	libdns.RecordAppender
-	libdns.RecordDeleter
-	libdns.RecordGetter
-	libdns.RecordSetter
+// Register adds a provider factory and its descriptor to the global registry
+func Register[P DNSProvider](name string, factory func(ProviderConfig) (P, error), descriptor Descriptor) {
+	RegisterWith(globalRegistry, name, factory, descriptor)
 }
 
-func (w *wrappedProvider) AppendRecords(ctx context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
-	return w.RecordAppender.AppendRecords(ctx, zone, recs)
+// Describe returns the descriptor of a provider from the global registry
+func Describe(name string) (Descriptor, error) {
+	return globalRegistry.Describe(name)
 }
 
-func (w *wrappedProvider) DeleteRecords(ctx context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
-	return w.RecordDeleter.DeleteRecords(ctx, zone, recs)
+// Get retrieves a provider factory by name from the global registry
+func Get(name string) (ProviderFactory, error) {
+	return globalRegistry.Get(name)
 }
 
-func (w *wrappedProvider) GetRecords(ctx context.Context, zone string) ([]libdns.Record, error) {
-	return w.RecordGetter.GetRecords(ctx, zone)
+// ListProviders returns all provider names in the global registry
+func ListProviders() []string {
+	return globalRegistry.List()
 }
 
-func (w *wrappedProvider) SetRecords(ctx context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
-	return w.RecordSetter.SetRecords(ctx, zone, recs)
+// CreateProvider is a convenience function that gets and invokes a provider
+// factory from the global registry
+func CreateProvider(name string, config ProviderConfig) (DNSProvider, error) {
+	return globalRegistry.Create(name, config)
 }
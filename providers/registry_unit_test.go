@@ -0,0 +1,98 @@
+package providers
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+// stubProvider satisfies DNSProvider without doing anything
+type stubProvider struct{}
+
+func (stubProvider) AppendRecords(context.Context, string, []libdns.Record) ([]libdns.Record, error) {
+	return nil, nil
+}
+
+func (stubProvider) DeleteRecords(context.Context, string, []libdns.Record) ([]libdns.Record, error) {
+	return nil, nil
+}
+
+func (stubProvider) GetRecords(context.Context, string) ([]libdns.Record, error) {
+	return nil, nil
+}
+
+func (stubProvider) SetRecords(context.Context, string, []libdns.Record) ([]libdns.Record, error) {
+	return nil, nil
+}
+
+func TestBuiltinProvidersAreDescribed(t *testing.T) {
+	for _, name := range ListProviders() {
+		d, err := Describe(name)
+		if err != nil {
+			t.Fatalf("Describe(%s) failed: %v", name, err)
+		}
+		if len(d.RequiredCredentials) == 0 && !d.Passthrough {
+			t.Errorf("%s describes no required credentials", name)
+		}
+		if d.DocsURL == "" {
+			t.Errorf("%s has no docs URL", name)
+		}
+	}
+
+	if _, err := Describe("nonexistent"); err == nil {
+		t.Fatal("expected an error for an unknown provider")
+	}
+}
+
+func TestRegistriesAreIndependent(t *testing.T) {
+	r := NewRegistry()
+	RegisterWith(r, "stub", func(ProviderConfig) (stubProvider, error) {
+		return stubProvider{}, nil
+	}, Descriptor{MinTTL: time.Minute})
+
+	if got := r.List(); !slices.Equal(got, []string{"stub"}) {
+		t.Fatalf("expected only the stub provider, got %v", got)
+	}
+	if d, err := r.Describe("stub"); err != nil || d.MinTTL != time.Minute {
+		t.Fatalf("expected the stub descriptor, got %+v, %v", d, err)
+	}
+	if _, err := r.Create("stub", ProviderConfig{}); err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if slices.Contains(ListProviders(), "stub") {
+		t.Fatal("registering with a new registry changed the global registry")
+	}
+
+	for _, name := range ListProviders() {
+		if _, err := r.Get(name); err == nil {
+			t.Fatalf("new registry unexpectedly holds the compiled-in provider %s", name)
+		}
+	}
+	if _, err := r.Create("nonexistent", ProviderConfig{}); err == nil {
+		t.Fatal("expected an error for an unknown provider")
+	}
+}
+
+func TestDescriptorClampTTL(t *testing.T) {
+	d := Descriptor{MinTTL: time.Minute, MaxTTL: time.Hour}
+	tests := []struct {
+		ttl  time.Duration
+		want time.Duration
+	}{
+		{ttl: 30 * time.Second, want: time.Minute},
+		{ttl: 5 * time.Minute, want: 5 * time.Minute},
+		{ttl: 2 * time.Hour, want: time.Hour},
+	}
+	for _, tc := range tests {
+		if got := d.ClampTTL(tc.ttl); got != tc.want {
+			t.Errorf("ClampTTL(%s) = %s, want %s", tc.ttl, got, tc.want)
+		}
+	}
+
+	if got := (Descriptor{}).ClampTTL(time.Second); got != time.Second {
+		t.Errorf("expected no bounds without MinTTL and MaxTTL, got %s", got)
+	}
+}
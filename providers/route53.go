@@ -1,13 +1,52 @@
+//go:build !slim || route53
+
 package providers
 
 import (
+	"context"
 	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	r53 "github.com/aws/aws-sdk-go-v2/service/route53"
+	"github.com/aws/aws-sdk-go-v2/service/route53/types"
+	"github.com/libdns/libdns"
 	"github.com/libdns/route53"
 )
 
 func init() {
-	Register("route53", NewRoute53Provider)
+	Register("route53", NewRoute53Provider, Descriptor{
+		RequiredCredentials: []Key{
+			{Name: "access_key_id", Description: "AWS access key ID"},
+			{Name: "secret_access_key", Description: "AWS secret access key"},
+		},
+		OptionalCredentials: []Key{
+			{Name: "session_token", Description: "AWS session token (for temporary credentials)"},
+		},
+		OptionalSettings: []Key{
+			{Name: "region", Description: "AWS region (default: us-east-1)"},
+		},
+		DocsURL: "https://github.com/libdns/route53",
+	})
+}
+
+// route53Provider adds record set lookups to the libdns Route53 provider
+type route53Provider struct {
+	*route53.Provider
+
+	// endpoint overrides the Route53 API endpoint; empty uses the default
+	endpoint string
+
+	clientMu sync.Mutex
+	client   *r53.Client
+
+	// zoneIDs caches zone name to hosted zone ID lookups
+	zoneIDs sync.Map
 }
 
 // NewRoute53Provider creates an AWS Route53 DNS provider
@@ -17,9 +56,11 @@ func init() {
 //   - secret_access_key: AWS secret access key
 //
 // Optional credentials:
-//   - region: AWS region (default: us-east-1)
 //   - session_token: AWS session token (for temporary credentials)
-func NewRoute53Provider(config ProviderConfig) (DNSProvider, error) {
+//
+// Optional settings:
+//   - region: AWS region (default: us-east-1)
+func NewRoute53Provider(config ProviderConfig) (*route53Provider, error) {
 	accessKeyID := config.Credentials["access_key_id"]
 	secretAccessKey := config.Credentials["secret_access_key"]
 
@@ -35,7 +76,7 @@ func NewRoute53Provider(config ProviderConfig) (DNSProvider, error) {
 		SecretAccessKey: secretAccessKey,
 	}
 
-	if region := config.Credentials["region"]; region != "" {
+	if region := config.Setting("region"); region != "" {
 		provider.Region = region
 	}
 
@@ -43,5 +84,136 @@ func NewRoute53Provider(config ProviderConfig) (DNSProvider, error) {
 		provider.SessionToken = sessionToken
 	}
 
-	return provider, nil
+	return &route53Provider{Provider: provider}, nil
+}
+
+func (p *route53Provider) route53Client(ctx context.Context) (*r53.Client, error) {
+	p.clientMu.Lock()
+	defer p.clientMu.Unlock()
+	if p.client != nil {
+		return p.client, nil
+	}
+
+	region := p.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	cfg, err := config.LoadDefaultConfig(ctx,
+		config.WithRegion(region),
+		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(p.AccessKeyId, p.SecretAccessKey, p.SessionToken)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("route53: loading AWS config: %w", err)
+	}
+	p.client = r53.NewFromConfig(cfg, func(o *r53.Options) {
+		if p.endpoint != "" {
+			o.BaseEndpoint = aws.String(p.endpoint)
+		}
+	})
+	return p.client, nil
+}
+
+// GetRecordsByName lists the record sets starting at name and type
+func (p *route53Provider) GetRecordsByName(ctx context.Context, zone, name, recordType string) ([]libdns.Record, error) {
+	client, err := p.route53Client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	zone = strings.TrimSuffix(zone, ".") + "."
+	zoneID, err := p.zoneID(ctx, client, zone)
+	if err != nil {
+		return nil, err
+	}
+
+	fqdn := libdns.AbsoluteName(name, zone)
+	out, err := client.ListResourceRecordSets(ctx, &r53.ListResourceRecordSetsInput{
+		HostedZoneId:    aws.String(zoneID),
+		StartRecordName: aws.String(fqdn),
+		StartRecordType: types.RRType(recordType),
+		MaxItems:        aws.Int32(100),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("route53: %w", err)
+	}
+
+	var records []libdns.Record
+	for _, set := range out.ResourceRecordSets {
+		// Sets are sorted by name and type; stop at the first one past ours
+		if !strings.EqualFold(route53Unescape(aws.ToString(set.Name)), fqdn) || string(set.Type) != recordType {
+			break
+		}
+		var ttl time.Duration
+		if set.TTL != nil {
+			ttl = time.Duration(*set.TTL) * time.Second
+		}
+		for _, rr := range set.ResourceRecords {
+			value := aws.ToString(rr.Value)
+			if recordType == "TXT" || recordType == "SPF" {
+				value = route53UnquoteTXT(value)
+			}
+			rec, err := libdns.RR{Name: name, TTL: ttl, Type: recordType, Data: value}.Parse()
+			if err != nil {
+				return nil, fmt.Errorf("route53: parsing %s record %q: %w", recordType, value, err)
+			}
+			records = append(records, withProviderData(rec, &set))
+		}
+	}
+	return records, nil
+}
+
+// zoneID resolves and caches the hosted zone ID of zone
+func (p *route53Provider) zoneID(ctx context.Context, client *r53.Client, zone string) (string, error) {
+	if p.HostedZoneID != "" {
+		return "/hostedzone/" + p.HostedZoneID, nil
+	}
+	if id, ok := p.zoneIDs.Load(zone); ok {
+		return id.(string), nil
+	}
+
+	out, err := client.ListHostedZonesByName(ctx, &r53.ListHostedZonesByNameInput{
+		DNSName:  aws.String(zone),
+		MaxItems: aws.Int32(1),
+	})
+	if err != nil {
+		return "", fmt.Errorf("route53: %w", err)
+	}
+	if len(out.HostedZones) == 0 || !strings.EqualFold(aws.ToString(out.HostedZones[0].Name), zone) {
+		return "", fmt.Errorf("route53: hosted zone not found: %s", zone)
+	}
+
+	id := aws.ToString(out.HostedZones[0].Id)
+	p.zoneIDs.Store(zone, id)
+	return id, nil
+}
+
+// route53UnquoteTXT joins the quoted strings of a TXT value and resolves
+// Route53's escapes, matching the libdns provider
+func route53UnquoteTXT(value string) string {
+	parts := strings.Split(value, `" "`)
+	parts[0] = strings.TrimPrefix(parts[0], `"`)
+	parts[len(parts)-1] = strings.TrimSuffix(parts[len(parts)-1], `"`)
+	return route53Unescape(strings.Join(parts, ""))
+}
+
+// route53Unescape resolves \" \\ and \DDD octal escapes
+func route53Unescape(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			switch {
+			case s[i+1] == '"' || s[i+1] == '\\':
+				sb.WriteByte(s[i+1])
+				i++
+				continue
+			case i+3 < len(s) && s[i+1] >= '0' && s[i+1] <= '7':
+				if octal, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+					sb.WriteByte(byte(octal))
+					i += 3
+					continue
+				}
+			}
+		}
+		sb.WriteByte(s[i])
+	}
+	return sb.String()
 }
@@ -0,0 +1,42 @@
+//go:build !slim || route53
+
+package providers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+func TestRoute53GetRecordsByName(t *testing.T) {
+	const ns = `xmlns="https://route53.amazonaws.com/doc/2013-04-01/"`
+	server := startLookupServer(t, map[string]string{
+		"/2013-04-01/hostedzonesbyname": `<ListHostedZonesByNameResponse ` + ns + `><HostedZones><HostedZone>` +
+			`<Id>/hostedzone/Z1</Id><Name>example.com.</Name><CallerReference>ref</CallerReference></HostedZone></HostedZones>` +
+			`<IsTruncated>false</IsTruncated><MaxItems>1</MaxItems></ListHostedZonesByNameResponse>`,
+		"/2013-04-01/hostedzone/Z1/rrset": `<ListResourceRecordSetsResponse ` + ns + `><ResourceRecordSets>` +
+			`<ResourceRecordSet><Name>_acme-challenge.example.com.</Name><Type>TXT</Type><TTL>60</TTL><ResourceRecords>` +
+			`<ResourceRecord><Value>"split" "value"</Value></ResourceRecord>` +
+			`<ResourceRecord><Value>"ex\344mple"</Value></ResourceRecord>` +
+			`</ResourceRecords></ResourceRecordSet>` +
+			`<ResourceRecordSet><Name>www.example.com.</Name><Type>A</Type><TTL>60</TTL><ResourceRecords>` +
+			`<ResourceRecord><Value>192.0.2.1</Value></ResourceRecord></ResourceRecords></ResourceRecordSet>` +
+			`</ResourceRecordSets><IsTruncated>false</IsTruncated><MaxItems>100</MaxItems></ListResourceRecordSetsResponse>`,
+	})
+	p, err := NewRoute53Provider(ProviderConfig{Credentials: map[string]string{"access_key_id": "id", "secret_access_key": "secret"}})
+	if err != nil {
+		t.Fatalf("NewRoute53Provider failed: %v", err)
+	}
+	p.endpoint = server.URL
+
+	got, err := GetRecordsByName(context.Background(), p, "example.com", "_acme-challenge", "TXT")
+	if err != nil {
+		t.Fatalf("GetRecordsByName failed: %v", err)
+	}
+	assertTXT(t, got,
+		libdns.TXT{Name: "_acme-challenge", TTL: time.Minute, Text: "splitvalue"},
+		libdns.TXT{Name: "_acme-challenge", TTL: time.Minute, Text: "ex\xe4mple"},
+	)
+}
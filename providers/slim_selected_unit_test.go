@@ -0,0 +1,15 @@
+//go:build slim && desec && route53 && !alidns && !cloudflare && !hetzner && !linode && !ovh
+
+package providers
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSlimBuildIncludesOnlyTaggedProviders(t *testing.T) {
+	want := []string{"desec", "route53"}
+	if got := ListProviders(); !slices.Equal(got, want) {
+		t.Fatalf("expected providers %v with tags slim,desec,route53, got %v", want, got)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build slim && !alidns && !cloudflare && !desec && !hetzner && !linode && !ovh && !route53
+
+package providers
+
+import "testing"
+
+func TestSlimBuildWithoutProviderTagsHasNoProviders(t *testing.T) {
+	if got := ListProviders(); len(got) != 0 {
+		t.Fatalf("expected no providers in a slim build without provider tags, got %v", got)
+	}
+}
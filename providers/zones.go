@@ -0,0 +1,21 @@
+package providers
+
+import (
+	"context"
+	"errors"
+
+	"github.com/libdns/libdns"
+)
+
+// ErrZoneListingUnsupported is returned by ListZones for providers that do not
+// implement libdns.ZoneLister
+var ErrZoneListingUnsupported = errors.New("provider cannot list zones")
+
+// ListZones returns the zones hosted by the provider's account using its
+// libdns.ZoneLister, or ErrZoneListingUnsupported if it has none
+func ListZones(ctx context.Context, provider DNSProvider) ([]libdns.Zone, error) {
+	if lister, ok := provider.(libdns.ZoneLister); ok {
+		return lister.ListZones(ctx)
+	}
+	return nil, ErrZoneListingUnsupported
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/libdns/libdns"
+	"golang.org/x/time/rate"
+	"k8s.io/klog/v2"
+
+	"github.com/cert-manager-webhook-libdns/providers"
+)
+
+// RateLimitConfig throttles the API calls made to one provider account.
+// In issuer config, zero fields fall back to the provider's default; in a
+// resolved limit, zero means unlimited.
+type RateLimitConfig struct {
+	// RequestsPerSecond is the sustained API call rate
+	RequestsPerSecond float64 `json:"requestsPerSecond,omitempty"`
+
+	// Burst is the number of calls allowed above the sustained rate
+	Burst int `json:"burst,omitempty"`
+
+	// MaxInFlight caps concurrent API calls
+	MaxInFlight int `json:"maxInFlight,omitempty"`
+}
+
+// validate rejects negative limits
+func (c *RateLimitConfig) validate(errs *configErrors) {
+	if c == nil {
+		return
+	}
+	if c.RequestsPerSecond < 0 {
+		errs.addf("rateLimit.requestsPerSecond must not be negative, got %g", c.RequestsPerSecond)
+	}
+	if c.Burst < 0 {
+		errs.addf("rateLimit.burst must not be negative, got %d", c.Burst)
+	}
+	if c.MaxInFlight < 0 {
+		errs.addf("rateLimit.maxInFlight must not be negative, got %d", c.MaxInFlight)
+	}
+}
+
+// providerRateLimits are conservative defaults below each provider's documented
+// API limits. Other providers are not throttled unless the issuer asks for it.
+var providerRateLimits = map[string]RateLimitConfig{
+	"alidns":     {RequestsPerSecond: 10, Burst: 10, MaxInFlight: 4},
+	"cloudflare": {RequestsPerSecond: 4, Burst: 10, MaxInFlight: 4},
+	"desec":      {RequestsPerSecond: 1, Burst: 2, MaxInFlight: 1},
+	"hetzner":    {RequestsPerSecond: 1, Burst: 5, MaxInFlight: 2},
+	"linode":     {RequestsPerSecond: 10, Burst: 10, MaxInFlight: 4},
+	"ovh":        {RequestsPerSecond: 2, Burst: 5, MaxInFlight: 2},
+	"route53":    {RequestsPerSecond: 5, Burst: 5, MaxInFlight: 2},
+}
+
+// resolveRateLimit merges an issuer override over the provider's defaults
+func resolveRateLimit(providerName string, override *RateLimitConfig) RateLimitConfig {
+	limits := providerRateLimits[providerName]
+	if override == nil {
+		return limits
+	}
+	if override.RequestsPerSecond > 0 {
+		limits.RequestsPerSecond = override.RequestsPerSecond
+	}
+	if override.Burst > 0 {
+		limits.Burst = override.Burst
+	}
+	if override.MaxInFlight > 0 {
+		limits.MaxInFlight = override.MaxInFlight
+	}
+	return limits
+}
+
+// accountLimiter throttles the calls made with one set of credentials. Its
+// limits are updated in place, so calls waiting on it or holding a slot keep
+// counting when another issuer sets different limits for the account.
+type accountLimiter struct {
+	limiter  *rate.Limiter
+	inFlight inFlightLimit
+
+	mu       sync.Mutex
+	limits   RateLimitConfig
+	lastUsed time.Time
+}
+
+// setLimits applies limits to the token bucket and the in-flight cap
+func (l *accountLimiter) setLimits(limits RateLimitConfig) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.limits = limits
+	limit, burst := tokenBucket(limits)
+	l.limiter.SetLimit(limit)
+	l.limiter.SetBurst(burst)
+	l.inFlight.setLimit(limits.MaxInFlight)
+}
+
+// tokenBucket returns the rate and burst of limits, unlimited without a rate
+func tokenBucket(limits RateLimitConfig) (rate.Limit, int) {
+	if limits.RequestsPerSecond <= 0 {
+		return rate.Inf, 0
+	}
+	return rate.Limit(limits.RequestsPerSecond), max(limits.Burst, 1)
+}
+
+// currentLimits returns the limits in effect
+func (l *accountLimiter) currentLimits() RateLimitConfig {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limits
+}
+
+// inFlightLimit is a semaphore whose size can change while slots are held.
+// The zero value allows any number of calls.
+type inFlightLimit struct {
+	mu    sync.Mutex
+	limit int // 0 means unlimited
+	used  int
+	// freed is closed and cleared when a slot is released or the limit changes
+	freed chan struct{}
+}
+
+// acquire waits for a free slot or until ctx is done
+func (s *inFlightLimit) acquire(ctx context.Context) error {
+	for {
+		s.mu.Lock()
+		if s.limit <= 0 || s.used < s.limit {
+			s.used++
+			s.mu.Unlock()
+			return nil
+		}
+		if s.freed == nil {
+			s.freed = make(chan struct{})
+		}
+		freed := s.freed
+		s.mu.Unlock()
+
+		select {
+		case <-freed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// release frees a slot taken by acquire
+func (s *inFlightLimit) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.used--
+	s.wake()
+}
+
+// setLimit changes the number of slots; waiters recheck it
+func (s *inFlightLimit) setLimit(limit int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.limit = limit
+	s.wake()
+}
+
+// inUse reports whether any slot is held
+func (s *inFlightLimit) inUse() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.used > 0
+}
+
+func (s *inFlightLimit) wake() {
+	if s.freed != nil {
+		close(s.freed)
+		s.freed = nil
+	}
+}
+
+// rateLimiters holds one accountLimiter per provider account for the whole
+// process. The zero value is ready to use.
+type rateLimiters struct {
+	mu       sync.Mutex
+	accounts map[string]*accountLimiter
+
+	// idleTimeout drops limiters not used for this long (default: the
+	// provider cache's default idle timeout)
+	idleTimeout time.Duration
+
+	// now is overridable for tests
+	now func() time.Time
+}
+
+// get returns the limiter for account with limits applied. An account has a
+// single limiter however many issuers use it; the limits of the latest call
+// apply.
+func (r *rateLimiters) get(account string, limits RateLimitConfig) *accountLimiter {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.clock()
+	r.evictIdle(now)
+
+	l, ok := r.accounts[account]
+	if !ok {
+		if r.accounts == nil {
+			r.accounts = make(map[string]*accountLimiter)
+		}
+		// A new bucket starts full
+		l = &accountLimiter{limiter: rate.NewLimiter(tokenBucket(limits)), limits: limits}
+		l.inFlight.setLimit(limits.MaxInFlight)
+		r.accounts[account] = l
+	} else if current := l.currentLimits(); current != limits {
+		klog.V(2).Infof("Rate limits of %s changed from %+v to %+v", account, current, limits)
+		l.setLimits(limits)
+	}
+	l.mu.Lock()
+	l.lastUsed = now
+	l.mu.Unlock()
+	return l
+}
+
+// evictIdle drops limiters that have not been handed out within idleTimeout
+// and have no call in flight
+func (r *rateLimiters) evictIdle(now time.Time) {
+	idleTimeout := r.idleTimeout
+	if idleTimeout <= 0 {
+		idleTimeout = defaultProviderCacheIdleTimeout
+	}
+	for account, l := range r.accounts {
+		l.mu.Lock()
+		idle := now.Sub(l.lastUsed) > idleTimeout
+		l.mu.Unlock()
+		if idle && !l.inFlight.inUse() {
+			klog.V(3).Infof("Dropping idle rate limiter %s", account)
+			delete(r.accounts, account)
+		}
+	}
+}
+
+func (r *rateLimiters) clock() time.Time {
+	if r.now != nil {
+		return r.now()
+	}
+	return time.Now()
+}
+
+// rateLimitedProvider applies an accountLimiter to every call of a DNSProvider
+type rateLimitedProvider struct {
+	inner   providers.DNSProvider
+	name    string
+	limiter *accountLimiter
+}
+
+// newRateLimitedProvider wraps provider with the limiter shared by its account
+func newRateLimitedProvider(provider providers.DNSProvider, name string, limiter *accountLimiter) *rateLimitedProvider {
+	return &rateLimitedProvider{inner: provider, name: name, limiter: limiter}
+}
+
+func (r *rateLimitedProvider) unwrap() providers.DNSProvider { return r.inner }
+
+func (r *rateLimitedProvider) AppendRecords(ctx context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	return withRateLimit(ctx, r, "AppendRecords", func() ([]libdns.Record, error) {
+		return providers.AppendRecords(ctx, r.inner, zone, recs)
+	})
+}
+
+func (r *rateLimitedProvider) DeleteRecords(ctx context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	return withRateLimit(ctx, r, "DeleteRecords", func() ([]libdns.Record, error) {
+		return providers.DeleteRecords(ctx, r.inner, zone, recs)
+	})
+}
+
+func (r *rateLimitedProvider) GetRecords(ctx context.Context, zone string) ([]libdns.Record, error) {
+	return withRateLimit(ctx, r, "GetRecords", func() ([]libdns.Record, error) {
+		return providers.GetRecords(ctx, r.inner, zone)
+	})
+}
+
+func (r *rateLimitedProvider) GetRecordsByName(ctx context.Context, zone, name, recordType string) ([]libdns.Record, error) {
+	return withRateLimit(ctx, r, "GetRecordsByName", func() ([]libdns.Record, error) {
+		return providers.GetRecordsByName(ctx, r.inner, zone, name, recordType)
+	})
+}
+
+func (r *rateLimitedProvider) ListZones(ctx context.Context) ([]libdns.Zone, error) {
+	return withRateLimit(ctx, r, "ListZones", func() ([]libdns.Zone, error) {
+		return providers.ListZones(ctx, r.inner)
+	})
+}
+
+func (r *rateLimitedProvider) SetRecords(ctx context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	return withRateLimit(ctx, r, "SetRecords", func() ([]libdns.Record, error) {
+		return providers.SetRecords(ctx, r.inner, zone, recs)
+	})
+}
+
+// withRateLimit waits for an in-flight slot and a rate token, then runs call
+func withRateLimit[T any](ctx context.Context, r *rateLimitedProvider, op string, call func() (T, error)) (T, error) {
+	var zero T
+	start := time.Now()
+
+	if err := r.limiter.inFlight.acquire(ctx); err != nil {
+		return zero, fmt.Errorf("%s %s: waiting for in-flight slot: %w", r.name, op, err)
+	}
+	defer r.limiter.inFlight.release()
+
+	if err := r.limiter.limiter.Wait(ctx); err != nil {
+		return zero, fmt.Errorf("%s %s: waiting for rate limiter: %w", r.name, op, err)
+	}
+
+	if delay := time.Since(start); delay >= time.Millisecond {
+		limits := r.limiter.currentLimits()
+		klog.Infof("%s %s delayed %s by rate limiter (%.3g req/s, burst %d, max in-flight %d)",
+			r.name, op, delay.Round(time.Millisecond), limits.RequestsPerSecond, limits.Burst, limits.MaxInFlight)
+	}
+	return call()
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+// concurrencyProvider records the highest number of overlapping GetRecords calls
+type concurrencyProvider struct {
+	*mockProvider
+
+	current atomic.Int32
+	peak    atomic.Int32
+}
+
+func (c *concurrencyProvider) GetRecords(ctx context.Context, zone string) ([]libdns.Record, error) {
+	n := c.current.Add(1)
+	defer c.current.Add(-1)
+	for {
+		peak := c.peak.Load()
+		if n <= peak || c.peak.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+	return c.mockProvider.GetRecords(ctx, zone)
+}
+
+func TestRateLimitedProviderThrottlesCalls(t *testing.T) {
+	var limiters rateLimiters
+	limiter := limiters.get("mock|account", RateLimitConfig{RequestsPerSecond: 20, Burst: 1})
+	rp := newRateLimitedProvider(&mockProvider{}, "mock", limiter)
+
+	start := time.Now()
+	for range 3 {
+		if _, err := rp.GetRecords(context.Background(), "example.com"); err != nil {
+			t.Fatalf("GetRecords failed: %v", err)
+		}
+	}
+	// The first call uses the burst token, the next two wait 50ms each.
+	if elapsed := time.Since(start); elapsed < 90*time.Millisecond {
+		t.Fatalf("expected calls to be throttled to 20 req/s, 3 calls took %s", elapsed)
+	}
+}
+
+func TestRateLimitedProviderCapsInFlightCalls(t *testing.T) {
+	var limiters rateLimiters
+	limiter := limiters.get("mock|account", RateLimitConfig{MaxInFlight: 2})
+	cp := &concurrencyProvider{mockProvider: &mockProvider{}}
+	rp := newRateLimitedProvider(cp, "mock", limiter)
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Go(func() {
+			if _, err := rp.GetRecords(context.Background(), "example.com"); err != nil {
+				t.Errorf("GetRecords failed: %v", err)
+			}
+		})
+	}
+	wg.Wait()
+
+	if peak := cp.peak.Load(); peak > 2 {
+		t.Fatalf("expected at most 2 concurrent calls, got %d", peak)
+	}
+}
+
+func TestRateLimitedProviderHonorsContext(t *testing.T) {
+	var limiters rateLimiters
+	limiter := limiters.get("mock|account", RateLimitConfig{RequestsPerSecond: 0.01, Burst: 1})
+	rp := newRateLimitedProvider(&mockProvider{}, "mock", limiter)
+
+	if _, err := rp.GetRecords(context.Background(), "example.com"); err != nil {
+		t.Fatalf("GetRecords failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := rp.GetRecords(ctx, "example.com"); err == nil {
+		t.Fatal("expected GetRecords to fail when the context ends before a token is available")
+	}
+}
+
+func TestRateLimitersSharedPerAccount(t *testing.T) {
+	var limiters rateLimiters
+	limits := RateLimitConfig{RequestsPerSecond: 1, Burst: 1, MaxInFlight: 1}
+
+	a := limiters.get("cloudflare|"+credentialFingerprint(map[string]string{"api_token": "a"}), limits)
+	again := limiters.get("cloudflare|"+credentialFingerprint(map[string]string{"api_token": "a"}), limits)
+	other := limiters.get("cloudflare|"+credentialFingerprint(map[string]string{"api_token": "b"}), limits)
+
+	if a != again {
+		t.Fatal("expected the same account to share one limiter")
+	}
+	if a == other {
+		t.Fatal("expected different credentials to get separate limiters")
+	}
+
+	changed := limiters.get("cloudflare|"+credentialFingerprint(map[string]string{"api_token": "a"}), RateLimitConfig{RequestsPerSecond: 2, Burst: 1, MaxInFlight: 1})
+	if changed != a {
+		t.Fatal("expected changed limits to update the account's limiter in place")
+	}
+	if got := a.currentLimits().RequestsPerSecond; got != 2 {
+		t.Fatalf("expected the changed rate of 2 req/s, got %v", got)
+	}
+}
+
+func TestRateLimitersKeepInFlightCapAcrossLimitChanges(t *testing.T) {
+	var limiters rateLimiters
+	a := limiters.get("mock|account", RateLimitConfig{MaxInFlight: 1})
+	if err := a.inFlight.acquire(context.Background()); err != nil {
+		t.Fatalf("acquire failed: %v", err)
+	}
+
+	// Another issuer with other limits must not get a fresh semaphore
+	b := limiters.get("mock|account", RateLimitConfig{MaxInFlight: 1, RequestsPerSecond: 5})
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := b.inFlight.acquire(ctx); err == nil {
+		t.Fatal("expected the held slot to count for the other issuer")
+	}
+
+	// Raising the cap admits the waiting call
+	acquired := make(chan error, 1)
+	go func() { acquired <- b.inFlight.acquire(context.Background()) }()
+	limiters.get("mock|account", RateLimitConfig{MaxInFlight: 2})
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Fatalf("acquire failed: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected a raised cap to admit the waiting call")
+	}
+}
+
+func TestRateLimitersEvictIdleAccounts(t *testing.T) {
+	now := time.Now()
+	limiters := rateLimiters{idleTimeout: time.Minute, now: func() time.Time { return now }}
+	busy := limiters.get("mock|busy", RateLimitConfig{MaxInFlight: 1})
+	idle := limiters.get("mock|idle", RateLimitConfig{MaxInFlight: 1})
+	if err := busy.inFlight.acquire(context.Background()); err != nil {
+		t.Fatalf("acquire failed: %v", err)
+	}
+
+	now = now.Add(2 * time.Minute)
+	limiters.get("mock|other", RateLimitConfig{})
+
+	if limiters.get("mock|busy", RateLimitConfig{MaxInFlight: 1}) != busy {
+		t.Fatal("expected a limiter with a call in flight to be kept")
+	}
+	if _, ok := limiters.accounts["mock|idle"]; ok || limiters.get("mock|idle", RateLimitConfig{MaxInFlight: 1}) == idle {
+		t.Fatal("expected the idle limiter to be dropped")
+	}
+}
+
+func TestResolveRateLimit(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider string
+		override *RateLimitConfig
+		want     RateLimitConfig
+	}{
+		{name: "provider default", provider: "desec", want: RateLimitConfig{RequestsPerSecond: 1, Burst: 2, MaxInFlight: 1}},
+		{name: "unknown provider is unlimited", provider: "unknown", want: RateLimitConfig{}},
+		{
+			name:     "partial override",
+			provider: "cloudflare",
+			override: &RateLimitConfig{RequestsPerSecond: 1},
+			want:     RateLimitConfig{RequestsPerSecond: 1, Burst: 10, MaxInFlight: 4},
+		},
+		{
+			name:     "full override",
+			provider: "hetzner",
+			override: &RateLimitConfig{RequestsPerSecond: 3, Burst: 6, MaxInFlight: 3},
+			want:     RateLimitConfig{RequestsPerSecond: 3, Burst: 6, MaxInFlight: 3},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := resolveRateLimit(tc.provider, tc.override); got != tc.want {
+				t.Fatalf("resolveRateLimit(%q) = %+v, want %+v", tc.provider, got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/libdns/libdns"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/cert-manager-webhook-libdns/providers"
+)
+
+// Defaults for retrying provider API calls
+const (
+	defaultRetryMaxAttempts    = 5
+	defaultRetryInitialBackoff = 1 * time.Second
+	defaultRetryMaxBackoff     = 30 * time.Second
+	defaultRetryBudget         = 90 * time.Second
+)
+
+// RetryConfig controls how failed provider API calls are retried
+type RetryConfig struct {
+	// MaxAttempts is the number of attempts per call including the first (default: 5, 1 disables retries)
+	MaxAttempts int `json:"maxAttempts,omitempty"`
+
+	// InitialBackoff is the wait before the first retry, doubled on every retry (default: 1s)
+	InitialBackoff *metav1.Duration `json:"initialBackoff,omitempty"`
+
+	// MaxBackoff caps the wait between two attempts (default: 30s)
+	MaxBackoff *metav1.Duration `json:"maxBackoff,omitempty"`
+
+	// Budget bounds the total time spent on one call including all waits (default: 90s)
+	Budget *metav1.Duration `json:"budget,omitempty"`
+}
+
+// retryPolicy is a RetryConfig with defaults applied
+type retryPolicy struct {
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	budget         time.Duration
+}
+
+// validate rejects a negative attempt count and non-positive durations
+func (c *RetryConfig) validate(errs *configErrors) {
+	if c == nil {
+		return
+	}
+	if c.MaxAttempts < 0 {
+		errs.addf("retry.maxAttempts must not be negative, got %d", c.MaxAttempts)
+	}
+	validateDuration(errs, "retry.initialBackoff", c.InitialBackoff)
+	validateDuration(errs, "retry.maxBackoff", c.MaxBackoff)
+	validateDuration(errs, "retry.budget", c.Budget)
+}
+
+// newRetryPolicy applies defaults to an optional RetryConfig
+func newRetryPolicy(cfg *RetryConfig) retryPolicy {
+	p := retryPolicy{
+		maxAttempts:    defaultRetryMaxAttempts,
+		initialBackoff: defaultRetryInitialBackoff,
+		maxBackoff:     defaultRetryMaxBackoff,
+		budget:         defaultRetryBudget,
+	}
+	if cfg == nil {
+		return p
+	}
+	if cfg.MaxAttempts > 0 {
+		p.maxAttempts = cfg.MaxAttempts
+	}
+	if cfg.InitialBackoff != nil && cfg.InitialBackoff.Duration > 0 {
+		p.initialBackoff = cfg.InitialBackoff.Duration
+	}
+	if cfg.MaxBackoff != nil && cfg.MaxBackoff.Duration > 0 {
+		p.maxBackoff = cfg.MaxBackoff.Duration
+	}
+	if cfg.Budget != nil && cfg.Budget.Duration > 0 {
+		p.budget = cfg.Budget.Duration
+	}
+	return p
+}
+
+// backoff returns the jittered wait before retry number attempt (starting at 1)
+func (p retryPolicy) backoff(attempt int) time.Duration {
+	d := p.initialBackoff
+	for i := 1; i < attempt && d < p.maxBackoff; i++ {
+		d *= 2
+	}
+	d = min(d, p.maxBackoff)
+	// Equal jitter: wait between half and the full backoff
+	return d/2 + rand.N(d/2+1)
+}
+
+// retryingProvider retries the calls of a DNSProvider according to a retryPolicy
+type retryingProvider struct {
+	inner  providers.DNSProvider
+	name   string
+	policy retryPolicy
+}
+
+// newRetryingProvider wraps provider so that retryable errors are retried
+func newRetryingProvider(provider providers.DNSProvider, name string, policy retryPolicy) *retryingProvider {
+	return &retryingProvider{inner: provider, name: name, policy: policy}
+}
+
+func (r *retryingProvider) unwrap() providers.DNSProvider { return r.inner }
+
+// AppendRecords is not idempotent: an attempt that failed after reaching the
+// provider must not be repeated blindly. Unless the error proves the records
+// were not added, they are read back before the next attempt, and providers
+// that cannot be read are not retried at all.
+func (r *retryingProvider) AppendRecords(ctx context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	uncertain := false
+	return withRetry(ctx, r, "AppendRecords", func(ctx context.Context) ([]libdns.Record, error) {
+		if uncertain {
+			applied, err := r.appended(ctx, zone, recs)
+			if err != nil {
+				return nil, fmt.Errorf("checking whether the previous attempt added the records: %w", err)
+			}
+			if applied {
+				klog.V(2).Infof("%s AppendRecords: the previous attempt added the records despite its error", r.name)
+				return recs, nil
+			}
+		}
+
+		added, err := providers.AppendRecords(ctx, r.inner, zone, recs)
+		if err == nil || notApplied(err) {
+			return added, err
+		}
+		if !providers.CapabilitiesOf(unwrapProvider(r.inner)).Get {
+			return added, noRetryError{err}
+		}
+		uncertain = true
+		return added, err
+	})
+}
+
+// appended reports whether every record of recs is in zone
+func (r *retryingProvider) appended(ctx context.Context, zone string, recs []libdns.Record) (bool, error) {
+	for _, rec := range recs {
+		want := rec.RR()
+		existing, err := providers.GetRecordsByName(ctx, r.inner, zone, want.Name, want.Type)
+		if err != nil {
+			return false, err
+		}
+		found := slices.ContainsFunc(existing, func(e libdns.Record) bool {
+			if want.Type == "TXT" {
+				return existingTXT(e, 0).Text == existingTXT(rec, 0).Text
+			}
+			return e.RR().Data == want.Data
+		})
+		if !found {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (r *retryingProvider) DeleteRecords(ctx context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	return withRetry(ctx, r, "DeleteRecords", func(ctx context.Context) ([]libdns.Record, error) {
+		return providers.DeleteRecords(ctx, r.inner, zone, recs)
+	})
+}
+
+func (r *retryingProvider) GetRecords(ctx context.Context, zone string) ([]libdns.Record, error) {
+	return withRetry(ctx, r, "GetRecords", func(ctx context.Context) ([]libdns.Record, error) {
+		return providers.GetRecords(ctx, r.inner, zone)
+	})
+}
+
+func (r *retryingProvider) GetRecordsByName(ctx context.Context, zone, name, recordType string) ([]libdns.Record, error) {
+	return withRetry(ctx, r, "GetRecordsByName", func(ctx context.Context) ([]libdns.Record, error) {
+		return providers.GetRecordsByName(ctx, r.inner, zone, name, recordType)
+	})
+}
+
+func (r *retryingProvider) ListZones(ctx context.Context) ([]libdns.Zone, error) {
+	return withRetry(ctx, r, "ListZones", func(ctx context.Context) ([]libdns.Zone, error) {
+		return providers.ListZones(ctx, r.inner)
+	})
+}
+
+func (r *retryingProvider) SetRecords(ctx context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	return withRetry(ctx, r, "SetRecords", func(ctx context.Context) ([]libdns.Record, error) {
+		return providers.SetRecords(ctx, r.inner, zone, recs)
+	})
+}
+
+// withRetry runs call until it succeeds, fails permanently, or the policy is exhausted
+func withRetry[T any](ctx context.Context, r *retryingProvider, op string, call func(context.Context) (T, error)) (T, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.policy.budget)
+	defer cancel()
+
+	for attempt := 1; ; attempt++ {
+		result, err := call(ctx)
+		if err == nil {
+			return result, nil
+		}
+
+		retryable, retryAfter := classifyError(err)
+		if !retryable {
+			return result, err
+		}
+		if attempt >= r.policy.maxAttempts {
+			return result, fmt.Errorf("%s %s: giving up after %d attempts: %w", r.name, op, attempt, err)
+		}
+
+		wait := r.policy.backoff(attempt)
+		if retryAfter > wait {
+			wait = retryAfter
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			return result, fmt.Errorf("%s %s: retry budget exhausted after %d attempts: %w", r.name, op, attempt, err)
+		}
+
+		klog.Warningf("%s %s failed (attempt %d/%d), retrying in %s: %v", r.name, op, attempt, r.policy.maxAttempts, wait.Round(time.Millisecond), err)
+		select {
+		case <-ctx.Done():
+			return result, fmt.Errorf("%s %s: %w (last error: %v)", r.name, op, ctx.Err(), err)
+		case <-time.After(wait):
+		}
+	}
+}
+
+var (
+	// statusCodePattern finds HTTP status codes in provider error messages,
+	// e.g. "HTTP 502", "status code: 429", "status=503" or "(403) Forbidden"
+	statusCodePattern = regexp.MustCompile(`(?i)(?:\bhttp(?:\s+status)?|\bstatus(?:\s*code)?)\s*[:=]?\s*\(?([1-5]\d\d)\b|\(?\b([45]\d\d)\)?\s+(?:bad gateway|service unavailable|gateway time-?out|too many requests|internal server error|unauthorized|forbidden|not found)`)
+
+	// retryAfterPattern finds a Retry-After hint in provider error messages
+	retryAfterPattern = regexp.MustCompile(`(?i)retry[- ]after[:=\s]+(\d+(?:\.\d+)?)\s*(ms|s|m)?`)
+
+	// permanentErrorPatterns mark errors that cannot succeed on retry
+	permanentErrorPatterns = []string{
+		"zone not found",
+		"no such zone",
+		"unknown zone",
+		"hosted zone not found",
+		"unauthorized",
+		"forbidden",
+		"authentication failed",
+		"invalid token",
+		"access denied",
+	}
+)
+
+// noRetryError marks an error that must not be retried although it looks
+// transient
+type noRetryError struct{ error }
+
+func (e noRetryError) Unwrap() error { return e.error }
+
+// notApplied reports whether err proves that the provider rejected a call
+// before acting on it, so even a non-idempotent call can be repeated
+func notApplied(err error) bool {
+	if statusCode(err) == 429 || errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "too many requests") || strings.Contains(msg, "connection refused")
+}
+
+// classifyError reports whether a provider error is worth retrying, and how
+// long the provider asked us to wait before doing so
+func classifyError(err error) (retryable bool, retryAfter time.Duration) {
+	var noRetry noRetryError
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, providers.ErrUnsupported) || errors.As(err, &noRetry) {
+		return false, 0
+	}
+
+	var ra interface{ RetryAfter() time.Duration }
+	if errors.As(err, &ra) {
+		retryAfter = ra.RetryAfter()
+	} else {
+		retryAfter = parseRetryAfter(err.Error())
+	}
+
+	if code := statusCode(err); code != 0 {
+		switch {
+		case code == 429:
+			return true, retryAfter
+		case code >= 500:
+			return true, retryAfter
+		default:
+			return false, 0
+		}
+	}
+
+	msg := strings.ToLower(err.Error())
+	for _, pattern := range permanentErrorPatterns {
+		if strings.Contains(msg, pattern) {
+			return false, 0
+		}
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true, retryAfter
+	}
+	if errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) {
+		return true, retryAfter
+	}
+	if strings.Contains(msg, "timeout") || strings.Contains(msg, "connection reset") || strings.Contains(msg, "too many requests") {
+		return true, retryAfter
+	}
+
+	return false, 0
+}
+
+// statusCode extracts an HTTP status code from err, or 0 if there is none
+func statusCode(err error) int {
+	var sc interface{ StatusCode() int }
+	if errors.As(err, &sc) {
+		return sc.StatusCode()
+	}
+	m := statusCodePattern.FindStringSubmatch(err.Error())
+	if m == nil {
+		return 0
+	}
+	code := m[1]
+	if code == "" {
+		code = m[2]
+	}
+	n, _ := strconv.Atoi(code)
+	return n
+}
+
+// parseRetryAfter extracts a Retry-After hint (seconds unless a unit is given)
+func parseRetryAfter(msg string) time.Duration {
+	m := retryAfterPattern.FindStringSubmatch(msg)
+	if m == nil {
+		return 0
+	}
+	value, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0
+	}
+	unit := time.Second
+	switch strings.ToLower(m[2]) {
+	case "ms":
+		unit = time.Millisecond
+	case "m":
+		unit = time.Minute
+	}
+	return time.Duration(value * float64(unit))
+}
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cert-manager-webhook-libdns/providers"
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"github.com/libdns/libdns"
+	extapi "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// flakyProvider fails calls with queued errors before delegating to a mockProvider
+type flakyProvider struct {
+	*mockProvider
+
+	mu       sync.Mutex
+	failures map[string][]error
+	calls    map[string]int
+}
+
+func newFlakyProvider(mp *mockProvider, failures map[string][]error) *flakyProvider {
+	return &flakyProvider{mockProvider: mp, failures: failures, calls: make(map[string]int)}
+}
+
+func (f *flakyProvider) nextError(op string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls[op]++
+	if queue := f.failures[op]; len(queue) > 0 {
+		f.failures[op] = queue[1:]
+		return queue[0]
+	}
+	return nil
+}
+
+func (f *flakyProvider) callCount(op string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[op]
+}
+
+func (f *flakyProvider) GetRecords(ctx context.Context, zone string) ([]libdns.Record, error) {
+	if err := f.nextError("GetRecords"); err != nil {
+		return nil, err
+	}
+	return f.mockProvider.GetRecords(ctx, zone)
+}
+
+func (f *flakyProvider) SetRecords(ctx context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	if err := f.nextError("SetRecords"); err != nil {
+		return nil, err
+	}
+	return f.mockProvider.SetRecords(ctx, zone, recs)
+}
+
+func (f *flakyProvider) DeleteRecords(ctx context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	if err := f.nextError("DeleteRecords"); err != nil {
+		return nil, err
+	}
+	return f.mockProvider.DeleteRecords(ctx, zone, recs)
+}
+
+// statusError carries an HTTP status the way typed provider errors do
+type statusError struct {
+	code       int
+	retryAfter time.Duration
+}
+
+func (e *statusError) Error() string             { return fmt.Sprintf("api error %d", e.code) }
+func (e *statusError) StatusCode() int           { return e.code }
+func (e *statusError) RetryAfter() time.Duration { return e.retryAfter }
+
+func retryConfigJSON(t *testing.T, providerName string, retry *RetryConfig) *extapi.JSON {
+	t.Helper()
+	raw, err := json.Marshal(LibdnsConfig{
+		Provider:  providerName,
+		SecretRef: SecretReference{Name: "dns-creds"},
+		TTL:       300,
+		Retry:     retry,
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal config: %v", err)
+	}
+	return &extapi.JSON{Raw: raw}
+}
+
+func fastRetry(maxAttempts int) *RetryConfig {
+	return &RetryConfig{
+		MaxAttempts:    maxAttempts,
+		InitialBackoff: &metav1.Duration{Duration: time.Millisecond},
+		MaxBackoff:     &metav1.Duration{Duration: 5 * time.Millisecond},
+		Budget:         &metav1.Duration{Duration: 5 * time.Second},
+	}
+}
+
+func TestClassifyError(t *testing.T) {
+	tests := []struct {
+		name          string
+		err           error
+		wantRetryable bool
+		wantAfter     time.Duration
+	}{
+		{name: "typed 502", err: &statusError{code: 502}, wantRetryable: true},
+		{name: "typed 429 with retry-after", err: &statusError{code: 429, retryAfter: 3 * time.Second}, wantRetryable: true, wantAfter: 3 * time.Second},
+		{name: "typed 401", err: &statusError{code: 401}},
+		{name: "typed 403", err: &statusError{code: 403}},
+		{name: "wrapped typed 503", err: fmt.Errorf("set records: %w", &statusError{code: 503}), wantRetryable: true},
+		{name: "message HTTP 502", err: errors.New("got error status: HTTP 502: Bad Gateway"), wantRetryable: true},
+		{name: "message status code 429 with retry-after", err: errors.New("status code: 429, Retry-After: 7"), wantRetryable: true, wantAfter: 7 * time.Second},
+		{name: "message 403 Forbidden", err: errors.New("request failed (403) Forbidden"), wantRetryable: false},
+		{name: "message 504 gateway timeout", err: errors.New("504 Gateway Timeout"), wantRetryable: true},
+		{name: "zone not found", err: errors.New("zone not found: example.com")},
+		{name: "invalid token", err: errors.New("invalid token")},
+		{name: "deadline exceeded", err: fmt.Errorf("request: %w", context.DeadlineExceeded), wantRetryable: true},
+		{name: "connection reset", err: errors.New("read tcp: connection reset by peer"), wantRetryable: true},
+		{name: "context canceled", err: context.Canceled},
+		{name: "unknown error", err: errors.New("record has invalid content")},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			retryable, after := classifyError(tc.err)
+			if retryable != tc.wantRetryable {
+				t.Fatalf("classifyError(%v) retryable = %v, want %v", tc.err, retryable, tc.wantRetryable)
+			}
+			if after != tc.wantAfter {
+				t.Fatalf("classifyError(%v) retryAfter = %s, want %s", tc.err, after, tc.wantAfter)
+			}
+		})
+	}
+}
+
+func TestPresentRetriesTransientProviderErrors(t *testing.T) {
+	fp := newFlakyProvider(&mockProvider{}, map[string][]error{
+		"GetRecords": {errors.New("HTTP 502 Bad Gateway")},
+		"SetRecords": {&statusError{code: 503}, &statusError{code: 429}},
+	})
+	providerName := "mock"
+	registry := providers.NewRegistry()
+	registerProvider(t, registry, providerName, fp)
+
+	solver := newTestSolver(registry, "cert-manager", "dns-creds")
+	ch := &v1alpha1.ChallengeRequest{
+		ResolvedFQDN:      "_acme-challenge.example.com.",
+		ResolvedZone:      "example.com.",
+		Key:               "new-value",
+		ResourceNamespace: "cert-manager",
+		Config:            retryConfigJSON(t, providerName, fastRetry(5)),
+	}
+
+	if err := solver.Present(ch); err != nil {
+		t.Fatalf("Present failed: %v", err)
+	}
+	if got := fp.callCount("GetRecords"); got != 2 {
+		t.Fatalf("expected GetRecords to be retried once, got %d calls", got)
+	}
+	if got := fp.callCount("SetRecords"); got != 3 {
+		t.Fatalf("expected SetRecords to be retried twice, got %d calls", got)
+	}
+	if fp.appendCalls != 0 {
+		t.Fatalf("expected no append fallback after a successful retry, got %d calls", fp.appendCalls)
+	}
+	if values := txtValuesForName(fp.records, "_acme-challenge"); len(values) != 1 || values[0] != "new-value" {
+		t.Fatalf("expected TXT value [new-value], got %v", values)
+	}
+}
+
+func TestPresentDoesNotRetryPermanentErrors(t *testing.T) {
+	fp := newFlakyProvider(&mockProvider{}, map[string][]error{
+		"SetRecords": {&statusError{code: 401}},
+	})
+	providerName := "mock"
+	registry := providers.NewRegistry()
+	registerProvider(t, registry, providerName, fp)
+
+	solver := newTestSolver(registry, "cert-manager", "dns-creds")
+	ch := &v1alpha1.ChallengeRequest{
+		ResolvedFQDN:      "_acme-challenge.example.com.",
+		ResolvedZone:      "example.com.",
+		Key:               "new-value",
+		ResourceNamespace: "cert-manager",
+		Config:            retryConfigJSON(t, providerName, fastRetry(5)),
+	}
+
+	if err := solver.Present(ch); err == nil {
+		t.Fatal("expected Present to fail on a permanent error")
+	}
+	if got := fp.callCount("SetRecords"); got != 1 {
+		t.Fatalf("expected a single SetRecords call for a permanent error, got %d", got)
+	}
+}
+
+func TestCleanUpGivesUpAfterMaxAttempts(t *testing.T) {
+	fp := newFlakyProvider(&mockProvider{
+		records: []libdns.Record{libdns.TXT{Name: "_acme-challenge", Text: "remove"}},
+	}, map[string][]error{
+		"DeleteRecords": {&statusError{code: 500}, &statusError{code: 500}, &statusError{code: 500}, &statusError{code: 500}},
+	})
+	providerName := "mock"
+	registry := providers.NewRegistry()
+	registerProvider(t, registry, providerName, fp)
+
+	solver := newTestSolver(registry, "cert-manager", "dns-creds")
+	ch := &v1alpha1.ChallengeRequest{
+		ResolvedFQDN:      "_acme-challenge.example.com.",
+		ResolvedZone:      "example.com.",
+		Key:               "remove",
+		ResourceNamespace: "cert-manager",
+		Config:            retryConfigJSON(t, providerName, fastRetry(3)),
+	}
+
+	err := solver.CleanUp(ch)
+	if err == nil || !strings.Contains(err.Error(), "giving up after 3 attempts") {
+		t.Fatalf("expected CleanUp to give up after 3 attempts, got %v", err)
+	}
+	if got := fp.callCount("DeleteRecords"); got != 3 {
+		t.Fatalf("expected 3 DeleteRecords calls, got %d", got)
+	}
+}
+
+func TestRetryHonorsRetryAfterWithinBudget(t *testing.T) {
+	fp := newFlakyProvider(&mockProvider{}, map[string][]error{
+		"GetRecords": {&statusError{code: 429, retryAfter: 50 * time.Millisecond}},
+	})
+	rp := newRetryingProvider(fp, "flaky", newRetryPolicy(fastRetry(3)))
+
+	start := time.Now()
+	if _, err := rp.GetRecords(context.Background(), "example.com"); err != nil {
+		t.Fatalf("GetRecords failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Fatalf("expected Retry-After to delay the retry by 50ms, waited %s", elapsed)
+	}
+
+	// A Retry-After beyond the remaining budget fails fast instead of waiting.
+	fp = newFlakyProvider(&mockProvider{}, map[string][]error{
+		"GetRecords": {&statusError{code: 429, retryAfter: time.Hour}},
+	})
+	rp = newRetryingProvider(fp, "flaky", newRetryPolicy(fastRetry(3)))
+	_, err := rp.GetRecords(context.Background(), "example.com")
+	if err == nil || !strings.Contains(err.Error(), "retry budget exhausted") {
+		t.Fatalf("expected budget exhaustion error, got %v", err)
+	}
+}
+
+func TestRetryPolicyBackoffIsCappedAndJittered(t *testing.T) {
+	p := newRetryPolicy(&RetryConfig{
+		InitialBackoff: &metav1.Duration{Duration: 100 * time.Millisecond},
+		MaxBackoff:     &metav1.Duration{Duration: 400 * time.Millisecond},
+	})
+
+	for attempt, want := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 3: 400 * time.Millisecond, 10: 400 * time.Millisecond} {
+		for range 20 {
+			got := p.backoff(attempt)
+			if got < want/2 || got > want {
+				t.Fatalf("backoff(%d) = %s, want within [%s, %s]", attempt, got, want/2, want)
+			}
+		}
+	}
+}
+
+// lostResponseProvider adds the records but reports err, like an append
+// whose response was lost after the provider applied it
+type lostResponseProvider struct {
+	*mockProvider
+	err error
+}
+
+func (p *lostResponseProvider) AppendRecords(ctx context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	added, _ := p.mockProvider.AppendRecords(ctx, zone, recs)
+	if p.err != nil {
+		err := p.err
+		p.err = nil
+		return nil, err
+	}
+	return added, nil
+}
+
+func TestRetryDoesNotRepeatAppliedAppend(t *testing.T) {
+	mp := &mockProvider{}
+	provider := newRetryingProvider(&lostResponseProvider{mockProvider: mp, err: errors.New("request timeout")}, "test", newRetryPolicy(fastRetry(3)))
+	recs := []libdns.Record{libdns.TXT{Name: "_acme-challenge", Text: "token", TTL: time.Minute}}
+
+	if _, err := provider.AppendRecords(context.Background(), "example.com", recs); err != nil {
+		t.Fatalf("AppendRecords failed: %v", err)
+	}
+	if mp.appendCalls != 1 {
+		t.Fatalf("expected the applied append not to be repeated, got %d calls", mp.appendCalls)
+	}
+	if values := txtValuesForName(mp.records, "_acme-challenge"); len(values) != 1 {
+		t.Fatalf("expected one TXT value, got %v", values)
+	}
+}
+
+// failingAppender fails its first append with err without applying it, and
+// has no other record operations
+type failingAppender struct {
+	mp  *mockProvider
+	err error
+}
+
+func (p *failingAppender) AppendRecords(ctx context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	if p.err != nil {
+		err := p.err
+		p.err = nil
+		return nil, err
+	}
+	return p.mp.AppendRecords(ctx, zone, recs)
+}
+
+func TestRetryRepeatsAppendRejectedByRateLimit(t *testing.T) {
+	mp := &mockProvider{}
+	provider := newRetryingProvider(&failingAppender{mp: mp, err: &statusError{code: 429}}, "test", newRetryPolicy(fastRetry(3)))
+
+	if _, err := provider.AppendRecords(context.Background(), "example.com", []libdns.Record{libdns.TXT{Name: "_acme-challenge", Text: "token"}}); err != nil {
+		t.Fatalf("AppendRecords failed: %v", err)
+	}
+	if mp.appendCalls != 1 {
+		t.Fatalf("expected the rejected append to be repeated once, got %d appends", mp.appendCalls)
+	}
+}
+
+func TestRetryDoesNotRepeatUncertainAppendWithoutGet(t *testing.T) {
+	mp := &mockProvider{}
+	provider := newRetryingProvider(&failingAppender{mp: mp, err: errors.New("request timeout")}, "test", newRetryPolicy(fastRetry(3)))
+
+	_, err := provider.AppendRecords(context.Background(), "example.com", []libdns.Record{libdns.TXT{Name: "_acme-challenge", Text: "token"}})
+	if err == nil || !strings.Contains(err.Error(), "request timeout") {
+		t.Fatalf("expected the timeout to be returned, got %v", err)
+	}
+	if mp.appendCalls != 0 {
+		t.Fatalf("expected the append not to be repeated, got %d appends", mp.appendCalls)
+	}
+}
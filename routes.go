@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RouteConfig sends challenges below a domain to their own provider account
+type RouteConfig struct {
+	// Domain is the suffix of the challenge FQDN this route applies to, e.g. "example.org"
+	Domain string `json:"domain"`
+
+	// Provider is the name of the DNS provider for this domain
+	Provider string `json:"provider"`
+
+	// SecretRef references the Secret with this provider's credentials
+	SecretRef SecretReference `json:"secretRef"`
+
+	// SecretRefs are further Secrets whose credentials are added to those of SecretRef
+	SecretRefs []SecretReference `json:"secretRefs,omitempty"`
+
+	// Options are non-secret settings for this provider, replacing the top-level ones
+	Options map[string]string `json:"options,omitempty"`
+
+	// ConfigMapRef references a ConfigMap with settings for this provider
+	ConfigMapRef *ConfigMapReference `json:"configMapRef,omitempty"`
+
+	// Zone optionally overrides the zone determined by cert-manager
+	Zone string `json:"zone,omitempty"`
+
+	// TTL is the DNS record TTL in seconds (default: the top-level ttl)
+	TTL int `json:"ttl,omitempty"`
+
+	// Fallbacks are secondary accounts for this domain, replacing the top-level ones
+	Fallbacks []BackendConfig `json:"fallbacks,omitempty"`
+
+	// Mirrors are further providers for this domain, replacing the top-level ones
+	Mirrors []BackendConfig `json:"mirrors,omitempty"`
+}
+
+// validateRoutes checks that every route names a valid domain, a provider
+// and a Secret
+func validateRoutes(errs *configErrors, routes []RouteConfig, mirrorQuorum int) {
+	for i, r := range routes {
+		prefix := fmt.Sprintf("routes[%d].", i)
+		if normalizeDomain(r.Domain) == "" {
+			errs.addf("%sdomain is required", prefix)
+		} else if msg := checkDomainName(strings.TrimPrefix(strings.TrimSpace(r.Domain), "*.")); msg != "" {
+			errs.addf("%sdomain %q is not a valid domain name: %s", prefix, r.Domain, msg)
+		}
+		if r.Provider == "" {
+			errs.addf("%sprovider is required", prefix)
+		}
+		if r.SecretRef.Name == "" {
+			errs.addf("%ssecretRef.name is required", prefix)
+		}
+		validateSecretRefs(errs, prefix, r.SecretRef, r.SecretRefs)
+		validateSettings(errs, prefix, r.Options, r.ConfigMapRef)
+		validateZone(errs, prefix, r.Zone)
+		validateTTL(errs, prefix, r.TTL)
+		validateBackends(errs, prefix+"fallbacks", r.Fallbacks)
+		validateMirrors(errs, prefix, r.Mirrors, r.Fallbacks, mirrorQuorum)
+	}
+}
+
+// matchRoute returns the route with the longest domain suffix matching fqdn, or nil
+func matchRoute(routes []RouteConfig, fqdn string) *RouteConfig {
+	fqdn = normalizeDomain(fqdn)
+
+	var best *RouteConfig
+	bestLen := -1
+	for i := range routes {
+		domain := normalizeDomain(routes[i].Domain)
+		if fqdn != domain && !strings.HasSuffix(fqdn, "."+domain) {
+			continue
+		}
+		if len(domain) > bestLen {
+			best, bestLen = &routes[i], len(domain)
+		}
+	}
+	return best
+}
+
+// normalizeDomain lowercases a domain and strips wildcard labels and dots
+func normalizeDomain(domain string) string {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	domain = strings.TrimPrefix(domain, "*.")
+	return strings.Trim(domain, ".")
+}
+
+// forFQDN returns the configuration that applies to fqdn: the top level with
+// provider, secretRef, zone and TTL taken from the longest matching route
+func (cfg *LibdnsConfig) forFQDN(fqdn string) (*LibdnsConfig, error) {
+	route := matchRoute(cfg.Routes, fqdn)
+	if route == nil {
+		if cfg.Provider == "" {
+			return nil, fmt.Errorf("no route matches %s and no top-level provider is configured", fqdn)
+		}
+		return cfg, nil
+	}
+
+	effective := *cfg
+	effective.Routes = nil
+	effective.Provider = route.Provider
+	effective.SecretRef = route.SecretRef
+	effective.SecretRefs = route.SecretRefs
+	effective.Options = route.Options
+	effective.ConfigMapRef = route.ConfigMapRef
+	effective.Zone = route.Zone
+	effective.Fallbacks = route.Fallbacks
+	effective.Mirrors = route.Mirrors
+	if route.TTL > 0 {
+		effective.TTL = route.TTL
+	}
+	return &effective, nil
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/cert-manager-webhook-libdns/providers"
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	extapi "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func routesConfigJSON(t *testing.T, cfg LibdnsConfig) *extapi.JSON {
+	t.Helper()
+	raw, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatalf("failed to marshal config: %v", err)
+	}
+	return &extapi.JSON{Raw: raw}
+}
+
+func TestMatchRoutePicksLongestSuffix(t *testing.T) {
+	routes := []RouteConfig{
+		{Domain: "example.com", Provider: "cloudflare"},
+		{Domain: "eu.example.com.", Provider: "desec"},
+		{Domain: "*.Example.ORG", Provider: "route53"},
+	}
+
+	tests := []struct {
+		fqdn string
+		want string
+	}{
+		{fqdn: "_acme-challenge.example.com.", want: "cloudflare"},
+		{fqdn: "_acme-challenge.www.eu.example.com.", want: "desec"},
+		{fqdn: "_acme-challenge.eu.example.com", want: "desec"},
+		{fqdn: "_acme-challenge.example.org.", want: "route53"},
+		{fqdn: "_acme-challenge.notexample.com.", want: ""},
+		{fqdn: "_acme-challenge.example.net.", want: ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.fqdn, func(t *testing.T) {
+			got := ""
+			if route := matchRoute(routes, tc.fqdn); route != nil {
+				got = route.Provider
+			}
+			if got != tc.want {
+				t.Fatalf("matchRoute(%q) = %q, want %q", tc.fqdn, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestLoadConfigValidatesRoutes(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     LibdnsConfig
+		wantErr string
+	}{
+		{
+			name: "routes without top-level provider",
+			cfg:  LibdnsConfig{Routes: []RouteConfig{{Domain: "example.com", Provider: "desec", SecretRef: SecretReference{Name: "desec"}}}},
+		},
+		{
+			name:    "neither provider nor routes",
+			cfg:     LibdnsConfig{},
+			wantErr: "provider is required",
+		},
+		{
+			name:    "route without domain",
+			cfg:     LibdnsConfig{Routes: []RouteConfig{{Provider: "desec", SecretRef: SecretReference{Name: "desec"}}}},
+			wantErr: "routes[0].domain is required",
+		},
+		{
+			name: "route without secret",
+			cfg: LibdnsConfig{Routes: []RouteConfig{
+				{Domain: "example.com", Provider: "desec", SecretRef: SecretReference{Name: "desec"}},
+				{Domain: "example.org", Provider: "cloudflare"},
+			}},
+			wantErr: "routes[1].secretRef.name is required",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := loadConfig(routesConfigJSON(t, tc.cfg))
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("loadConfig failed: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestPresentRoutesChallengesByDomain(t *testing.T) {
+	defaultMock, orgMock, euMock := &mockProvider{}, &mockProvider{}, &mockProvider{}
+	defaultName := "default"
+	orgName := "org"
+	euName := "eu"
+	registry := providers.NewRegistry()
+	registerMockProvider(t, registry, defaultName, defaultMock)
+	registerMockProvider(t, registry, orgName, orgMock)
+	registerMockProvider(t, registry, euName, euMock)
+
+	secret := func(name string) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "cert-manager"},
+			Data:       map[string][]byte{"api_token": []byte(name)},
+		}
+	}
+	solver := &libdnsSolver{client: fake.NewSimpleClientset(secret("default-creds"), secret("org-creds"), secret("eu-creds")), registry: registry}
+
+	config := routesConfigJSON(t, LibdnsConfig{
+		Provider:  defaultName,
+		SecretRef: SecretReference{Name: "default-creds"},
+		TTL:       300,
+		Routes: []RouteConfig{
+			{Domain: "example.org", Provider: orgName, SecretRef: SecretReference{Name: "org-creds"}, TTL: 600},
+			{Domain: "eu.example.org", Provider: euName, SecretRef: SecretReference{Name: "eu-creds"}, Zone: "eu.example.org"},
+		},
+	})
+
+	challenges := []struct {
+		fqdn, zone, key string
+	}{
+		{fqdn: "_acme-challenge.example.com.", zone: "example.com.", key: "default-key"},
+		{fqdn: "_acme-challenge.www.example.org.", zone: "example.org.", key: "org-key"},
+		{fqdn: "_acme-challenge.shop.eu.example.org.", zone: "example.org.", key: "eu-key"},
+	}
+	for _, c := range challenges {
+		ch := &v1alpha1.ChallengeRequest{
+			ResolvedFQDN:      c.fqdn,
+			ResolvedZone:      c.zone,
+			Key:               c.key,
+			ResourceNamespace: "cert-manager",
+			Config:            config,
+		}
+		if err := solver.Present(ch); err != nil {
+			t.Fatalf("Present(%s) failed: %v", c.fqdn, err)
+		}
+	}
+
+	if values := txtValuesForName(defaultMock.records, "_acme-challenge"); len(values) != 1 || values[0] != "default-key" {
+		t.Fatalf("expected the top-level provider to receive [default-key], got %v", values)
+	}
+	if values := txtValuesForName(orgMock.records, "_acme-challenge.www"); len(values) != 1 || values[0] != "org-key" {
+		t.Fatalf("expected the example.org route to receive [org-key], got %v", values)
+	}
+	if got := txtRecordsForName(orgMock.records, "_acme-challenge.www")["org-key"].TTL.Seconds(); got != 600 {
+		t.Fatalf("expected the route TTL of 600s, got %vs", got)
+	}
+	// The eu route overrides the zone, so the record name is relative to it
+	if values := txtValuesForName(euMock.records, "_acme-challenge.shop"); len(values) != 1 || values[0] != "eu-key" {
+		t.Fatalf("expected the eu.example.org route to receive [eu-key], got %v", values)
+	}
+	if euMock.lastZoneSeen != "eu.example.org" {
+		t.Fatalf("expected the eu route zone override, got %q", euMock.lastZoneSeen)
+	}
+	if got := txtRecordsForName(euMock.records, "_acme-challenge.shop")["eu-key"].TTL.Seconds(); got != 300 {
+		t.Fatalf("expected the top-level TTL of 300s when the route sets none, got %vs", got)
+	}
+}
+
+func TestGetProviderFailsWithoutMatchingRoute(t *testing.T) {
+	solver := newTestSolver(providers.NewRegistry(), "cert-manager", "dns-creds")
+	ch := &v1alpha1.ChallengeRequest{
+		ResolvedFQDN:      "_acme-challenge.example.net.",
+		ResolvedZone:      "example.net.",
+		Key:               "value",
+		ResourceNamespace: "cert-manager",
+		Config: routesConfigJSON(t, LibdnsConfig{Routes: []RouteConfig{
+			{Domain: "example.com", Provider: "desec", SecretRef: SecretReference{Name: "dns-creds"}},
+		}}),
+	}
+
+	_, err := solver.getProvider(ch)
+	if err == nil || !strings.Contains(err.Error(), "no route matches _acme-challenge.example.net.") {
+		t.Fatalf("expected a no-matching-route error, got %v", err)
+	}
+}
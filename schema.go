@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"reflect"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/cert-manager-webhook-libdns/providers"
+)
+
+// durationPattern matches the Go durations accepted by metav1.Duration, e.g. "90s" or "1m30s"
+const durationPattern = `^([0-9]+(\.[0-9]+)?(ns|us|µs|ms|s|m|h))+$`
+
+// schemaBounds are the numeric limits loadConfig enforces, by JSON field name
+var schemaBounds = map[string]map[string]any{
+	"ttl":               {"minimum": 0, "maximum": maxTTL},
+	"mirrorQuorum":      {"minimum": 0},
+	"maxDepth":          {"minimum": 0},
+	"maxAttempts":       {"minimum": 0},
+	"requestsPerSecond": {"minimum": 0},
+	"burst":             {"minimum": 0},
+	"maxInFlight":       {"minimum": 0},
+	"port":              {"minimum": 0, "maximum": maxPort},
+}
+
+// printConfigSchema writes the JSON Schema of the issuer config to w
+func printConfigSchema(w io.Writer) error {
+	out, err := json.MarshalIndent(configSchema(), "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(out))
+	return err
+}
+
+// configSchema returns a JSON Schema for LibdnsConfig. Like loadConfig it
+// rejects unknown fields; per provider it lists the names that secretRef.keys
+// may map and the settings that options may hold.
+func configSchema() map[string]any {
+	defs := map[string]any{}
+	root := schemaForType(reflect.TypeFor[LibdnsConfig](), defs)
+
+	// Either a top-level provider with its Secret, or routes covering every domain
+	defs["LibdnsConfig"].(map[string]any)["anyOf"] = []any{
+		map[string]any{"required": []string{"provider"}},
+		map[string]any{"required": []string{"routes"}},
+	}
+	defs["LibdnsConfig"].(map[string]any)["dependentRequired"] = map[string]any{
+		"provider": []string{"secretRef"},
+	}
+	defs["ProviderKeys"] = providerKeysSchema()
+
+	return map[string]any{
+		"$schema":     "https://json-schema.org/draft/2020-12/schema",
+		"title":       "cert-manager-webhook-libdns solver config",
+		"description": fmt.Sprintf("Config of the libdns solver in an Issuer or ClusterIssuer (webhook %s)", Version),
+		"$ref":        root["$ref"],
+		"$defs":       defs,
+	}
+}
+
+// schemaForType returns the schema of t, adding structs to defs and
+// referring to them by name
+func schemaForType(t reflect.Type, defs map[string]any) map[string]any {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == reflect.TypeFor[metav1.Duration]() {
+		return map[string]any{"type": "string", "pattern": durationPattern}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice:
+		return map[string]any{"type": "array", "items": schemaForType(t.Elem(), defs)}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": schemaForType(t.Elem(), defs)}
+	case reflect.Struct:
+		ref := map[string]any{"$ref": "#/$defs/" + t.Name()}
+		if _, ok := defs[t.Name()]; ok {
+			return ref
+		}
+		def := map[string]any{"type": "object", "additionalProperties": false}
+		defs[t.Name()] = def
+
+		properties := map[string]any{}
+		var required []string
+		for i := 0; i < t.NumField(); i++ {
+			name, omitempty := jsonFieldName(t.Field(i))
+			if name == "" {
+				continue
+			}
+			prop := schemaForType(t.Field(i).Type, defs)
+			for k, v := range schemaBounds[name] {
+				prop[k] = v
+			}
+			properties[name] = prop
+			if !omitempty {
+				required = append(required, name)
+			}
+		}
+		def["properties"] = properties
+
+		// The top-level Secret is only required with a top-level provider
+		if len(required) > 0 && t != reflect.TypeFor[LibdnsConfig]() {
+			def["required"] = required
+		}
+		if _, ok := properties["provider"]; ok {
+			properties["provider"] = map[string]any{"type": "string", "enum": providers.ListProviders()}
+			def["$ref"] = "#/$defs/ProviderKeys"
+		}
+		return ref
+	}
+	panic(fmt.Sprintf("no JSON Schema for %s", t))
+}
+
+// jsonFieldName returns the JSON name of a struct field and whether it is
+// omitted when empty; the name is empty for fields not encoded
+func jsonFieldName(f reflect.StructField) (string, bool) {
+	if !f.IsExported() {
+		return "", false
+	}
+	tag := f.Tag.Get("json")
+	if tag == "-" {
+		return "", false
+	}
+	name, opts, _ := strings.Cut(tag, ",")
+	if name == "" {
+		name = f.Name
+	}
+	return name, strings.Contains(","+opts+",", ",omitempty,")
+}
+
+// providerKeysSchema returns one conditional section per provider that
+// describes its keys, applied to every object naming a provider
+func providerKeysSchema() map[string]any {
+	var conditions []any
+	for _, name := range providers.ListProviders() {
+		keys, err := providers.Describe(name)
+		if err != nil || len(keys.Keys()) == 0 {
+			continue
+		}
+
+		// Settings may also come from the Secret, so keys may map them too
+		credentials := keyProperties(keys.RequiredCredentials, keys.OptionalCredentials)
+		maps.Copy(credentials, keyProperties(keys.RequiredSettings, keys.OptionalSettings))
+		keysSchema := map[string]any{"properties": credentials}
+		if !keys.Passthrough {
+			keysSchema["propertyNames"] = map[string]any{"enum": keyNames(keys.RequiredCredentials, keys.OptionalCredentials, keys.RequiredSettings, keys.OptionalSettings)}
+		}
+		secretRef := map[string]any{
+			"properties": map[string]any{"keys": keysSchema},
+		}
+
+		options := map[string]any{"maxProperties": 0}
+		if settings := keyNames(keys.RequiredSettings, keys.OptionalSettings); len(settings) > 0 {
+			options = map[string]any{
+				"propertyNames": map[string]any{"enum": settings},
+				"properties":    keyProperties(keys.RequiredSettings, keys.OptionalSettings),
+			}
+		}
+		// Passthrough providers forward keys they do not describe
+		if keys.Passthrough {
+			options = map[string]any{"properties": keyProperties(keys.RequiredSettings, keys.OptionalSettings)}
+		}
+
+		conditions = append(conditions, map[string]any{
+			"if": map[string]any{
+				"properties": map[string]any{"provider": map[string]any{"const": name}},
+				"required":   []string{"provider"},
+			},
+			"then": map[string]any{
+				"description": describeKeys(name, keys),
+				"properties": map[string]any{
+					"secretRef":  secretRef,
+					"secretRefs": map[string]any{"items": secretRef},
+					"options":    options,
+				},
+			},
+		})
+	}
+	if len(conditions) == 0 {
+		return map[string]any{}
+	}
+	return map[string]any{"allOf": conditions}
+}
+
+// keyProperties returns the schema properties of required and optional keys
+func keyProperties(required, optional []providers.Key) map[string]any {
+	properties := map[string]any{}
+	for _, k := range required {
+		properties[k.Name] = map[string]any{"type": "string", "description": k.Description + " (required)"}
+	}
+	for _, k := range optional {
+		properties[k.Name] = map[string]any{"type": "string", "description": k.Description + " (optional)"}
+	}
+	return properties
+}
+
+// keyNames returns the names of keys in order
+func keyNames(lists ...[]providers.Key) []string {
+	names := []string{}
+	for _, keys := range lists {
+		for _, k := range keys {
+			names = append(names, k.Name)
+		}
+	}
+	return names
+}
+
+// describeKeys summarizes the keys a provider reads for the schema description
+func describeKeys(name string, keys providers.Descriptor) string {
+	var desc string
+	switch {
+	case len(keys.RequiredCredentials) > 0:
+		desc = fmt.Sprintf("%s requires the credentials %s", name, strings.Join(keyNames(keys.RequiredCredentials), ", "))
+		if len(keys.OptionalCredentials) > 0 {
+			desc += fmt.Sprintf(" and optionally %s", strings.Join(keyNames(keys.OptionalCredentials), ", "))
+		}
+	case len(keys.OptionalCredentials) > 0:
+		desc = fmt.Sprintf("%s optionally reads the credentials %s", name, strings.Join(keyNames(keys.OptionalCredentials), ", "))
+	default:
+		desc = fmt.Sprintf("%s reads no credentials of its own", name)
+	}
+	if keys.Passthrough {
+		desc += "; other keys are passed through"
+	}
+	if len(keys.RequiredSettings) > 0 {
+		desc += fmt.Sprintf("; it requires the settings %s", strings.Join(keyNames(keys.RequiredSettings), ", "))
+	}
+	if len(keys.OptionalSettings) > 0 {
+		desc += fmt.Sprintf("; optional settings: %s", strings.Join(keyNames(keys.OptionalSettings), ", "))
+	}
+	return desc
+}
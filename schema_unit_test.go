@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/cert-manager-webhook-libdns/providers"
+)
+
+// printedSchema prints the config schema and decodes it again
+func printedSchema(t *testing.T) map[string]any {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := printConfigSchema(&buf); err != nil {
+		t.Fatalf("printConfigSchema failed: %v", err)
+	}
+	var schema map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &schema); err != nil {
+		t.Fatalf("schema is not valid JSON: %v", err)
+	}
+	return schema
+}
+
+// providerCondition returns the then-branch of the schema for provider
+func providerCondition(t *testing.T, schema map[string]any, provider string) map[string]any {
+	t.Helper()
+	defs := schema["$defs"].(map[string]any)
+	for _, c := range defs["ProviderKeys"].(map[string]any)["allOf"].([]any) {
+		cond := c.(map[string]any)
+		ifProps := cond["if"].(map[string]any)["properties"].(map[string]any)
+		if ifProps["provider"].(map[string]any)["const"] == provider {
+			return cond["then"].(map[string]any)
+		}
+	}
+	t.Fatalf("no condition for provider %s", provider)
+	return nil
+}
+
+func TestConfigSchemaCoversConfigFields(t *testing.T) {
+	schema := printedSchema(t)
+	if schema["$ref"] != "#/$defs/LibdnsConfig" {
+		t.Fatalf("expected the schema to refer to LibdnsConfig, got %v", schema["$ref"])
+	}
+
+	defs := schema["$defs"].(map[string]any)
+	for _, typ := range []reflect.Type{
+		reflect.TypeFor[LibdnsConfig](),
+		reflect.TypeFor[RouteConfig](),
+		reflect.TypeFor[BackendConfig](),
+		reflect.TypeFor[SecretReference](),
+		reflect.TypeFor[TimeoutsConfig](),
+	} {
+		def, ok := defs[typ.Name()].(map[string]any)
+		if !ok {
+			t.Fatalf("no definition for %s", typ.Name())
+		}
+		if def["additionalProperties"] != false {
+			t.Errorf("%s should reject unknown fields like loadConfig", typ.Name())
+		}
+		properties := def["properties"].(map[string]any)
+		for i := 0; i < typ.NumField(); i++ {
+			name, _ := jsonFieldName(typ.Field(i))
+			if _, ok := properties[name]; !ok {
+				t.Errorf("%s is missing property %s", typ.Name(), name)
+			}
+		}
+	}
+
+	required := defs["RouteConfig"].(map[string]any)["required"].([]any)
+	if !slices.Equal(required, []any{"domain", "provider", "secretRef"}) {
+		t.Fatalf("expected domain, provider and secretRef to be required in routes, got %v", required)
+	}
+	ttl := defs["LibdnsConfig"].(map[string]any)["properties"].(map[string]any)["ttl"].(map[string]any)
+	if ttl["minimum"] != 0.0 || ttl["maximum"] != float64(maxTTL) {
+		t.Fatalf("expected the TTL bounds of loadConfig, got %v", ttl)
+	}
+	port := defs["PropagationConfig"].(map[string]any)["properties"].(map[string]any)["port"].(map[string]any)
+	if port["minimum"] != 0.0 || port["maximum"] != float64(maxPort) {
+		t.Fatalf("expected the port bounds of loadConfig, got %v", port)
+	}
+}
+
+func TestConfigSchemaDescribesProviderKeys(t *testing.T) {
+	requireProvider(t, "route53", "cloudflare", "ovh")
+	schema := printedSchema(t)
+	for _, name := range []string{"alidns", "cloudflare", "desec", "hetzner", "linode", "ovh", "route53"} {
+		if _, err := providers.Describe(name); err == nil {
+			providerCondition(t, schema, name)
+		}
+	}
+
+	route53 := providerCondition(t, schema, "route53")["properties"].(map[string]any)
+	keys := route53["secretRef"].(map[string]any)["properties"].(map[string]any)["keys"].(map[string]any)
+	names := keys["propertyNames"].(map[string]any)["enum"].([]any)
+	if !slices.Equal(names, []any{"access_key_id", "secret_access_key", "session_token", "region"}) {
+		t.Fatalf("unexpected route53 key names %v", names)
+	}
+	options := route53["options"].(map[string]any)["propertyNames"].(map[string]any)["enum"].([]any)
+	if !slices.Equal(options, []any{"region"}) {
+		t.Fatalf("expected region as the only route53 option, got %v", options)
+	}
+
+	cloudflare := providerCondition(t, schema, "cloudflare")["properties"].(map[string]any)
+	if cloudflare["options"].(map[string]any)["maxProperties"] != 0.0 {
+		t.Fatalf("expected cloudflare to take no options, got %v", cloudflare["options"])
+	}
+
+	ovh := providerCondition(t, schema, "ovh")
+	if want := "ovh requires the credentials application_key, application_secret, consumer_key; it requires the settings endpoint"; ovh["description"] != want {
+		t.Fatalf("expected description %q, got %q", want, ovh["description"])
+	}
+}
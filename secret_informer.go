@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/klog/v2"
+)
+
+// secretInformer serves credential Secrets from shared informer caches so
+// that challenges do not hit the API server for every lookup
+type secretInformer struct {
+	// listers is keyed by namespace; metav1.NamespaceAll watches every namespace
+	listers map[string]corelisters.SecretLister
+}
+
+// defaultSecretNamespace is watched when SECRET_NAMESPACES is unset; it
+// holds the Secrets of ClusterIssuers in a default cert-manager install
+const defaultSecretNamespace = "cert-manager"
+
+// secretInformerOptionsFromEnv reads the informer scope from the environment.
+// Secrets outside the scope are still read, with a GET per challenge.
+//
+// Environment variables:
+//   - SECRET_NAMESPACES: comma-separated namespaces to watch, or "*" for all
+//     namespaces (default: cert-manager)
+//   - SECRET_LABEL_SELECTOR: only cache Secrets matching this label selector
+func secretInformerOptionsFromEnv() (namespaces []string, labelSelector string, err error) {
+	all := false
+	for _, ns := range strings.Split(os.Getenv("SECRET_NAMESPACES"), ",") {
+		switch ns = strings.TrimSpace(ns); ns {
+		case "":
+		case "*":
+			all = true
+		default:
+			namespaces = append(namespaces, ns)
+		}
+	}
+	switch {
+	case all && len(namespaces) > 0:
+		return nil, "", fmt.Errorf("invalid SECRET_NAMESPACES %q: \"*\" cannot be combined with namespaces", os.Getenv("SECRET_NAMESPACES"))
+	case all:
+		namespaces = []string{metav1.NamespaceAll}
+	case len(namespaces) == 0:
+		namespaces = []string{defaultSecretNamespace}
+	}
+
+	labelSelector = strings.TrimSpace(os.Getenv("SECRET_LABEL_SELECTOR"))
+	if _, err := labels.Parse(labelSelector); err != nil {
+		return nil, "", fmt.Errorf("invalid SECRET_LABEL_SELECTOR %q: %w", labelSelector, err)
+	}
+	return namespaces, labelSelector, nil
+}
+
+// secretInformerSyncTimeout bounds the initial sync of the Secret caches.
+// Without list and watch permissions they never sync, and the webhook must
+// still start and read Secrets with a GET per challenge.
+const secretInformerSyncTimeout = 30 * time.Second
+
+// startSecretInformer starts Secret informers for the given namespaces (all
+// namespaces when empty or metav1.NamespaceAll) and waits up to syncTimeout
+// for their caches to sync. If they do not, the informers are stopped.
+// Otherwise they run until stopCh is closed.
+func startSecretInformer(client kubernetes.Interface, namespaces []string, labelSelector string, syncTimeout time.Duration, stopCh <-chan struct{}) (*secretInformer, error) {
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+
+	// informerStop stops the informers with stopCh, or when the sync fails
+	informerStop := make(chan struct{})
+	var stopOnce sync.Once
+	stop := func() { stopOnce.Do(func() { close(informerStop) }) }
+	go func() {
+		select {
+		case <-stopCh:
+			stop()
+		case <-informerStop:
+		}
+	}()
+
+	s := &secretInformer{listers: make(map[string]corelisters.SecretLister, len(namespaces))}
+	var synced []cache.InformerSynced
+	for _, ns := range namespaces {
+		factory := informers.NewSharedInformerFactoryWithOptions(client, 0,
+			informers.WithNamespace(ns),
+			informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+				opts.LabelSelector = labelSelector
+			}),
+		)
+		secrets := factory.Core().V1().Secrets()
+		s.listers[ns] = secrets.Lister()
+		synced = append(synced, secrets.Informer().HasSynced)
+		factory.Start(informerStop)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), syncTimeout)
+	defer cancel()
+	go func() {
+		select {
+		case <-informerStop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	if !cache.WaitForCacheSync(ctx.Done(), synced...) {
+		stop()
+		return nil, fmt.Errorf("secret informer cache did not sync within %s, check that the service account can list and watch Secrets in %q", syncTimeout, namespaces)
+	}
+	return s, nil
+}
+
+// get returns the cached Secret, or false when it is not in any watched cache
+func (s *secretInformer) get(namespace, name string) (*corev1.Secret, bool) {
+	lister, ok := s.listers[namespace]
+	if !ok {
+		lister, ok = s.listers[metav1.NamespaceAll]
+	}
+	if !ok {
+		return nil, false
+	}
+
+	secret, err := lister.Secrets(namespace).Get(name)
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			klog.Warningf("Failed to read secret %s/%s from informer cache: %v", namespace, name, err)
+		}
+		return nil, false
+	}
+	return secret, true
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func countSecretGets(client *fake.Clientset) int {
+	gets := 0
+	for _, action := range client.Actions() {
+		if action.GetVerb() == "get" && action.GetResource().Resource == "secrets" {
+			gets++
+		}
+	}
+	return gets
+}
+
+func newInformerTestSolver(t *testing.T, namespaces []string, labelSelector string) (*libdnsSolver, *fake.Clientset) {
+	t.Helper()
+	client := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "dns-creds",
+			Namespace: "cert-manager",
+			Labels:    map[string]string{"app": "dns"},
+		},
+		Data: map[string][]byte{"api_token": []byte("dummy")},
+	})
+
+	stopCh := make(chan struct{})
+	t.Cleanup(func() { close(stopCh) })
+
+	secrets, err := startSecretInformer(client, namespaces, labelSelector, secretInformerSyncTimeout, stopCh)
+	if err != nil {
+		t.Fatalf("startSecretInformer failed: %v", err)
+	}
+	client.ClearActions()
+	return &libdnsSolver{client: client, secrets: secrets}, client
+}
+
+func TestLoadCredentialsFromSecretInformer(t *testing.T) {
+	tests := []struct {
+		name          string
+		namespaces    []string
+		labelSelector string
+		wantGets      int
+	}{
+		{
+			name:     "all namespaces served from cache",
+			wantGets: 0,
+		},
+		{
+			name:       "watched namespace served from cache",
+			namespaces: []string{"cert-manager"},
+			wantGets:   0,
+		},
+		{
+			name:          "matching label selector served from cache",
+			labelSelector: "app=dns",
+			wantGets:      0,
+		},
+		{
+			name:       "unwatched namespace falls back to GET",
+			namespaces: []string{"other"},
+			wantGets:   1,
+		},
+		{
+			name:          "non-matching label selector falls back to GET",
+			labelSelector: "app=other",
+			wantGets:      1,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			solver, client := newInformerTestSolver(t, tc.namespaces, tc.labelSelector)
+			ch := &v1alpha1.ChallengeRequest{ResourceNamespace: "cert-manager"}
+			cfg := &LibdnsConfig{Provider: "mock", SecretRef: SecretReference{Name: "dns-creds"}}
+
+			credentials, _, err := solver.loadCredentials(ch, cfg)
+			if err != nil {
+				t.Fatalf("loadCredentials failed: %v", err)
+			}
+			if credentials["api_token"] != "dummy" {
+				t.Fatalf("expected api_token to be loaded, got %v", credentials)
+			}
+			if got := countSecretGets(client); got != tc.wantGets {
+				t.Fatalf("expected %d direct secret GETs, got %d", tc.wantGets, got)
+			}
+		})
+	}
+}
+
+func TestLoadCredentialsReportsMissingSecret(t *testing.T) {
+	solver, _ := newInformerTestSolver(t, nil, "")
+	ch := &v1alpha1.ChallengeRequest{ResourceNamespace: "cert-manager"}
+	cfg := &LibdnsConfig{Provider: "mock", SecretRef: SecretReference{Name: "missing"}}
+
+	if _, _, err := solver.loadCredentials(ch, cfg); err == nil {
+		t.Fatal("expected error for missing secret")
+	}
+}
+
+func TestSecretInformerGivesUpWithoutListPermission(t *testing.T) {
+	client := fake.NewSimpleClientset(&corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "dns-creds", Namespace: "cert-manager"},
+		Data:       map[string][]byte{"api_token": []byte("dummy")},
+	})
+	// Like a service account with the old get-only RBAC
+	client.PrependReactor("list", "secrets", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(schema.GroupResource{Resource: "secrets"}, "", errors.New("list is not allowed"))
+	})
+
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	start := time.Now()
+	if _, err := startSecretInformer(client, []string{"cert-manager"}, "", 200*time.Millisecond, stopCh); err == nil || !strings.Contains(err.Error(), "did not sync within 200ms") {
+		t.Fatalf("expected the sync to time out, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("expected the sync to give up after its timeout, took %s", elapsed)
+	}
+
+	// Without the informer, credentials are read with a GET
+	solver := &libdnsSolver{client: client}
+	ch := &v1alpha1.ChallengeRequest{ResourceNamespace: "cert-manager"}
+	cfg := &LibdnsConfig{Provider: "mock", SecretRef: SecretReference{Name: "dns-creds"}}
+	if credentials, _, err := solver.loadCredentials(ch, cfg); err != nil || credentials["api_token"] != "dummy" {
+		t.Fatalf("expected credentials from a GET, got %v, %v", credentials, err)
+	}
+}
+
+func TestSecretInformerOptionsFromEnv(t *testing.T) {
+	tests := []struct {
+		name    string
+		env     string
+		want    []string
+		wantErr bool
+	}{
+		{name: "default", env: "", want: []string{"cert-manager"}},
+		{name: "listed", env: "cert-manager, team-a", want: []string{"cert-manager", "team-a"}},
+		{name: "all", env: "*", want: []string{metav1.NamespaceAll}},
+		{name: "all combined", env: "*,team-a", wantErr: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("SECRET_NAMESPACES", tc.env)
+			got, _, err := secretInformerOptionsFromEnv()
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil || !slices.Equal(got, tc.want) {
+				t.Fatalf("expected namespaces %q, got %q (%v)", tc.want, got, err)
+			}
+		})
+	}
+}
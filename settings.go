@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+// ConfigMapReference identifies a Kubernetes ConfigMap
+type ConfigMapReference struct {
+	// Name is the name of the ConfigMap
+	Name string `json:"name"`
+
+	// Namespace is the namespace of the ConfigMap (optional, defaults to challenge namespace)
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// validateSettings checks that a referenced ConfigMap has a valid name and
+// that no option has an empty name
+func validateSettings(errs *configErrors, path string, options map[string]string, configMapRef *ConfigMapReference) {
+	if _, ok := options[""]; ok {
+		errs.addf("%soptions must not contain an empty key", path)
+	}
+	if configMapRef != nil {
+		if configMapRef.Name == "" {
+			errs.addf("%sconfigMapRef.name is required", path)
+		}
+		validateObjectRef(errs, path+"configMapRef", configMapRef.Name, configMapRef.Namespace)
+	}
+}
+
+// loadSettings returns the non-secret provider options: the data of the
+// referenced ConfigMap, overridden by the inline options
+func (s *libdnsSolver) loadSettings(ch *v1alpha1.ChallengeRequest, cfg *LibdnsConfig) (map[string]string, error) {
+	settings := make(map[string]string)
+
+	if ref := cfg.ConfigMapRef; ref != nil {
+		namespace := ref.Namespace
+		if namespace == "" {
+			namespace = ch.ResourceNamespace
+		}
+
+		ctx, cancel := context.WithTimeout(s.baseContext(), newTimeouts(cfg.Timeouts).secretFetch)
+		defer cancel()
+		cm, err := s.client.CoreV1().ConfigMaps(namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get configmap %s/%s: %w", namespace, ref.Name, err)
+		}
+		for key, value := range cm.Data {
+			settings[key] = value
+		}
+	}
+
+	for key, value := range cfg.Options {
+		settings[key] = value
+	}
+	klog.V(3).Infof("Loaded %d provider setting(s)", len(settings))
+	return settings, nil
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"maps"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/cert-manager-webhook-libdns/providers"
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// registerConfigRecorder registers a provider that records the
+// ProviderConfig of every provider it creates
+func registerConfigRecorder(t *testing.T, registry *providers.Registry, name string) func() []providers.ProviderConfig {
+	t.Helper()
+	var mu sync.Mutex
+	var created []providers.ProviderConfig
+	providers.RegisterWith(registry, name, func(config providers.ProviderConfig) (*mockProvider, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		created = append(created, config)
+		return &mockProvider{}, nil
+	}, providers.Descriptor{})
+	return func() []providers.ProviderConfig {
+		mu.Lock()
+		defer mu.Unlock()
+		return created
+	}
+}
+
+func settingsTestSolver(registry *providers.Registry) *libdnsSolver {
+	return &libdnsSolver{client: fake.NewSimpleClientset(
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "dns-creds", Namespace: "cert-manager"},
+			Data:       map[string][]byte{"access_key_id": []byte("AKIA"), "region": []byte("us-west-2")},
+		},
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "dns-settings", Namespace: "cert-manager"},
+			Data:       map[string]string{"region": "eu-west-1", "endpoint": "ovh-eu"},
+		},
+	), registry: registry}
+}
+
+func settingsChallenge(t *testing.T, providerName string, options map[string]string, configMapRef *ConfigMapReference) *v1alpha1.ChallengeRequest {
+	t.Helper()
+	return &v1alpha1.ChallengeRequest{
+		ResolvedFQDN:      "_acme-challenge.example.com.",
+		ResolvedZone:      "example.com.",
+		ResourceNamespace: "cert-manager",
+		Config: routesConfigJSON(t, LibdnsConfig{
+			Provider:     providerName,
+			SecretRef:    SecretReference{Name: "dns-creds"},
+			Options:      options,
+			ConfigMapRef: configMapRef,
+		}),
+	}
+}
+
+func TestProviderSettingsPrecedence(t *testing.T) {
+	tests := []struct {
+		name         string
+		options      map[string]string
+		configMapRef *ConfigMapReference
+		wantSettings map[string]string
+		wantRegion   string
+	}{
+		{
+			name:         "secret only",
+			wantSettings: map[string]string{},
+			wantRegion:   "us-west-2",
+		},
+		{
+			name:         "configmap overrides secret",
+			configMapRef: &ConfigMapReference{Name: "dns-settings"},
+			wantSettings: map[string]string{"region": "eu-west-1", "endpoint": "ovh-eu"},
+			wantRegion:   "eu-west-1",
+		},
+		{
+			name:         "options override configmap",
+			options:      map[string]string{"region": "ap-south-1"},
+			configMapRef: &ConfigMapReference{Name: "dns-settings", Namespace: "cert-manager"},
+			wantSettings: map[string]string{"region": "ap-south-1", "endpoint": "ovh-eu"},
+			wantRegion:   "ap-south-1",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			providerName := "mock"
+			registry := providers.NewRegistry()
+			created := registerConfigRecorder(t, registry, providerName)
+
+			if _, err := settingsTestSolver(registry).getProvider(settingsChallenge(t, providerName, tc.options, tc.configMapRef)); err != nil {
+				t.Fatalf("getProvider failed: %v", err)
+			}
+			got := created()
+			if len(got) != 1 {
+				t.Fatalf("expected one provider, got %d", len(got))
+			}
+			if !maps.Equal(got[0].Settings, tc.wantSettings) {
+				t.Fatalf("expected settings %v, got %v", tc.wantSettings, got[0].Settings)
+			}
+			if _, ok := got[0].Credentials["endpoint"]; ok {
+				t.Fatalf("expected settings to stay out of the credentials, got %v", got[0].Credentials)
+			}
+			if region := got[0].Setting("region"); region != tc.wantRegion {
+				t.Fatalf("expected region %q, got %q", tc.wantRegion, region)
+			}
+		})
+	}
+}
+
+func TestProviderRebuiltWhenOptionsChange(t *testing.T) {
+	providerName := "mock"
+	registry := providers.NewRegistry()
+	created := registerConfigRecorder(t, registry, providerName)
+	solver := settingsTestSolver(registry)
+
+	for _, region := range []string{"eu-west-1", "eu-west-1", "eu-central-1"} {
+		ch := settingsChallenge(t, providerName, map[string]string{"region": region}, nil)
+		if _, err := solver.getProvider(ch); err != nil {
+			t.Fatalf("getProvider failed: %v", err)
+		}
+	}
+	if got := created(); len(got) != 2 {
+		t.Fatalf("expected a new provider only when the options change, got %d", len(got))
+	}
+}
+
+func TestLoadSettingsReportsMissingConfigMap(t *testing.T) {
+	providerName := "mock"
+	registry := providers.NewRegistry()
+	registerConfigRecorder(t, registry, providerName)
+
+	_, err := settingsTestSolver(registry).getProvider(settingsChallenge(t, providerName, nil, &ConfigMapReference{Name: "missing"}))
+	if err == nil || !strings.Contains(err.Error(), "failed to get configmap cert-manager/missing") {
+		t.Fatalf("expected a missing ConfigMap error, got %v", err)
+	}
+}
+
+func TestLoadConfigValidatesSettings(t *testing.T) {
+	_, err := loadConfig(routesConfigJSON(t, LibdnsConfig{
+		Provider:  "route53",
+		SecretRef: SecretReference{Name: "aws"},
+		Fallbacks: []BackendConfig{{Provider: "route53", SecretRef: SecretReference{Name: "aws"}, ConfigMapRef: &ConfigMapReference{}}},
+	}))
+	if err == nil || !strings.Contains(err.Error(), "fallbacks[0].configMapRef.name is required") {
+		t.Fatalf("expected a configMapRef error, got %v", err)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"slices"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -19,8 +20,10 @@ import (
 )
 
 type mockProvider struct {
+	mu           sync.Mutex
 	records      []libdns.Record
 	getErr       error
+	getDelay     time.Duration
 	appendCalls  int
 	setCalls     int
 	deleteCalls  int
@@ -28,6 +31,8 @@ type mockProvider struct {
 }
 
 func (m *mockProvider) AppendRecords(_ context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.appendCalls++
 	m.lastZoneSeen = zone
 	m.records = append(m.records, recs...)
@@ -35,6 +40,8 @@ func (m *mockProvider) AppendRecords(_ context.Context, zone string, recs []libd
 }
 
 func (m *mockProvider) DeleteRecords(_ context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.deleteCalls++
 	m.lastZoneSeen = zone
 
@@ -54,16 +61,26 @@ func (m *mockProvider) DeleteRecords(_ context.Context, zone string, recs []libd
 }
 
 func (m *mockProvider) GetRecords(_ context.Context, zone string) ([]libdns.Record, error) {
+	m.mu.Lock()
 	m.lastZoneSeen = zone
 	if m.getErr != nil {
+		m.mu.Unlock()
 		return nil, m.getErr
 	}
 	out := make([]libdns.Record, len(m.records))
 	copy(out, m.records)
+	m.mu.Unlock()
+
+	// Hand out the snapshot late to widen the read-modify-write window for callers
+	if m.getDelay > 0 {
+		time.Sleep(m.getDelay)
+	}
 	return out, nil
 }
 
 func (m *mockProvider) SetRecords(_ context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.setCalls++
 	m.lastZoneSeen = zone
 
@@ -90,19 +107,30 @@ func (m *mockProvider) SetRecords(_ context.Context, zone string, recs []libdns.
 	return recs, nil
 }
 
-func testProviderName(t *testing.T, suffix string) string {
+func registerMockProvider(t *testing.T, registry *providers.Registry, name string, mp *mockProvider) {
+	t.Helper()
+	registerProvider(t, registry, name, mp)
+}
+
+// requireProvider skips the test unless the providers are compiled in
+func requireProvider(t *testing.T, names ...string) {
 	t.Helper()
-	return fmt.Sprintf("test-%s-%s", strings.ReplaceAll(strings.ToLower(t.Name()), "/", "-"), suffix)
+	for _, name := range names {
+		if _, err := providers.Describe(name); err != nil {
+			t.Skipf("provider %s is not compiled in", name)
+		}
+	}
 }
 
-func registerMockProvider(t *testing.T, name string, mp *mockProvider) {
+func registerProvider[P providers.DNSProvider](t *testing.T, registry *providers.Registry, name string, provider P) {
 	t.Helper()
-	providers.Register(name, func(config providers.ProviderConfig) (providers.DNSProvider, error) {
+	providers.RegisterWith(registry, name, func(config providers.ProviderConfig) (P, error) {
 		if len(config.Credentials) == 0 {
-			return nil, fmt.Errorf("expected credentials")
+			var none P
+			return none, fmt.Errorf("expected credentials")
 		}
-		return mp, nil
-	})
+		return provider, nil
+	}, providers.Descriptor{})
 }
 
 func challengeConfigJSON(t *testing.T, providerName, secretName, secretNamespace string, ttl int) *extapi.JSON {
@@ -122,7 +150,7 @@ func challengeConfigJSON(t *testing.T, providerName, secretName, secretNamespace
 	return &extapi.JSON{Raw: raw}
 }
 
-func newTestSolver(namespace, secretName string) *libdnsSolver {
+func newTestSolver(registry *providers.Registry, namespace, secretName string) *libdnsSolver {
 	secret := &corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      secretName,
@@ -133,7 +161,8 @@ func newTestSolver(namespace, secretName string) *libdnsSolver {
 		},
 	}
 	return &libdnsSolver{
-		client: fake.NewSimpleClientset(secret),
+		client:   fake.NewSimpleClientset(secret),
+		registry: registry,
 	}
 }
 
@@ -154,10 +183,11 @@ func TestPresentMergesTXTValues(t *testing.T) {
 			libdns.TXT{Name: "_acme-challenge", Text: "existing", TTL: 120 * time.Second},
 		},
 	}
-	providerName := testProviderName(t, "merge")
-	registerMockProvider(t, providerName, mp)
+	providerName := "mock"
+	registry := providers.NewRegistry()
+	registerMockProvider(t, registry, providerName, mp)
 
-	solver := newTestSolver("cert-manager", "dns-creds")
+	solver := newTestSolver(registry, "cert-manager", "dns-creds")
 	ch := &v1alpha1.ChallengeRequest{
 		ResolvedFQDN:      "_acme-challenge.example.com.",
 		ResolvedZone:      "example.com.",
@@ -185,10 +215,11 @@ func TestPresentMergesTXTValues(t *testing.T) {
 
 func TestPresentFallsBackToAppendWhenGetFails(t *testing.T) {
 	mp := &mockProvider{getErr: fmt.Errorf("transient get error")}
-	providerName := testProviderName(t, "append-fallback")
-	registerMockProvider(t, providerName, mp)
+	providerName := "mock"
+	registry := providers.NewRegistry()
+	registerMockProvider(t, registry, providerName, mp)
 
-	solver := newTestSolver("cert-manager", "dns-creds")
+	solver := newTestSolver(registry, "cert-manager", "dns-creds")
 	ch := &v1alpha1.ChallengeRequest{
 		ResolvedFQDN:      "_acme-challenge.example.com.",
 		ResolvedZone:      "example.com.",
@@ -216,10 +247,11 @@ func TestCleanUpRemovesOnlyMatchingTXTValue(t *testing.T) {
 			libdns.TXT{Name: "_acme-challenge", Text: "remove", TTL: 120 * time.Second},
 		},
 	}
-	providerName := testProviderName(t, "cleanup-selective")
-	registerMockProvider(t, providerName, mp)
+	providerName := "mock"
+	registry := providers.NewRegistry()
+	registerMockProvider(t, registry, providerName, mp)
 
-	solver := newTestSolver("cert-manager", "dns-creds")
+	solver := newTestSolver(registry, "cert-manager", "dns-creds")
 	ch := &v1alpha1.ChallengeRequest{
 		ResolvedFQDN:      "_acme-challenge.example.com.",
 		ResolvedZone:      "example.com.",
@@ -248,10 +280,11 @@ func TestCleanUpFallsBackToDeleteWhenGetFails(t *testing.T) {
 			libdns.TXT{Name: "_acme-challenge", Text: "remove"},
 		},
 	}
-	providerName := testProviderName(t, "cleanup-delete-fallback")
-	registerMockProvider(t, providerName, mp)
+	providerName := "mock"
+	registry := providers.NewRegistry()
+	registerMockProvider(t, registry, providerName, mp)
 
-	solver := newTestSolver("cert-manager", "dns-creds")
+	solver := newTestSolver(registry, "cert-manager", "dns-creds")
 	ch := &v1alpha1.ChallengeRequest{
 		ResolvedFQDN:      "_acme-challenge.example.com.",
 		ResolvedZone:      "example.com.",
@@ -269,8 +302,299 @@ func TestCleanUpFallsBackToDeleteWhenGetFails(t *testing.T) {
 	}
 }
 
+// appendDeleteMock exposes only AppendRecords and DeleteRecords of a
+// mockProvider, like a write-only dynamic DNS API
+type appendDeleteMock struct{ mp *mockProvider }
+
+func (p appendDeleteMock) AppendRecords(ctx context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	return p.mp.AppendRecords(ctx, zone, recs)
+}
+
+func (p appendDeleteMock) DeleteRecords(ctx context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	return p.mp.DeleteRecords(ctx, zone, recs)
+}
+
+// getSetMock exposes only GetRecords and SetRecords of a mockProvider
+type getSetMock struct{ mp *mockProvider }
+
+func (p getSetMock) GetRecords(ctx context.Context, zone string) ([]libdns.Record, error) {
+	return p.mp.GetRecords(ctx, zone)
+}
+
+func (p getSetMock) SetRecords(ctx context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	return p.mp.SetRecords(ctx, zone, recs)
+}
+
+// getAppendDeleteMock lacks SetRecords, so values are never rewritten as a set
+type getAppendDeleteMock struct {
+	appendDeleteMock
+	getSet getSetMock
+}
+
+func (p getAppendDeleteMock) GetRecords(ctx context.Context, zone string) ([]libdns.Record, error) {
+	return p.getSet.GetRecords(ctx, zone)
+}
+
+func capabilityChallenge(t *testing.T, key string) *v1alpha1.ChallengeRequest {
+	t.Helper()
+	return &v1alpha1.ChallengeRequest{
+		ResolvedFQDN:      "_acme-challenge.example.com.",
+		ResolvedZone:      "example.com.",
+		Key:               key,
+		ResourceNamespace: "cert-manager",
+		Config:            challengeConfigJSON(t, "mock", "dns-creds", "", 300),
+	}
+}
+
+func TestAppendDeleteProviderSkipsGet(t *testing.T) {
+	mp := &mockProvider{getErr: fmt.Errorf("GetRecords must not be called")}
+	registry := providers.NewRegistry()
+	registerProvider(t, registry, "mock", appendDeleteMock{mp})
+	solver := newTestSolver(registry, "cert-manager", "dns-creds")
+
+	if err := solver.Present(capabilityChallenge(t, "value")); err != nil {
+		t.Fatalf("Present failed: %v", err)
+	}
+	if mp.appendCalls != 1 {
+		t.Fatalf("expected the value to be appended, got %d appends", mp.appendCalls)
+	}
+	if err := solver.CleanUp(capabilityChallenge(t, "value")); err != nil {
+		t.Fatalf("CleanUp failed: %v", err)
+	}
+	if mp.deleteCalls != 1 || len(mp.records) != 0 {
+		t.Fatalf("expected the value to be deleted, got %d deletes and records %v", mp.deleteCalls, mp.records)
+	}
+}
+
+func TestGetSetProviderWithoutDelete(t *testing.T) {
+	mp := &mockProvider{records: []libdns.Record{libdns.TXT{Name: "_acme-challenge", Text: "other"}}}
+	registry := providers.NewRegistry()
+	registerProvider(t, registry, "mock", getSetMock{mp})
+	solver := newTestSolver(registry, "cert-manager", "dns-creds")
+
+	if err := solver.Present(capabilityChallenge(t, "value")); err != nil {
+		t.Fatalf("Present failed: %v", err)
+	}
+	if values := txtValuesForName(mp.records, "_acme-challenge"); !slices.Equal(values, []string{"other", "value"}) {
+		t.Fatalf("expected merged TXT values [other value], got %v", values)
+	}
+
+	// The sibling value remains, so setting it removes ours
+	if err := solver.CleanUp(capabilityChallenge(t, "value")); err != nil {
+		t.Fatalf("CleanUp failed: %v", err)
+	}
+	if values := txtValuesForName(mp.records, "_acme-challenge"); !slices.Equal(values, []string{"other"}) {
+		t.Fatalf("expected TXT values [other], got %v", values)
+	}
+
+	// The last value cannot be removed without delete; CleanUp leaves it and
+	// succeeds, so the Challenge can be deleted
+	if err := solver.CleanUp(capabilityChallenge(t, "other")); err != nil {
+		t.Fatalf("CleanUp of the last value failed: %v", err)
+	}
+	if values := txtValuesForName(mp.records, "_acme-challenge"); !slices.Equal(values, []string{"other"}) {
+		t.Fatalf("expected the last TXT value to be left, got %v", values)
+	}
+	if mp.setCalls != 2 {
+		t.Fatalf("expected no SetRecords call for the last value, got %d calls in total", mp.setCalls)
+	}
+}
+
+func TestGetSetProviderFailsWhenGetFails(t *testing.T) {
+	mp := &mockProvider{getErr: fmt.Errorf("transient get error")}
+	registry := providers.NewRegistry()
+	registerProvider(t, registry, "mock", getSetMock{mp})
+	solver := newTestSolver(registry, "cert-manager", "dns-creds")
+
+	err := solver.Present(capabilityChallenge(t, "value"))
+	if err == nil || !strings.Contains(err.Error(), "failed to get existing TXT records") {
+		t.Fatalf("expected the get error without an append fallback, got %v", err)
+	}
+	if mp.setCalls != 0 {
+		t.Fatalf("expected no blind SetRecords call, got %d", mp.setCalls)
+	}
+}
+
+func TestProviderWithoutSetAppendsAndDeletes(t *testing.T) {
+	mp := &mockProvider{records: []libdns.Record{libdns.TXT{Name: "_acme-challenge", Text: "other"}}}
+	registry := providers.NewRegistry()
+	registerProvider(t, registry, "mock", getAppendDeleteMock{appendDeleteMock{mp}, getSetMock{mp}})
+	solver := newTestSolver(registry, "cert-manager", "dns-creds")
+
+	for range 2 { // the second Present finds the value and does nothing
+		if err := solver.Present(capabilityChallenge(t, "value")); err != nil {
+			t.Fatalf("Present failed: %v", err)
+		}
+	}
+	if mp.appendCalls != 1 {
+		t.Fatalf("expected a single append, got %d", mp.appendCalls)
+	}
+	if err := solver.CleanUp(capabilityChallenge(t, "value")); err != nil {
+		t.Fatalf("CleanUp failed: %v", err)
+	}
+	if mp.deleteCalls != 1 || mp.setCalls != 0 {
+		t.Fatalf("expected one delete and no set, got %d deletes and %d sets", mp.deleteCalls, mp.setCalls)
+	}
+	if values := txtValuesForName(mp.records, "_acme-challenge"); !slices.Equal(values, []string{"other"}) {
+		t.Fatalf("expected TXT values [other], got %v", values)
+	}
+}
+
+// txtRecordsForName returns the TXT records at name keyed by value
+func txtRecordsForName(records []libdns.Record, name string) map[string]libdns.TXT {
+	out := make(map[string]libdns.TXT)
+	for _, rec := range records {
+		if txt, ok := rec.(libdns.TXT); ok && txt.Name == name {
+			out[txt.Text] = txt
+		}
+	}
+	return out
+}
+
+func TestPresentPreservesSiblingTTLAndProviderData(t *testing.T) {
+	mp := &mockProvider{
+		records: []libdns.Record{
+			libdns.TXT{Name: "_acme-challenge", Text: "typed", TTL: 60 * time.Second, ProviderData: "id-1"},
+			libdns.RR{Name: "_acme-challenge", Type: "TXT", Data: "generic", TTL: 7200 * time.Second},
+		},
+	}
+	providerName := "mock"
+	registry := providers.NewRegistry()
+	registerMockProvider(t, registry, providerName, mp)
+
+	solver := newTestSolver(registry, "cert-manager", "dns-creds")
+	ch := &v1alpha1.ChallengeRequest{
+		ResolvedFQDN:      "_acme-challenge.example.com.",
+		ResolvedZone:      "example.com.",
+		Key:               "new-value",
+		ResourceNamespace: "cert-manager",
+		Config:            challengeConfigJSON(t, providerName, "dns-creds", "", 300),
+	}
+
+	if err := solver.Present(ch); err != nil {
+		t.Fatalf("Present failed: %v", err)
+	}
+
+	got := txtRecordsForName(mp.records, "_acme-challenge")
+	want := map[string]libdns.TXT{
+		"typed":     {Name: "_acme-challenge", Text: "typed", TTL: 60 * time.Second, ProviderData: "id-1"},
+		"generic":   {Name: "_acme-challenge", Text: "generic", TTL: 7200 * time.Second},
+		"new-value": {Name: "_acme-challenge", Text: "new-value", TTL: 300 * time.Second},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d TXT records, got %v", len(want), got)
+	}
+	for value, w := range want {
+		if got[value] != w {
+			t.Fatalf("TXT %q = %+v, want %+v", value, got[value], w)
+		}
+	}
+}
+
+func TestCleanUpPreservesSiblingTTLAndProviderData(t *testing.T) {
+	mp := &mockProvider{
+		records: []libdns.Record{
+			libdns.TXT{Name: "_acme-challenge", Text: "other-tool", TTL: 30 * time.Second, ProviderData: "id-1"},
+			libdns.TXT{Name: "_acme-challenge", Text: "long-lived", TTL: 86400 * time.Second, ProviderData: "id-2"},
+			libdns.TXT{Name: "_acme-challenge", Text: "remove", TTL: 300 * time.Second, ProviderData: "id-3"},
+		},
+	}
+	providerName := "mock"
+	registry := providers.NewRegistry()
+	registerMockProvider(t, registry, providerName, mp)
+
+	solver := newTestSolver(registry, "cert-manager", "dns-creds")
+	ch := &v1alpha1.ChallengeRequest{
+		ResolvedFQDN:      "_acme-challenge.example.com.",
+		ResolvedZone:      "example.com.",
+		Key:               "remove",
+		ResourceNamespace: "cert-manager",
+		Config:            challengeConfigJSON(t, providerName, "dns-creds", "", 300),
+	}
+
+	if err := solver.CleanUp(ch); err != nil {
+		t.Fatalf("CleanUp failed: %v", err)
+	}
+
+	got := txtRecordsForName(mp.records, "_acme-challenge")
+	want := map[string]libdns.TXT{
+		"other-tool": {Name: "_acme-challenge", Text: "other-tool", TTL: 30 * time.Second, ProviderData: "id-1"},
+		"long-lived": {Name: "_acme-challenge", Text: "long-lived", TTL: 86400 * time.Second, ProviderData: "id-2"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %d TXT records, got %v", len(want), got)
+	}
+	for value, w := range want {
+		if got[value] != w {
+			t.Fatalf("TXT %q = %+v, want %+v", value, got[value], w)
+		}
+	}
+}
+
+// lookupMockProvider only supports name-scoped lookups; listing the zone fails
+type lookupMockProvider struct {
+	*mockProvider
+	lookups []string
+}
+
+func (l *lookupMockProvider) GetRecords(context.Context, string) ([]libdns.Record, error) {
+	return nil, fmt.Errorf("zone listing should not be used")
+}
+
+func (l *lookupMockProvider) GetRecordsByName(ctx context.Context, zone, name, recordType string) ([]libdns.Record, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.lookups = append(l.lookups, name+"/"+recordType)
+	var out []libdns.Record
+	for _, rec := range l.records {
+		if rr := rec.RR(); rr.Name == name && rr.Type == recordType {
+			out = append(out, rec)
+		}
+	}
+	return out, nil
+}
+
+func TestPresentAndCleanUpUseNameScopedLookup(t *testing.T) {
+	lp := &lookupMockProvider{mockProvider: &mockProvider{
+		records: []libdns.Record{
+			libdns.TXT{Name: "_acme-challenge", Text: "existing", TTL: 300 * time.Second},
+			libdns.TXT{Name: "unrelated", Text: "other", TTL: 300 * time.Second},
+		},
+	}}
+	providerName := "mock"
+	registry := providers.NewRegistry()
+	registerProvider(t, registry, providerName, lp)
+
+	solver := newTestSolver(registry, "cert-manager", "dns-creds")
+	ch := &v1alpha1.ChallengeRequest{
+		ResolvedFQDN:      "_acme-challenge.example.com.",
+		ResolvedZone:      "example.com.",
+		Key:               "new-value",
+		ResourceNamespace: "cert-manager",
+		Config:            challengeConfigJSON(t, providerName, "dns-creds", "", 300),
+	}
+
+	if err := solver.Present(ch); err != nil {
+		t.Fatalf("Present failed: %v", err)
+	}
+	if err := solver.CleanUp(ch); err != nil {
+		t.Fatalf("CleanUp failed: %v", err)
+	}
+
+	if want := []string{"_acme-challenge/TXT", "_acme-challenge/TXT"}; !slices.Equal(lp.lookups, want) {
+		t.Fatalf("expected lookups %v, got %v", want, lp.lookups)
+	}
+	if lp.appendCalls != 0 || lp.deleteCalls != 0 {
+		t.Fatalf("expected merge via SetRecords without fallbacks, got %d appends and %d deletes", lp.appendCalls, lp.deleteCalls)
+	}
+	if values := txtValuesForName(lp.records, "_acme-challenge"); len(values) != 1 || values[0] != "existing" {
+		t.Fatalf("expected TXT value [existing] after CleanUp, got %v", values)
+	}
+}
+
 func TestGetProviderAppliesDesecMinTTL(t *testing.T) {
-	solver := newTestSolver("cert-manager", "dns-creds")
+	requireProvider(t, "desec")
+	solver := newTestSolver(providers.DefaultRegistry(), "cert-manager", "dns-creds")
 	ch := &v1alpha1.ChallengeRequest{
 		ResolvedFQDN:      "_acme-challenge.example.com.",
 		ResolvedZone:      "example.com.",
@@ -279,11 +603,158 @@ func TestGetProviderAppliesDesecMinTTL(t *testing.T) {
 		Config:            challengeConfigJSON(t, "desec", "dns-creds", "", 0),
 	}
 
-	_, _, ttl, err := solver.getProvider(ch)
+	target, err := solver.getProvider(ch)
 	if err != nil {
 		t.Fatalf("getProvider failed: %v", err)
 	}
-	if ttl != desecMinTTL*time.Second {
-		t.Fatalf("expected TTL %s for deSEC, got %s", desecMinTTL*time.Second, ttl)
+	if target.ttl != time.Hour {
+		t.Fatalf("expected TTL %s for deSEC, got %s", time.Hour, target.ttl)
+	}
+}
+
+func TestConcurrentPresentKeepsAllTXTValues(t *testing.T) {
+	mp := &mockProvider{getDelay: 2 * time.Millisecond}
+	providerName := "mock"
+	registry := providers.NewRegistry()
+	registerMockProvider(t, registry, providerName, mp)
+
+	solver := newTestSolver(registry, "cert-manager", "dns-creds")
+
+	const workers = 32
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for i := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ch := &v1alpha1.ChallengeRequest{
+				ResolvedFQDN:      "_acme-challenge.example.com.",
+				ResolvedZone:      "example.com.",
+				Key:               fmt.Sprintf("value-%d", i),
+				ResourceNamespace: "cert-manager",
+				Config:            challengeConfigJSON(t, providerName, "dns-creds", "", 300),
+			}
+			errs <- solver.Present(ch)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("Present failed: %v", err)
+		}
+	}
+
+	values := txtValuesForName(mp.records, "_acme-challenge")
+	if len(values) != workers {
+		t.Fatalf("expected %d TXT values, got %d: %v", workers, len(values), values)
+	}
+	for i := range workers {
+		if !slices.Contains(values, fmt.Sprintf("value-%d", i)) {
+			t.Fatalf("TXT value value-%d was dropped, got %v", i, values)
+		}
+	}
+}
+
+func TestConcurrentPresentAndCleanUpDoNotDropValues(t *testing.T) {
+	const workers = 16
+
+	// Seed half of the values; they are cleaned up while the other half is presented.
+	mp := &mockProvider{getDelay: 2 * time.Millisecond}
+	for i := range workers {
+		mp.records = append(mp.records, libdns.TXT{Name: "_acme-challenge", Text: fmt.Sprintf("old-%d", i)})
+	}
+	providerName := "mock"
+	registry := providers.NewRegistry()
+	registerMockProvider(t, registry, providerName, mp)
+
+	solver := newTestSolver(registry, "cert-manager", "dns-creds")
+
+	newChallenge := func(key string) *v1alpha1.ChallengeRequest {
+		return &v1alpha1.ChallengeRequest{
+			ResolvedFQDN:      "_acme-challenge.example.com.",
+			ResolvedZone:      "example.com.",
+			Key:               key,
+			ResourceNamespace: "cert-manager",
+			Config:            challengeConfigJSON(t, providerName, "dns-creds", "", 300),
+		}
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*workers)
+	for i := range workers {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			errs <- solver.Present(newChallenge(fmt.Sprintf("new-%d", i)))
+		}()
+		go func() {
+			defer wg.Done()
+			errs <- solver.CleanUp(newChallenge(fmt.Sprintf("old-%d", i)))
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("challenge call failed: %v", err)
+		}
+	}
+
+	values := txtValuesForName(mp.records, "_acme-challenge")
+	for i := range workers {
+		if !slices.Contains(values, fmt.Sprintf("new-%d", i)) {
+			t.Fatalf("presented TXT value new-%d was dropped, got %v", i, values)
+		}
+		if slices.Contains(values, fmt.Sprintf("old-%d", i)) {
+			t.Fatalf("cleaned-up TXT value old-%d is still present, got %v", i, values)
+		}
+	}
+}
+
+func TestKeyedMutexSerializesSameKeyOnly(t *testing.T) {
+	var km keyedMutex
+
+	unlockA := km.Lock("a")
+
+	// A different key must not block while "a" is held.
+	done := make(chan struct{})
+	go func() {
+		unlockB := km.Lock("b")
+		unlockB()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("lock on a different key blocked")
+	}
+
+	// The same key must block until released.
+	acquired := make(chan struct{})
+	go func() {
+		unlock := km.Lock("a")
+		close(acquired)
+		unlock()
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("lock on the same key was acquired while held")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	unlockA()
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("lock on the same key was not acquired after release")
+	}
+
+	km.mu.Lock()
+	defer km.mu.Unlock()
+	if len(km.locks) != 0 {
+		t.Fatalf("expected released locks to be removed, %d remain", len(km.locks))
 	}
 }
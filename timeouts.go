@@ -0,0 +1,145 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/libdns/libdns"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/cert-manager-webhook-libdns/providers"
+)
+
+// Defaults for the contexts bounding a challenge
+const (
+	defaultOperationTimeout   = 2 * time.Minute
+	defaultCallTimeout        = 30 * time.Second
+	defaultSecretFetchTimeout = 30 * time.Second
+)
+
+// TimeoutsConfig bounds the time spent on a challenge
+type TimeoutsConfig struct {
+	// Operation bounds a whole Present or CleanUp including locking, retries
+	// and rate limiting, but not the propagation check (default: 2m)
+	Operation *metav1.Duration `json:"operation,omitempty"`
+
+	// Call bounds a single provider API call attempt (default: 30s)
+	Call *metav1.Duration `json:"call,omitempty"`
+
+	// SecretFetch bounds reading the credential Secret from the API server (default: 30s)
+	SecretFetch *metav1.Duration `json:"secretFetch,omitempty"`
+}
+
+// timeouts is a TimeoutsConfig with defaults applied
+type timeouts struct {
+	operation   time.Duration
+	call        time.Duration
+	secretFetch time.Duration
+}
+
+// validate rejects non-positive durations and a call timeout above the operation timeout
+func (c *TimeoutsConfig) validate(errs *configErrors) {
+	if c == nil {
+		return
+	}
+	valid := true
+	for _, f := range []struct {
+		name  string
+		value *metav1.Duration
+	}{
+		{"timeouts.operation", c.Operation},
+		{"timeouts.call", c.Call},
+		{"timeouts.secretFetch", c.SecretFetch},
+	} {
+		if !validateDuration(errs, f.name, f.value) {
+			valid = false
+		}
+	}
+	if t := newTimeouts(c); valid && t.call > t.operation {
+		errs.addf("timeouts.call (%s) must not exceed timeouts.operation (%s)", t.call, t.operation)
+	}
+}
+
+// newTimeouts applies defaults to an optional TimeoutsConfig
+func newTimeouts(cfg *TimeoutsConfig) timeouts {
+	t := timeouts{
+		operation:   defaultOperationTimeout,
+		call:        defaultCallTimeout,
+		secretFetch: defaultSecretFetchTimeout,
+	}
+	if cfg == nil {
+		return t
+	}
+	if cfg.Operation != nil && cfg.Operation.Duration > 0 {
+		t.operation = cfg.Operation.Duration
+	}
+	if cfg.Call != nil && cfg.Call.Duration > 0 {
+		t.call = cfg.Call.Duration
+	}
+	if cfg.SecretFetch != nil && cfg.SecretFetch.Duration > 0 {
+		t.secretFetch = cfg.SecretFetch.Duration
+	}
+	return t
+}
+
+// contextUntilStopped returns a context that is cancelled once stopCh is closed
+func contextUntilStopped(stopCh <-chan struct{}) context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		select {
+		case <-stopCh:
+		case <-ctx.Done():
+		}
+		cancel()
+	}()
+	return ctx
+}
+
+// timeoutProvider bounds every call of a DNSProvider with its own deadline
+type timeoutProvider struct {
+	inner   providers.DNSProvider
+	timeout time.Duration
+}
+
+// newTimeoutProvider wraps provider so that no single API call exceeds timeout
+func newTimeoutProvider(provider providers.DNSProvider, timeout time.Duration) *timeoutProvider {
+	return &timeoutProvider{inner: provider, timeout: timeout}
+}
+
+func (t *timeoutProvider) unwrap() providers.DNSProvider { return t.inner }
+
+func (t *timeoutProvider) AppendRecords(ctx context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	return providers.AppendRecords(ctx, t.inner, zone, recs)
+}
+
+func (t *timeoutProvider) DeleteRecords(ctx context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	return providers.DeleteRecords(ctx, t.inner, zone, recs)
+}
+
+func (t *timeoutProvider) GetRecords(ctx context.Context, zone string) ([]libdns.Record, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	return providers.GetRecords(ctx, t.inner, zone)
+}
+
+func (t *timeoutProvider) GetRecordsByName(ctx context.Context, zone, name, recordType string) ([]libdns.Record, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	return providers.GetRecordsByName(ctx, t.inner, zone, name, recordType)
+}
+
+func (t *timeoutProvider) ListZones(ctx context.Context) ([]libdns.Zone, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	return providers.ListZones(ctx, t.inner)
+}
+
+func (t *timeoutProvider) SetRecords(ctx context.Context, zone string, recs []libdns.Record) ([]libdns.Record, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	return providers.SetRecords(ctx, t.inner, zone, recs)
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/cert-manager-webhook-libdns/providers"
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"github.com/libdns/libdns"
+	extapi "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// hangingProvider blocks the first hangs GetRecords calls until their context ends
+type hangingProvider struct {
+	*mockProvider
+
+	hangs atomic.Int32
+	calls atomic.Int32
+}
+
+func (h *hangingProvider) GetRecords(ctx context.Context, zone string) ([]libdns.Record, error) {
+	if h.calls.Add(1) <= h.hangs.Load() {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return h.mockProvider.GetRecords(ctx, zone)
+}
+
+func timeoutsConfigJSON(t *testing.T, providerName string, timeouts *TimeoutsConfig, retry *RetryConfig) *extapi.JSON {
+	t.Helper()
+	raw, err := json.Marshal(LibdnsConfig{
+		Provider:  providerName,
+		SecretRef: SecretReference{Name: "dns-creds"},
+		TTL:       300,
+		Retry:     retry,
+		Timeouts:  timeouts,
+	})
+	if err != nil {
+		t.Fatalf("failed to marshal config: %v", err)
+	}
+	return &extapi.JSON{Raw: raw}
+}
+
+func duration(d time.Duration) *metav1.Duration {
+	return &metav1.Duration{Duration: d}
+}
+
+func TestLoadConfigValidatesTimeouts(t *testing.T) {
+	tests := []struct {
+		name     string
+		timeouts *TimeoutsConfig
+		wantErr  string
+	}{
+		{name: "defaults"},
+		{name: "all set", timeouts: &TimeoutsConfig{Operation: duration(5 * time.Minute), Call: duration(time.Minute), SecretFetch: duration(10 * time.Second)}},
+		{name: "call above default operation", timeouts: &TimeoutsConfig{Call: duration(3 * time.Minute)}, wantErr: "timeouts.call (3m0s) must not exceed timeouts.operation (2m0s)"},
+		{name: "negative operation", timeouts: &TimeoutsConfig{Operation: duration(-time.Second)}, wantErr: "timeouts.operation must be positive"},
+		{name: "zero secret fetch", timeouts: &TimeoutsConfig{SecretFetch: duration(0)}, wantErr: "timeouts.secretFetch must be positive"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := loadConfig(timeoutsConfigJSON(t, "mock", tc.timeouts, nil))
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("loadConfig failed: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestNewTimeoutsAppliesDefaults(t *testing.T) {
+	got := newTimeouts(&TimeoutsConfig{Operation: duration(5 * time.Minute)})
+	want := timeouts{operation: 5 * time.Minute, call: defaultCallTimeout, secretFetch: defaultSecretFetchTimeout}
+	if got != want {
+		t.Fatalf("newTimeouts() = %+v, want %+v", got, want)
+	}
+}
+
+func TestPresentRetriesHungProviderCall(t *testing.T) {
+	hp := &hangingProvider{mockProvider: &mockProvider{}}
+	hp.hangs.Store(1)
+	providerName := "mock"
+	registry := providers.NewRegistry()
+	registerProvider(t, registry, providerName, hp)
+
+	solver := newTestSolver(registry, "cert-manager", "dns-creds")
+	ch := &v1alpha1.ChallengeRequest{
+		ResolvedFQDN:      "_acme-challenge.example.com.",
+		ResolvedZone:      "example.com.",
+		Key:               "new-value",
+		ResourceNamespace: "cert-manager",
+		Config:            timeoutsConfigJSON(t, providerName, &TimeoutsConfig{Call: duration(50 * time.Millisecond)}, fastRetry(3)),
+	}
+
+	if err := solver.Present(ch); err != nil {
+		t.Fatalf("Present failed: %v", err)
+	}
+	if got := hp.calls.Load(); got != 2 {
+		t.Fatalf("expected the hung GetRecords call to be retried once, got %d calls", got)
+	}
+	if hp.appendCalls != 0 {
+		t.Fatalf("expected no append fallback after a successful retry, got %d calls", hp.appendCalls)
+	}
+}
+
+func TestPresentFailsAfterOperationTimeout(t *testing.T) {
+	hp := &hangingProvider{mockProvider: &mockProvider{}}
+	hp.hangs.Store(100)
+	providerName := "mock"
+	registry := providers.NewRegistry()
+	registerProvider(t, registry, providerName, hp)
+
+	solver := newTestSolver(registry, "cert-manager", "dns-creds")
+	ch := &v1alpha1.ChallengeRequest{
+		ResolvedFQDN:      "_acme-challenge.example.com.",
+		ResolvedZone:      "example.com.",
+		Key:               "new-value",
+		ResourceNamespace: "cert-manager",
+		Config: timeoutsConfigJSON(t, providerName,
+			&TimeoutsConfig{Operation: duration(100 * time.Millisecond), Call: duration(20 * time.Millisecond)},
+			&RetryConfig{MaxAttempts: 100, InitialBackoff: duration(time.Millisecond), MaxBackoff: duration(time.Millisecond)}),
+	}
+
+	start := time.Now()
+	if err := solver.Present(ch); err == nil {
+		t.Fatal("expected Present to fail once the operation timeout expired")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("expected Present to stop at the operation timeout, took %s", elapsed)
+	}
+}
+
+func TestPresentCancelledOnShutdown(t *testing.T) {
+	hp := &hangingProvider{mockProvider: &mockProvider{}}
+	hp.hangs.Store(100)
+	providerName := "mock"
+	registry := providers.NewRegistry()
+	registerProvider(t, registry, providerName, hp)
+
+	stopCh := make(chan struct{})
+	solver := newTestSolver(registry, "cert-manager", "dns-creds")
+	solver.stopCtx = contextUntilStopped(stopCh)
+	ch := &v1alpha1.ChallengeRequest{
+		ResolvedFQDN:      "_acme-challenge.example.com.",
+		ResolvedZone:      "example.com.",
+		Key:               "new-value",
+		ResourceNamespace: "cert-manager",
+		Config:            timeoutsConfigJSON(t, providerName, nil, fastRetry(1)),
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- solver.Present(ch) }()
+
+	// Shut down while GetRecords hangs; the append fallback must not outlive it either.
+	for hp.calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	close(stopCh)
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Fatal("expected Present to fail after shutdown")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Present did not return after shutdown")
+	}
+}
+
+func TestPresentGivesUpWaitingForRecordLock(t *testing.T) {
+	providerName := "mock"
+	registry := providers.NewRegistry()
+	registerProvider(t, registry, providerName, &mockProvider{})
+
+	solver := newTestSolver(registry, "cert-manager", "dns-creds")
+	ch := &v1alpha1.ChallengeRequest{
+		ResolvedFQDN:      "_acme-challenge.example.com.",
+		ResolvedZone:      "example.com.",
+		Key:               "new-value",
+		ResourceNamespace: "cert-manager",
+		Config: timeoutsConfigJSON(t, providerName,
+			&TimeoutsConfig{Operation: duration(100 * time.Millisecond), Call: duration(50 * time.Millisecond)}, fastRetry(1)),
+	}
+
+	// Another challenge for the same record holds the lock and never lets go
+	target, err := solver.getProvider(ch)
+	if err != nil {
+		t.Fatalf("getProvider failed: %v", err)
+	}
+	unlock := solver.recordLocks.Lock(target.lockKey(extractRecordName(ch.ResolvedFQDN, target.zone)))
+	defer unlock()
+
+	done := make(chan error, 1)
+	go func() { done <- solver.Present(ch) }()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected Present to fail with the operation deadline, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Present kept waiting for the record lock past the operation timeout")
+	}
+}
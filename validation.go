@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// maxTTL is the largest record TTL accepted in the config; challenge records
+// are short-lived, so anything longer is almost certainly a mistake
+const maxTTL = 86400
+
+// maxPort is the largest TCP or UDP port number
+const maxPort = 65535
+
+// configErrors collects the problems found in a config, each message
+// starting with the JSON path of the offending field
+type configErrors struct {
+	errs []error
+}
+
+// addf records a problem
+func (e *configErrors) addf(format string, args ...any) {
+	e.errs = append(e.errs, fmt.Errorf(format, args...))
+}
+
+// add records err if it is not nil
+func (e *configErrors) add(err error) {
+	if err != nil {
+		e.errs = append(e.errs, err)
+	}
+}
+
+// err returns all collected problems as one error, or nil if there are none
+func (e *configErrors) err() error {
+	return e.errAs("invalid config")
+}
+
+// errAs is err with summary in place of "invalid config"
+func (e *configErrors) errAs(summary string) error {
+	if len(e.errs) == 0 {
+		return nil
+	}
+	return &invalidConfigError{summary: summary, errs: e.errs}
+}
+
+// invalidConfigError reports every problem of a config at once, so that a
+// broken issuer can be fixed in one go
+type invalidConfigError struct {
+	summary string
+	errs    []error
+}
+
+func (e *invalidConfigError) Error() string {
+	if len(e.errs) == 1 {
+		return e.summary + ": " + e.errs[0].Error()
+	}
+	msgs := make([]string, len(e.errs))
+	for i, err := range e.errs {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("%s (%d problems): %s", e.summary, len(e.errs), strings.Join(msgs, "; "))
+}
+
+func (e *invalidConfigError) Unwrap() []error {
+	return e.errs
+}
+
+// validateTTL checks that a TTL is unset or at most maxTTL seconds
+func validateTTL(errs *configErrors, path string, ttl int) {
+	switch {
+	case ttl < 0:
+		errs.addf("%sttl must not be negative, got %d", path, ttl)
+	case ttl > maxTTL:
+		errs.addf("%sttl (%d) exceeds the maximum of %d seconds", path, ttl, maxTTL)
+	}
+}
+
+// validateDuration checks that a duration is unset or positive
+func validateDuration(errs *configErrors, path string, d *metav1.Duration) bool {
+	if d != nil && d.Duration <= 0 {
+		errs.addf("%s must be positive, got %s", path, d.Duration)
+		return false
+	}
+	return true
+}
+
+// validateZone checks that a configured zone is a valid domain name
+func validateZone(errs *configErrors, path, zone string) {
+	if zone == "" {
+		return
+	}
+	if msg := checkDomainName(zone); msg != "" {
+		errs.addf("%szone %q is not a valid domain name: %s", path, zone, msg)
+	}
+}
+
+// checkDomainName returns why name is not a valid domain name, or "" if it
+// is. A trailing dot and, for route domains, a leading wildcard are accepted;
+// labels may contain underscores, as in _acme-challenge.
+func checkDomainName(name string) string {
+	name = strings.TrimSuffix(name, ".")
+	if len(name) > 253 {
+		return "must be no more than 253 characters"
+	}
+	for _, label := range strings.Split(name, ".") {
+		switch {
+		case label == "":
+			return "must not contain empty labels"
+		case len(label) > 63:
+			return fmt.Sprintf("label %q must be no more than 63 characters", label)
+		case strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-"):
+			return fmt.Sprintf("label %q must not start or end with a hyphen", label)
+		}
+		for _, r := range label {
+			if !isDomainNameRune(r) {
+				return fmt.Sprintf("label %q contains invalid character %q", label, r)
+			}
+		}
+	}
+	return ""
+}
+
+func isDomainNameRune(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_'
+}
+
+// validateObjectRef checks the name and optional namespace of a referenced
+// Secret or ConfigMap against the Kubernetes naming rules
+func validateObjectRef(errs *configErrors, path, name, namespace string) {
+	if name != "" {
+		for _, msg := range validation.IsDNS1123Subdomain(name) {
+			errs.addf("%s.name %q is invalid: %s", path, name, msg)
+		}
+	}
+	if namespace != "" {
+		for _, msg := range validation.IsDNS1123Label(namespace) {
+			errs.addf("%s.namespace %q is invalid: %s", path, namespace, msg)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	extapi "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+)
+
+func TestLoadConfigRejectsInvalidConfigs(t *testing.T) {
+	tests := []struct {
+		name     string
+		raw      string
+		wantErrs []string
+	}{
+		{
+			name:     "misspelled key",
+			raw:      `{"provider": "desec", "secretref": {"name": "desec"}}`,
+			wantErrs: []string{`unknown field "secretref"`, "secretRef.name is required in config"},
+		},
+		{
+			name:     "unknown nested field",
+			raw:      `{"provider": "desec", "secretRef": {"name": "desec", "namespaces": "cert-manager"}}`,
+			wantErrs: []string{`unknown field "secretRef.namespaces"`},
+		},
+		{
+			name:     "unknown route field",
+			raw:      `{"routes": [{"domain": "example.com", "provider": "desec", "secretRef": {"name": "desec"}, "zones": "example.com"}]}`,
+			wantErrs: []string{`unknown field "routes[0].zones"`},
+		},
+		{
+			name:     "duplicate field",
+			raw:      `{"provider": "desec", "secretRef": {"name": "desec"}, "ttl": 300, "ttl": 600}`,
+			wantErrs: []string{`duplicate field "ttl"`},
+		},
+		{
+			name:     "negative ttl",
+			raw:      `{"provider": "desec", "secretRef": {"name": "desec"}, "ttl": -1}`,
+			wantErrs: []string{"ttl must not be negative, got -1"},
+		},
+		{
+			name:     "ttl too large",
+			raw:      `{"provider": "desec", "secretRef": {"name": "desec"}, "ttl": 604800}`,
+			wantErrs: []string{"ttl (604800) exceeds the maximum of 86400 seconds"},
+		},
+		{
+			name:     "route ttl",
+			raw:      `{"routes": [{"domain": "example.com", "provider": "desec", "secretRef": {"name": "desec"}, "ttl": -60}]}`,
+			wantErrs: []string{"routes[0].ttl must not be negative, got -60"},
+		},
+		{
+			name:     "zone with spaces",
+			raw:      `{"provider": "desec", "secretRef": {"name": "desec"}, "zone": "example .com"}`,
+			wantErrs: []string{`zone "example .com" is not a valid domain name: label "example " contains invalid character ' '`},
+		},
+		{
+			name:     "zone with empty label",
+			raw:      `{"provider": "desec", "secretRef": {"name": "desec"}, "zone": "example..com"}`,
+			wantErrs: []string{`zone "example..com" is not a valid domain name: must not contain empty labels`},
+		},
+		{
+			name:     "route domain",
+			raw:      `{"routes": [{"domain": "-example.com", "provider": "desec", "secretRef": {"name": "desec"}}]}`,
+			wantErrs: []string{`routes[0].domain "-example.com" is not a valid domain name: label "-example" must not start or end with a hyphen`},
+		},
+		{
+			name:     "secret name",
+			raw:      `{"provider": "desec", "secretRef": {"name": "DeSEC_Token"}}`,
+			wantErrs: []string{`secretRef.name "DeSEC_Token" is invalid`},
+		},
+		{
+			name:     "secret namespace",
+			raw:      `{"provider": "desec", "secretRef": {"name": "desec", "namespace": "cert.manager"}}`,
+			wantErrs: []string{`secretRef.namespace "cert.manager" is invalid`},
+		},
+		{
+			name:     "further secret name",
+			raw:      `{"provider": "desec", "secretRef": {"name": "desec"}, "secretRefs": [{"name": "extra secret"}]}`,
+			wantErrs: []string{`secretRefs[0].name "extra secret" is invalid`},
+		},
+		{
+			name:     "configmap name",
+			raw:      `{"provider": "route53", "secretRef": {"name": "aws"}, "configMapRef": {"name": "AWS"}}`,
+			wantErrs: []string{`configMapRef.name "AWS" is invalid`},
+		},
+		{
+			name:     "fallback zone and ttl",
+			raw:      `{"provider": "desec", "secretRef": {"name": "desec"}, "fallbacks": [{"provider": "desec", "secretRef": {"name": "backup"}, "zone": "a b", "ttl": -5}]}`,
+			wantErrs: []string{`fallbacks[0].zone "a b" is not a valid domain name`, "fallbacks[0].ttl must not be negative, got -5"},
+		},
+		{
+			name:     "mirror secret name",
+			raw:      `{"provider": "desec", "secretRef": {"name": "desec"}, "mirrors": [{"provider": "desec", "secretRef": {"name": "Mirror"}}]}`,
+			wantErrs: []string{`mirrors[0].secretRef.name "Mirror" is invalid`},
+		},
+		{
+			name:     "retry",
+			raw:      `{"provider": "desec", "secretRef": {"name": "desec"}, "retry": {"maxAttempts": -1, "maxBackoff": "0s"}}`,
+			wantErrs: []string{"retry.maxAttempts must not be negative, got -1", "retry.maxBackoff must be positive, got 0s"},
+		},
+		{
+			name:     "rate limit",
+			raw:      `{"provider": "desec", "secretRef": {"name": "desec"}, "rateLimit": {"requestsPerSecond": -5, "burst": -1, "maxInFlight": -2}}`,
+			wantErrs: []string{"rateLimit.requestsPerSecond must not be negative, got -5", "rateLimit.burst must not be negative, got -1", "rateLimit.maxInFlight must not be negative, got -2"},
+		},
+		{
+			name:     "propagation",
+			raw:      `{"provider": "desec", "secretRef": {"name": "desec"}, "propagation": {"port": 70000, "interval": "-5s"}}`,
+			wantErrs: []string{"propagation.port must be between 1 and 65535, got 70000", "propagation.interval must be positive, got -5s"},
+		},
+		{
+			name: "all problems at once",
+			raw: `{"provider": "desec", "secretRef": {"name": "desec"}, "tll": 300, "ttl": -1, "zone": "bad zone",
+				"routes": [{"domain": "", "provider": "", "secretRef": {"name": ""}}]}`,
+			wantErrs: []string{
+				`unknown field "tll"`,
+				"ttl must not be negative, got -1",
+				`zone "bad zone" is not a valid domain name`,
+				"routes[0].domain is required",
+				"routes[0].provider is required",
+				"routes[0].secretRef.name is required",
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := loadConfig(&extapi.JSON{Raw: []byte(tc.raw)})
+			if err == nil {
+				t.Fatalf("expected errors %q, got none", tc.wantErrs)
+			}
+			for _, want := range tc.wantErrs {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("expected error containing %q, got %v", want, err)
+				}
+			}
+			var invalid *invalidConfigError
+			if !errors.As(err, &invalid) || len(invalid.errs) != len(tc.wantErrs) {
+				t.Errorf("expected %d aggregated problems, got %v", len(tc.wantErrs), err)
+			}
+		})
+	}
+}
+
+func TestLoadConfigAcceptsValidNames(t *testing.T) {
+	raw := `{
+		"provider": "desec",
+		"secretRef": {"name": "desec-token", "namespace": "cert-manager"},
+		"zone": "Example.COM.",
+		"ttl": 3600,
+		"routes": [{"domain": "*.sub_domain.example.org", "provider": "route53", "secretRef": {"name": "aws.credentials"}, "ttl": 60}]
+	}`
+	if _, err := loadConfig(&extapi.JSON{Raw: []byte(raw)}); err != nil {
+		t.Fatalf("expected a valid config, got %v", err)
+	}
+}
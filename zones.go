@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cert-manager-webhook-libdns/providers"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// zoneCacheTTL is how long a provider account's zone list is reused
+	zoneCacheTTL = 5 * time.Minute
+
+	// zoneCacheMinAge is the age after which a cached zone list that matches
+	// no zone is fetched again, to pick up newly added zones
+	zoneCacheMinAge = 30 * time.Second
+)
+
+// zoneList is the zone list of one provider account
+type zoneList struct {
+	names   []string
+	fetched time.Time
+}
+
+// zoneCache caches the zones hosted by each provider account. The zero value
+// is ready to use.
+type zoneCache struct {
+	mu      sync.Mutex
+	entries map[string]zoneList
+}
+
+// detect returns the longest zone hosted by the account that contains fqdn
+func (c *zoneCache) detect(ctx context.Context, account string, provider providers.DNSProvider, fqdn string) (string, error) {
+	zones, cached := c.get(account)
+	if !cached {
+		var err error
+		if zones, err = c.refresh(ctx, account, provider); err != nil {
+			return "", err
+		}
+	}
+
+	zone := longestZoneSuffix(zones.names, fqdn)
+	if zone == "" && cached && time.Since(zones.fetched) > zoneCacheMinAge {
+		var err error
+		if zones, err = c.refresh(ctx, account, provider); err != nil {
+			return "", err
+		}
+		zone = longestZoneSuffix(zones.names, fqdn)
+	}
+	if zone == "" {
+		return "", fmt.Errorf("no zone hosted by the provider account matches %s (hosted zones: %s)", fqdn, summarizeZones(zones.names))
+	}
+	return zone, nil
+}
+
+// get returns the cached zone list of account unless it expired
+func (c *zoneCache) get(account string) (zoneList, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	zones, ok := c.entries[account]
+	if !ok || time.Since(zones.fetched) > zoneCacheTTL {
+		return zoneList{}, false
+	}
+	return zones, true
+}
+
+// refresh fetches and caches the zone list of account
+func (c *zoneCache) refresh(ctx context.Context, account string, provider providers.DNSProvider) (zoneList, error) {
+	listed, err := providers.ListZones(ctx, provider)
+	if err != nil {
+		return zoneList{}, fmt.Errorf("failed to list zones: %w", err)
+	}
+	zones := zoneList{fetched: time.Now()}
+	for _, z := range listed {
+		if name := normalizeDomain(z.Name); name != "" {
+			zones.names = append(zones.names, name)
+		}
+	}
+	klog.V(2).Infof("Provider account lists %d zone(s)", len(zones.names))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]zoneList)
+	}
+	c.entries[account] = zones
+	return zones, nil
+}
+
+// longestZoneSuffix returns the longest of zones that is fqdn or a parent of it
+func longestZoneSuffix(zones []string, fqdn string) string {
+	fqdn = normalizeDomain(fqdn)
+	best := ""
+	for _, zone := range zones {
+		if fqdn != zone && !strings.HasSuffix(fqdn, "."+zone) {
+			continue
+		}
+		if len(zone) > len(best) {
+			best = zone
+		}
+	}
+	return best
+}
+
+// summarizeZones lists zone names for error messages, abbreviating long lists
+func summarizeZones(zones []string) string {
+	const max = 10
+	switch {
+	case len(zones) == 0:
+		return "none"
+	case len(zones) > max:
+		return fmt.Sprintf("%s and %d more", strings.Join(zones[:max], ", "), len(zones)-max)
+	}
+	return strings.Join(zones, ", ")
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/cert-manager-webhook-libdns/providers"
+	"github.com/cert-manager/cert-manager/pkg/acme/webhook/apis/acme/v1alpha1"
+	"github.com/libdns/libdns"
+)
+
+// zoneListerProvider is a mockProvider that also lists its hosted zones
+type zoneListerProvider struct {
+	*mockProvider
+	zones     []string
+	listCalls atomic.Int32
+}
+
+func (z *zoneListerProvider) ListZones(context.Context) ([]libdns.Zone, error) {
+	z.listCalls.Add(1)
+	zones := make([]libdns.Zone, 0, len(z.zones))
+	for _, name := range z.zones {
+		zones = append(zones, libdns.Zone{Name: name})
+	}
+	return zones, nil
+}
+
+func TestLongestZoneSuffix(t *testing.T) {
+	zones := []string{"example.com", "sub.example.com", "example.org"}
+	tests := []struct {
+		fqdn string
+		want string
+	}{
+		{fqdn: "_acme-challenge.example.com.", want: "example.com"},
+		{fqdn: "_acme-challenge.www.sub.example.com.", want: "sub.example.com"},
+		{fqdn: "_acme-challenge.SUB.Example.com", want: "sub.example.com"},
+		{fqdn: "sub.example.com.", want: "sub.example.com"},
+		{fqdn: "_acme-challenge.notexample.com.", want: ""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.fqdn, func(t *testing.T) {
+			if got := longestZoneSuffix(zones, tc.fqdn); got != tc.want {
+				t.Fatalf("longestZoneSuffix(%q) = %q, want %q", tc.fqdn, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestPresentDetectsHostedZone(t *testing.T) {
+	zp := &zoneListerProvider{mockProvider: &mockProvider{}, zones: []string{"example.com.", "sub.example.com."}}
+	providerName := "mock"
+	registry := providers.NewRegistry()
+	registerProvider(t, registry, providerName, zp)
+
+	solver := newTestSolver(registry, "cert-manager", "dns-creds")
+	for _, key := range []string{"first", "second"} {
+		ch := &v1alpha1.ChallengeRequest{
+			ResolvedFQDN:      "_acme-challenge.www.sub.example.com.",
+			ResolvedZone:      "example.com.", // wrong: sub.example.com is a separate zone
+			Key:               key,
+			ResourceNamespace: "cert-manager",
+			Config:            challengeConfigJSON(t, providerName, "dns-creds", "", 300),
+		}
+		if err := solver.Present(ch); err != nil {
+			t.Fatalf("Present(%s) failed: %v", key, err)
+		}
+	}
+
+	if zp.lastZoneSeen != "sub.example.com" {
+		t.Fatalf("expected the hosted zone sub.example.com, got %q", zp.lastZoneSeen)
+	}
+	if values := txtValuesForName(zp.records, "_acme-challenge.www"); len(values) != 2 {
+		t.Fatalf("expected both values relative to sub.example.com, got %v", zp.records)
+	}
+	if got := zp.listCalls.Load(); got != 1 {
+		t.Fatalf("expected the zone list to be cached per account, got %d ListZones calls", got)
+	}
+}
+
+func TestPresentFailsWhenNoHostedZoneMatches(t *testing.T) {
+	zp := &zoneListerProvider{mockProvider: &mockProvider{}, zones: []string{"example.org."}}
+	providerName := "mock"
+	registry := providers.NewRegistry()
+	registerProvider(t, registry, providerName, zp)
+
+	solver := newTestSolver(registry, "cert-manager", "dns-creds")
+	ch := &v1alpha1.ChallengeRequest{
+		ResolvedFQDN:      "_acme-challenge.example.com.",
+		ResolvedZone:      "example.com.",
+		Key:               "value",
+		ResourceNamespace: "cert-manager",
+		Config:            challengeConfigJSON(t, providerName, "dns-creds", "", 300),
+	}
+
+	err := solver.Present(ch)
+	if err == nil || !strings.Contains(err.Error(), "no zone hosted by the provider account matches _acme-challenge.example.com. (hosted zones: example.org)") {
+		t.Fatalf("expected a no-matching-zone error, got %v", err)
+	}
+	if zp.setCalls != 0 || zp.appendCalls != 0 {
+		t.Fatalf("expected no record to be written, got %v", zp.records)
+	}
+}
+
+func TestConfiguredZoneSkipsZoneDetection(t *testing.T) {
+	zp := &zoneListerProvider{mockProvider: &mockProvider{}}
+	providerName := "mock"
+	registry := providers.NewRegistry()
+	registerProvider(t, registry, providerName, zp)
+
+	solver := newTestSolver(registry, "cert-manager", "dns-creds")
+	ch := &v1alpha1.ChallengeRequest{
+		ResolvedFQDN:      "_acme-challenge.example.com.",
+		ResolvedZone:      "example.com.",
+		Key:               "value",
+		ResourceNamespace: "cert-manager",
+		Config: routesConfigJSON(t, LibdnsConfig{
+			Provider:  providerName,
+			SecretRef: SecretReference{Name: "dns-creds"},
+			Zone:      "example.com",
+		}),
+	}
+
+	if err := solver.Present(ch); err != nil {
+		t.Fatalf("Present failed: %v", err)
+	}
+	if got := zp.listCalls.Load(); got != 0 {
+		t.Fatalf("expected no ListZones calls with a configured zone, got %d", got)
+	}
+}
+
+func TestPresentRejectsZoneNotContainingFQDN(t *testing.T) {
+	tests := []struct {
+		name         string
+		zone         string
+		resolvedZone string
+	}{
+		{name: "configured zone", zone: "example.org", resolvedZone: "example.com."},
+		{name: "resolved zone", resolvedZone: "other.example.com."},
+		{name: "label boundary", zone: "ample.com", resolvedZone: "example.com."},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mp := &mockProvider{}
+			providerName := "mock"
+			registry := providers.NewRegistry()
+			registerProvider(t, registry, providerName, mp)
+
+			solver := newTestSolver(registry, "cert-manager", "dns-creds")
+			ch := &v1alpha1.ChallengeRequest{
+				ResolvedFQDN:      "_acme-challenge.example.com.",
+				ResolvedZone:      tc.resolvedZone,
+				Key:               "value",
+				ResourceNamespace: "cert-manager",
+				Config: routesConfigJSON(t, LibdnsConfig{
+					Provider:  providerName,
+					SecretRef: SecretReference{Name: "dns-creds"},
+					Zone:      tc.zone,
+				}),
+			}
+
+			err := solver.Present(ch)
+			if err == nil || !strings.Contains(err.Error(), "is not in zone") {
+				t.Fatalf("expected a not-in-zone error, got %v", err)
+			}
+			if mp.setCalls != 0 || mp.appendCalls != 0 {
+				t.Fatalf("expected no record to be written, got %v", mp.records)
+			}
+		})
+	}
+}